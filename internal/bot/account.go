@@ -0,0 +1,326 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"YoutubeDownloader/internal/i18n"
+	"YoutubeDownloader/internal/payment"
+	"YoutubeDownloader/internal/pricing"
+	"YoutubeDownloader/internal/storage"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// Tier тариф пользователя
+type Tier string
+
+const (
+	TierFree    Tier = "free"
+	TierPremium Tier = "premium"
+	TierStaff   Tier = "staff"
+)
+
+// TierInfo тариф пользователя и его лимиты
+type TierInfo struct {
+	Tier         Tier
+	DailyLimit   int        // лимит бесплатных скачиваний в сутки, 0 — без лимита
+	PremiumUntil *time.Time // дата окончания подписки, если она когда-либо была
+}
+
+// userTier определяет тариф пользователя: сотрудники и премиум без лимитов,
+// остальные ограничены FreeDailyDownloads
+func (b *Bot) userTier(userID int64) TierInfo {
+	logger := NewLogger("TIER")
+
+	until, err := storage.GetUserPremiumUntil(b.db, userID)
+	if err != nil {
+		logger.Warning("Ошибка получения подписки пользователя %d: %v", userID, err)
+	}
+
+	info := TierInfo{Tier: TierFree, DailyLimit: b.config.FreeDailyDownloads, PremiumUntil: until}
+	switch {
+	case b.roles.RoleOf(userID).Includes(RoleAdmin):
+		info.Tier, info.DailyLimit = TierStaff, 0
+	case until != nil && until.After(time.Now()):
+		info.Tier, info.DailyLimit = TierPremium, 0
+	}
+	return info
+}
+
+// freeDownloadsToday возвращает количество бесплатных скачиваний пользователя за сегодня
+func (b *Bot) freeDownloadsToday(userID int64) (int, error) {
+	now := time.Now()
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return storage.CountUserFreeDownloadsSince(b.db, userID, startOfDay)
+}
+
+// dailyLimitReached проверяет, исчерпан ли дневной лимит бесплатных скачиваний
+func (b *Bot) dailyLimitReached(userID int64, tier TierInfo) bool {
+	if tier.DailyLimit == 0 {
+		return false
+	}
+
+	used, err := b.freeDownloadsToday(userID)
+	if err != nil {
+		NewLogger("TIER").Warning("Ошибка подсчета скачиваний пользователя %d: %v", userID, err)
+		return false
+	}
+	return used >= tier.DailyLimit
+}
+
+// activatePremium продлевает подписку после оплаты и сохраняет платеж
+func (b *Bot) activatePremium(c tele.Context, plan pricing.Plan, payload, chargeID string, amount int) (time.Time, error) {
+	logger := NewLogger("SUBSCRIBE")
+
+	_, err := payment.InsertPaidTransaction(b.db, &payment.Transaction{
+		TelegramUserID:          c.Sender().ID,
+		Amount:                  amount,
+		Status:                  "success",
+		TelegramPaymentChargeID: chargeID,
+		InvoicePayload:          payload,
+		Type:                    "subscription",
+		PricingRule:             "plan:" + plan.ID,
+	})
+	if err != nil {
+		logger.Error("Ошибка сохранения платежа за подписку: %v", err)
+	}
+
+	until, err := storage.ExtendUserPremium(b.db, c.Sender().ID, planDuration(plan))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	logger.Info("Пользователь %d оформил подписку %s до %s", c.Sender().ID, plan.ID, until.Format(time.RFC3339))
+	return until, nil
+}
+
+// sendHistory показывает последние загрузки и платежи пользователя
+// с кнопками повторной отправки закэшированных видео
+func (b *Bot) sendHistory(c tele.Context) error {
+	logger := NewLogger("HISTORY")
+	user := c.Sender()
+
+	jobs, err := storage.GetUserDownloadJobs(b.db, user.ID, HistoryLimit)
+	if err != nil {
+		logger.Error("Ошибка получения загрузок пользователя %d: %v", user.ID, err)
+		return c.Send(b.i18nManager.T(user, "history.error"))
+	}
+	payments, err := payment.GetUserPaidTransactions(b.db, user.ID, HistoryLimit)
+	if err != nil {
+		logger.Error("Ошибка получения платежей пользователя %d: %v", user.ID, err)
+		return c.Send(b.i18nManager.T(user, "history.error"))
+	}
+
+	if len(jobs) == 0 && len(payments) == 0 {
+		return c.Send(b.i18nManager.T(user, "history.empty"))
+	}
+
+	var text strings.Builder
+	var buttons []tele.InlineButton
+
+	if len(jobs) > 0 {
+		text.WriteString(b.i18nManager.T(user, "history.downloads_header"))
+		text.WriteString("\n")
+		for i, job := range jobs {
+			text.WriteString(b.i18nManager.T(user, "history.job_row", i18n.Args{
+				"Index":  i + 1,
+				"Status": b.jobStatusLabel(user, job.Status),
+				"Date":   job.CreatedAt,
+				"URL":    job.URL,
+			}))
+			text.WriteString("\n")
+
+			if job.Status == storage.JobDone {
+				buttons = append(buttons, tele.InlineButton{
+					Text: b.i18nManager.T(user, "history.resend_button", i18n.Args{"Index": i + 1}),
+					Data: CallbackResend + "|" + strconv.FormatInt(job.ID, 10),
+				})
+			}
+		}
+	}
+
+	if len(payments) > 0 {
+		if len(jobs) > 0 {
+			text.WriteString("\n")
+		}
+		text.WriteString(b.i18nManager.T(user, "history.payments_header"))
+		text.WriteString("\n")
+		for _, trx := range payments {
+			text.WriteString(b.i18nManager.T(user, "history.payment_row", i18n.Args{
+				"Date":    trx.CreatedAt,
+				"Amount":  trx.Amount,
+				"Product": b.productLabel(user, trx.InvoicePayload),
+				"Status":  b.paymentStatusLabel(user, trx.Status),
+			}))
+			text.WriteString("\n")
+		}
+	}
+
+	// По 5 кнопок в ряд
+	markup := &tele.ReplyMarkup{}
+	for len(buttons) > 0 {
+		n := min(5, len(buttons))
+		markup.InlineKeyboard = append(markup.InlineKeyboard, buttons[:n])
+		buttons = buttons[n:]
+	}
+
+	return c.Send(text.String(), markup, tele.NoPreview)
+}
+
+// handleResend повторно отправляет видео из истории, если оно есть в кэше
+func (b *Bot) handleResend(c tele.Context, data string) error {
+	logger := NewLogger("HISTORY")
+	user := c.Sender()
+	_ = c.Respond()
+
+	jobID, err := strconv.ParseInt(data, 10, 64)
+	if err != nil {
+		return c.Send(b.i18nManager.T(user, "history.not_found"))
+	}
+
+	job, err := storage.GetDownloadJob(b.db, jobID)
+	if err != nil {
+		logger.Error("Ошибка получения задачи %d: %v", jobID, err)
+		return c.Send(b.i18nManager.T(user, "history.error"))
+	}
+	if job == nil || job.UserID != user.ID {
+		return c.Send(b.i18nManager.T(user, "history.not_found"))
+	}
+
+	cached, err := storage.GetVideoFromCache(b.db, job.URL)
+	if err != nil {
+		logger.Error("Ошибка получения видео из кэша: %v", err)
+		return c.Send(b.i18nManager.T(user, "history.error"))
+	}
+	if cached == nil {
+		return c.Send(b.i18nManager.T(user, "history.not_cached"))
+	}
+
+	if _, err := b.api.Send(user, &tele.Video{File: tele.File{FileID: cached.TelegramFileID}}); err != nil {
+		logger.Error("Ошибка повторной отправки видео пользователю %d: %v", user.ID, err)
+		_ = storage.DeleteVideoFromCache(b.db, job.URL)
+		return c.Send(b.i18nManager.T(user, "history.not_cached"))
+	}
+
+	logger.Info("Видео из задачи %d повторно отправлено пользователю %d", jobID, user.ID)
+	return nil
+}
+
+// sendStatus показывает задачи пользователя в очереди и в работе и состояние подписки
+func (b *Bot) sendStatus(c tele.Context) error {
+	logger := NewLogger("STATUS")
+	user := c.Sender()
+
+	jobs, err := storage.GetUserActiveDownloadJobs(b.db, user.ID)
+	if err != nil {
+		logger.Error("Ошибка получения активных задач пользователя %d: %v", user.ID, err)
+		return c.Send(b.i18nManager.T(user, "status.error"))
+	}
+
+	var text strings.Builder
+	if len(jobs) == 0 {
+		text.WriteString(b.i18nManager.T(user, "status.no_jobs"))
+	} else {
+		text.WriteString(b.i18nManager.T(user, "status.jobs_header"))
+		text.WriteString("\n")
+		for _, job := range jobs {
+			text.WriteString(b.i18nManager.T(user, "status.job_row", i18n.Args{
+				"Status":  b.jobStatusLabel(user, job.Status),
+				"URL":     job.URL,
+				"Elapsed": time.Since(job.CreatedAt),
+			}))
+			text.WriteString("\n")
+		}
+		if queued := b.downloadManager.QueueLength(); queued > 0 {
+			text.WriteString(b.i18nManager.T(user, "status.queue", i18n.Args{"Count": queued}))
+			text.WriteString("\n")
+		}
+	}
+
+	text.WriteString("\n")
+	text.WriteString(b.premiumStatus(user, b.userTier(user.ID)))
+
+	return c.Send(text.String(), tele.NoPreview)
+}
+
+// sendMyDownloads показывает использование скачиваний относительно лимитов тарифа
+func (b *Bot) sendMyDownloads(c tele.Context) error {
+	logger := NewLogger("MYDOWNLOADS")
+	user := c.Sender()
+
+	tier := b.userTier(user.ID)
+
+	usedToday, err := b.freeDownloadsToday(user.ID)
+	if err != nil {
+		logger.Error("Ошибка подсчета скачиваний пользователя %d: %v", user.ID, err)
+		return c.Send(b.i18nManager.T(user, "mydownloads.error"))
+	}
+	month, err := storage.CountUserDownloadsSince(b.db, user.ID, time.Now().AddDate(0, 0, -30))
+	if err != nil {
+		logger.Error("Ошибка подсчета скачиваний пользователя %d: %v", user.ID, err)
+		return c.Send(b.i18nManager.T(user, "mydownloads.error"))
+	}
+	total, err := GetUserDownloads(b.db, user.ID)
+	if err != nil {
+		logger.Error("Ошибка получения статистики пользователя %d: %v", user.ID, err)
+		return c.Send(b.i18nManager.T(user, "mydownloads.error"))
+	}
+	credits, err := storage.GetCreditBalance(b.db, user.ID)
+	if err != nil {
+		logger.Error("Ошибка получения кредитов пользователя %d: %v", user.ID, err)
+		return c.Send(b.i18nManager.T(user, "mydownloads.error"))
+	}
+
+	limit := b.i18nManager.T(user, "mydownloads.unlimited")
+	if tier.DailyLimit > 0 {
+		limit = strconv.Itoa(tier.DailyLimit)
+	}
+
+	text := b.i18nManager.T(user, "mydownloads.summary", i18n.Args{
+		"Tier":    b.i18nManager.T(user, "tier."+string(tier.Tier)),
+		"Used":    usedToday,
+		"Limit":   limit,
+		"Month":   month,
+		"Total":   total,
+		"Credits": credits,
+	})
+	return c.Send(strings.Join([]string{text, b.premiumStatus(user, tier)}, "\n\n"))
+}
+
+// premiumStatus описывает состояние премиум-подписки
+func (b *Bot) premiumStatus(user *tele.User, tier TierInfo) string {
+	switch {
+	case tier.PremiumUntil == nil:
+		return b.i18nManager.T(user, "premium.none")
+	case tier.PremiumUntil.After(time.Now()):
+		return b.i18nManager.T(user, "premium.active", i18n.Args{"Until": *tier.PremiumUntil})
+	default:
+		return b.i18nManager.T(user, "premium.expired", i18n.Args{"Until": *tier.PremiumUntil})
+	}
+}
+
+// jobStatusLabel возвращает локализованный статус задачи скачивания
+func (b *Bot) jobStatusLabel(user *tele.User, status string) string {
+	return b.i18nManager.T(user, "job_status."+status)
+}
+
+// paymentStatusLabel возвращает локализованный статус платежа; неизвестные статусы показываются как есть
+func (b *Bot) paymentStatusLabel(user *tele.User, status string) string {
+	key := "payment_status." + status
+	if !b.i18nManager.HasKey(b.i18nManager.GetUserLanguage(user), key) && !b.i18nManager.HasKey("ru", key) {
+		return status
+	}
+	return b.i18nManager.T(user, key)
+}
+
+// productLabel возвращает локализованное название товара по payload инвойса
+func (b *Bot) productLabel(user *tele.User, payload string) string {
+	if planID, ok := strings.CutPrefix(payload, "subscribe|"); ok {
+		if plan, known := b.subscriptionPlan(planID); known {
+			return b.planName(user, plan)
+		}
+	}
+	return b.i18nManager.T(user, "product.video")
+}
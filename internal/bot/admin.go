@@ -5,121 +5,23 @@ import (
 	"strings"
 	"time"
 
-	"YoutubeDownloader/internal/payment"
+	"YoutubeDownloader/internal/i18n"
 	"YoutubeDownloader/internal/storage"
 
 	tele "gopkg.in/telebot.v4"
 )
 
-// sendAdminTransactionsMenu отправляет меню транзакций для админа
-func (b *Bot) sendAdminTransactionsMenu(c tele.Context) error {
-	logger := NewLogger("ADMIN")
-
-	transactions := b.transactionService.GetAllTransactions()
-	if len(transactions) == 0 {
-		return c.Send(b.i18nManager.T(c.Sender(), "no_transactions"))
-	}
-
-	var btns [][]tele.InlineButton
-	for _, trx := range transactions {
-		// Показываем только успешные и не возвращённые
-		if trx.Status == "success" {
-			caption := fmt.Sprintf("%s | %d XTR | %d", trx.InvoicePayload, trx.Amount, trx.TelegramUserID)
-			btns = append(btns, []tele.InlineButton{{
-				Text: caption,
-				Data: CallbackAdminRefund + "|" + trx.TelegramPaymentChargeID,
-			}})
-		}
-	}
-
-	if len(btns) == 0 {
-		return c.Send(b.i18nManager.T(c.Sender(), "no_refundable_transactions"))
-	}
-
-	markup := &tele.ReplyMarkup{InlineKeyboard: btns}
-	logger.Info("Отправлено меню транзакций для админа")
-	return c.Send(b.i18nManager.T(c.Sender(), "transactions_menu"), markup)
-}
-
-// handleAdminRefund обрабатывает возврат средств админом
-func (b *Bot) handleAdminRefund(c tele.Context, chargeID string) error {
-	logger := NewLogger("ADMIN_REFUND")
-
-	trxs := b.transactionService.GetAllTransactions()
-	for _, trx := range trxs {
-		if trx.TelegramPaymentChargeID == chargeID {
-			// Делаем возврат всегда, независимо от статуса
-			err := payment.RefundStarPayment(trx.TelegramUserID, trx.TelegramPaymentChargeID, trx.Amount, "Возврат по запросу админа")
-			if err != nil {
-				logger.LogErrorWithContext("Ошибка возврата средств", err, chargeID)
-				return c.Send(fmt.Sprintf("❌ Возврат НЕ выполнен для транзакции %s\n\nОшибка: %v", chargeID, err))
-			}
-
-			b.transactionService.MarkRefunded(chargeID)
-			logger.Info("Возврат выполнен для транзакции: %s", chargeID)
-			return c.Send(b.i18nManager.T(c.Sender(), "refund_processed", chargeID))
-		}
-	}
-
-	// Если не нашли транзакцию — пробуем сделать возврат с пустыми amount и userID
-	err := payment.RefundStarPayment(0, chargeID, 0, "Возврат по запросу админа (id не найден)")
-	if err != nil {
-		logger.LogErrorWithContext("Ошибка возврата средств (id не найден)", err, chargeID)
-		return c.Send(fmt.Sprintf("❌ Возврат НЕ выполнен для транзакции %s\n\nОшибка: %v\n\nПримечание: Транзакция не найдена в памяти бота", chargeID, err))
-	}
-
-	logger.Info("Попытка возврата выполнена для транзакции: %s", chargeID)
-	return c.Send(b.i18nManager.T(c.Sender(), "refund_attempt", chargeID))
-}
-
-// handleAdminRefundWithUserID обрабатывает возврат средств админом с указанием user_id
-func (b *Bot) handleAdminRefundWithUserID(c tele.Context, chargeID string, userID int64) error {
-	logger := NewLogger("ADMIN_REFUND_USERID")
-
-	trxs := b.transactionService.GetAllTransactions()
-	for _, trx := range trxs {
-		if trx.TelegramPaymentChargeID == chargeID {
-			if userID == 0 {
-				userID = trx.TelegramUserID
-			}
-
-			err := payment.RefundStarPayment(userID, trx.TelegramPaymentChargeID, trx.Amount, "Возврат по запросу админа")
-			if err != nil {
-				logger.LogErrorWithContext("Ошибка возврата средств", err, chargeID)
-				return c.Send(fmt.Sprintf("❌ Возврат НЕ выполнен для транзакции %s\n\nОшибка: %v\nПользователь: %d", chargeID, err, userID))
-			}
-
-			b.transactionService.MarkRefunded(chargeID)
-			logger.Info("Возврат выполнен для транзакции: %s", chargeID)
-			return c.Send(fmt.Sprintf("✅ Возврат УСПЕШНО выполнен для транзакции %s\n\nПользователь: %d\nСумма: %d ⭐", chargeID, userID, trx.Amount))
-		}
-	}
-
-	if userID == 0 {
-		return c.Send("❌ Возврат невозможен\n\nТранзакция не найдена в памяти бота и user_id не указан")
-	}
-
-	err := payment.RefundStarPayment(userID, chargeID, 0, "Возврат по запросу админа (user_id указан вручную)")
-	if err != nil {
-		logger.LogErrorWithContext("Ошибка возврата средств (user_id указан вручную)", err, chargeID)
-		return c.Send(fmt.Sprintf("❌ Возврат НЕ выполнен для транзакции %s\n\nОшибка: %v\nПользователь: %d\n\nПримечание: Транзакция не найдена в памяти бота", chargeID, err, userID))
-	}
-
-	logger.Info("Попытка возврата выполнена для транзакции: %s с user_id: %d", chargeID, userID)
-	return c.Send(fmt.Sprintf("⚠️ Попытка возврата выполнена для транзакции %s\n\nПользователь: %d\n\nПримечание: Транзакция не найдена в памяти бота, но возврат отправлен в Telegram", chargeID, userID))
-}
-
 // sendTestInvoice отправляет тестовый инвойс
 func (b *Bot) sendTestInvoice(c tele.Context) error {
 	logger := NewLogger("TEST")
 	logger.Info("Отправляем тестовый инвойс")
 
 	invoice := &tele.Invoice{
-		Title:       "Тестовый инвойс",
-		Description: "Тестирование платежной системы",
+		Title:       b.i18nManager.T(c.Sender(), "test_invoice.title"),
+		Description: b.i18nManager.T(c.Sender(), "test_invoice.description"),
 		Payload:     "test|123",
 		Currency:    "XTR",
-		Prices:      []tele.Price{{Label: "Тест", Amount: 1}},
+		Prices:      []tele.Price{{Label: b.i18nManager.T(c.Sender(), "test_invoice.label"), Amount: 1}},
 	}
 
 	logger.Info("Тестовый инвойс: %+v", invoice)
@@ -128,11 +30,11 @@ func (b *Bot) sendTestInvoice(c tele.Context) error {
 	_, err := b.api.Send(c.Sender(), invoice)
 	if err != nil {
 		logger.Error("Ошибка отправки тестового инвойса: %v", err)
-		return c.Send(fmt.Sprintf("Ошибка отправки тестового инвойса: %v", err))
+		return c.Send(b.i18nManager.T(c.Sender(), "test_invoice.error", i18n.Args{"Error": err.Error()}))
 	}
 
 	logger.Info("Тестовый инвойс отправлен успешно")
-	return c.Send("Тестовый инвойс отправлен успешно!")
+	return c.Send(b.i18nManager.T(c.Sender(), "test_invoice.sent"))
 }
 
 // sendDirectInvoice отправляет тестовый инвойс без PreCheckoutQuery
@@ -141,11 +43,11 @@ func (b *Bot) sendDirectInvoice(c tele.Context) error {
 	logger.Info("Отправляем тестовый инвойс без PreCheckoutQuery")
 
 	invoice := &tele.Invoice{
-		Title:       "Тестовый инвойс без PreCheckoutQuery",
-		Description: "Тестирование платежной системы без PreCheckoutQuery",
+		Title:       b.i18nManager.T(c.Sender(), "test_direct.title"),
+		Description: b.i18nManager.T(c.Sender(), "test_direct.description"),
 		Payload:     "test_direct|123",
 		Currency:    "XTR",
-		Prices:      []tele.Price{{Label: "Тест", Amount: 1}},
+		Prices:      []tele.Price{{Label: b.i18nManager.T(c.Sender(), "test_invoice.label"), Amount: 1}},
 	}
 
 	logger.Info("Тестовый инвойс: %+v", invoice)
@@ -154,11 +56,11 @@ func (b *Bot) sendDirectInvoice(c tele.Context) error {
 	_, err := b.api.Send(c.Sender(), invoice)
 	if err != nil {
 		logger.Error("Ошибка отправки тестового инвойса без PreCheckoutQuery: %v", err)
-		return c.Send(fmt.Sprintf("Ошибка отправки тестового инвойса без PreCheckoutQuery: %v", err))
+		return c.Send(b.i18nManager.T(c.Sender(), "test_direct.error", i18n.Args{"Error": err.Error()}))
 	}
 
 	logger.Info("Тестовый инвойс без PreCheckoutQuery отправлен успешно")
-	return c.Send("Тестовый инвойс без PreCheckoutQuery отправлен успешно!")
+	return c.Send(b.i18nManager.T(c.Sender(), "test_direct.sent"))
 }
 
 // sendBotInfo отправляет информацию о боте
@@ -170,9 +72,9 @@ func (b *Bot) sendBotInfo(c tele.Context) error {
 func (b *Bot) sendAPIInfo(c tele.Context) error {
 	var info string
 	if b.config.UseOfficialAPI {
-		info = b.i18nManager.T(c.Sender(), "api_info_official", b.config.TelegramAPIURL)
+		info = b.i18nManager.T(c.Sender(), "api_info_official", i18n.Args{"URL": b.config.TelegramAPIURL})
 	} else {
-		info = b.i18nManager.T(c.Sender(), "api_info_local", b.config.TelegramAPIURL)
+		info = b.i18nManager.T(c.Sender(), "api_info_local", i18n.Args{"URL": b.config.TelegramAPIURL})
 	}
 
 	return c.Send(info)
@@ -185,14 +87,14 @@ func (b *Bot) sendCacheStats(c tele.Context) error {
 	count, err := storage.GetCacheStats(b.db)
 	if err != nil {
 		logger.Error("Ошибка получения статистики кэша: %v", err)
-		return c.Send("Ошибка получения статистики кэша")
+		return c.Send(b.i18nManager.T(c.Sender(), "cache.stats_error"))
 	}
 
 	// Получаем размер кэша и свободное место
 	size := "N/A"
 	free := "N/A"
 
-	info := b.i18nManager.T(c.Sender(), "cache_stats", count, size, free)
+	info := b.i18nManager.T(c.Sender(), "cache_stats", i18n.Args{"Count": count, "Size": size, "Free": free})
 
 	return c.Send(info)
 }
@@ -201,26 +103,23 @@ func (b *Bot) sendCacheStats(c tele.Context) error {
 func (b *Bot) cleanOldCache(c tele.Context, days int) error {
 	logger := NewLogger("CACHE")
 
-	err := storage.CleanOldCache(b.db, days)
+	removed, err := storage.CleanOldCache(b.db, days)
 	if err != nil {
 		logger.Error("Ошибка очистки кэша: %v", err)
-		return c.Send("Ошибка очистки кэша")
+		return c.Send(b.i18nManager.T(c.Sender(), "cache.clean_error"))
 	}
 
-	logger.Info("Очищены записи кэша старше %d дней", days)
-	return c.Send(b.i18nManager.T(c.Sender(), "cache_cleaned", days, 0))
+	logger.Info("Очищены записи кэша старше %d дней: %d", days, removed)
+	return c.Send(b.i18nManager.T(c.Sender(), "cache_cleaned", i18n.Args{"Days": days, "Removed": removed}))
 }
 
 // clearAllCache очищает весь кэш
 func (b *Bot) clearAllCache(c tele.Context) error {
 	logger := NewLogger("CACHE")
 
-	// Удаляем все записи из кэша
-	query := `DELETE FROM video_cache`
-	_, err := b.db.Exec(query)
-	if err != nil {
+	if _, err := storage.PurgeCache(b.db); err != nil {
 		logger.Error("Ошибка полной очистки кэша: %v", err)
-		return c.Send("Ошибка очистки кэша")
+		return c.Send(b.i18nManager.T(c.Sender(), "cache.clean_error"))
 	}
 
 	logger.Info("Полностью очищен кэш")
@@ -237,14 +136,17 @@ func (b *Bot) sendActiveDownloads(c tele.Context) error {
 	}
 
 	var info strings.Builder
-	info.WriteString(fmt.Sprintf("📥 Активные скачивания (%d):\n\n", len(activeDownloads)))
+	info.WriteString(b.i18nManager.T(c.Sender(), "downloads.active_header", i18n.Args{"Count": len(activeDownloads)}))
+	info.WriteString("\n\n")
 
 	for url, downloadInfo := range activeDownloads {
-		duration := time.Since(downloadInfo.StartTime)
-		info.WriteString(fmt.Sprintf("🔗 %s\n", url))
-		info.WriteString(fmt.Sprintf("👤 Пользователь: %d\n", downloadInfo.UserID))
-		info.WriteString(fmt.Sprintf("🆔 Request ID: %s\n", downloadInfo.RequestID))
-		info.WriteString(fmt.Sprintf("⏱️ Время: %v\n\n", duration))
+		info.WriteString(b.i18nManager.T(c.Sender(), "downloads.active_row", i18n.Args{
+			"URL":       url,
+			"UserID":    downloadInfo.UserID,
+			"RequestID": downloadInfo.RequestID,
+			"Elapsed":   time.Since(downloadInfo.StartTime),
+		}))
+		info.WriteString("\n\n")
 	}
 
 	logger.Info("Отправлена информация об %d активных скачиваниях", len(activeDownloads))
@@ -265,90 +167,111 @@ func formatBytesAdmin(bytes int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
 
-// testSubscription тестирует проверку подписки
+// testSubscription тестирует проверку подписки на каждый канал спонсоров
 func (b *Bot) testSubscription(c tele.Context) error {
 	logger := NewLogger("TEST_SUBSCRIPTION")
 
-	if b.config.ChannelUsername == "" {
+	channels := b.sponsors.Channels()
+	if len(channels) == 0 {
 		return c.Send(b.i18nManager.T(c.Sender(), "channel_not_configured"))
 	}
 
 	userID := c.Sender().ID
-	logger.Info("Тестируем проверку подписки для пользователя %d на канал %s", userID, b.config.ChannelUsername)
-
-	// Тестируем проверку подписки
-	isSub, err := b.CheckUserSubscriptionRaw(b.config.ChannelUsername, userID)
-
-	if err != nil {
-		errorMsg := fmt.Sprintf("❌ Ошибка проверки подписки:\n\n%s\n\n💡 Возможные причины:\n• Бот не добавлен в канал\n• Бот не является администратором\n• Неправильное имя канала\n• Канал приватный", err.Error())
-		return c.Send(errorMsg)
+	var results []string
+	for _, ch := range channels {
+		logger.Info("Тестируем проверку подписки для пользователя %d на канал %s", userID, ch.Channel)
+
+		// Тестируем проверку подписки в обход кэша
+		isSub, err := b.sponsors.IsMember(ch.Channel, userID, true)
+		args := i18n.Args{"UserID": userID, "Channel": ch.Channel}
+		switch {
+		case err != nil:
+			results = append(results, b.i18nManager.T(c.Sender(), "subscription_test.error", i18n.Args{"Error": err.Error()}))
+		case isSub:
+			results = append(results, b.i18nManager.T(c.Sender(), "subscription_test.subscribed", args))
+		default:
+			results = append(results, b.i18nManager.T(c.Sender(), "subscription_test.not_subscribed", args))
+		}
 	}
 
-	if isSub {
-		return c.Send(fmt.Sprintf("✅ Пользователь %d подписан на канал %s", userID, b.config.ChannelUsername))
-	} else {
-		return c.Send(fmt.Sprintf("❌ Пользователь %d НЕ подписан на канал %s", userID, b.config.ChannelUsername))
-	}
+	return c.Send(strings.Join(results, "\n\n"))
 }
 
-// testChannel тестирует доступ к каналу
+// testChannel тестирует доступ к каналам спонсоров
 func (b *Bot) testChannel(c tele.Context) error {
-	logger := NewLogger("TEST_CHANNEL")
-
-	if b.config.ChannelUsername == "" {
+	channels := b.sponsors.Channels()
+	if len(channels) == 0 {
 		return c.Send(b.i18nManager.T(c.Sender(), "channel_not_configured"))
 	}
 
-	logger.Info("Тестируем доступ к каналу %s", b.config.ChannelUsername)
+	var results []string
+	for _, ch := range channels {
+		results = append(results, b.describeChannelAccess(c.Sender(), ch.Channel))
+	}
+	return c.Send(strings.Join(results, "\n\n"))
+}
+
+// describeChannelAccess проверяет, видит ли бот канал и может ли проверять подписки
+func (b *Bot) describeChannelAccess(user *tele.User, channel string) string {
+	NewLogger("TEST_CHANNEL").Info("Тестируем доступ к каналу %s", channel)
 
 	// Пытаемся получить информацию о канале
-	chat, err := b.api.ChatByUsername(b.config.ChannelUsername)
+	chat, err := b.api.ChatByUsername(channel)
 	if err != nil {
-		errorMsg := fmt.Sprintf("❌ Не удалось найти канал %s:\n\n%s\n\n💡 Решения:\n• Добавьте бота в канал\n• Проверьте правильность имени канала\n• Убедитесь, что канал публичный", b.config.ChannelUsername, err.Error())
-		return c.Send(errorMsg)
+		return b.i18nManager.T(user, "channel_test.not_found", i18n.Args{"Channel": channel, "Error": err.Error()})
 	}
 
 	// Пытаемся получить информацию о боте в канале
 	botMember, err := b.api.ChatMemberOf(chat, &tele.User{ID: b.api.Me.ID})
 	if err != nil {
-		errorMsg := fmt.Sprintf("⚠️ Канал найден, но не удалось проверить права бота:\n\n%s\n\n💡 Возможные причины:\n• Бот не добавлен в канал\n• Недостаточно прав у бота", err.Error())
-		return c.Send(errorMsg)
+		return b.i18nManager.T(user, "channel_test.rights_error", i18n.Args{"Error": err.Error()})
 	}
 
-	info := fmt.Sprintf("✅ Канал найден:\n\n📢 Название: %s\n🆔 ID: %d\n👤 Тип: %s\n\n🤖 Роль бота: %s\n\n💡 Статус: %s",
-		chat.Title, chat.ID, chat.Type, botMember.Role,
-		func() string {
-			if botMember.Role == "administrator" || botMember.Role == "creator" {
-				return "✅ Бот может проверять подписки"
-			} else {
-				return "❌ Бот не может проверять подписки (нужны права администратора)"
-			}
-		}())
+	status := b.i18nManager.T(user, "channel_test.cannot_check")
+	if botMember.Role == "administrator" || botMember.Role == "creator" {
+		status = b.i18nManager.T(user, "channel_test.can_check")
+	}
 
-	return c.Send(info)
+	return b.i18nManager.T(user, "channel_test.info", i18n.Args{
+		"Title":  chat.Title,
+		"ChatID": chat.ID,
+		"Type":   string(chat.Type),
+		"Role":   string(botMember.Role),
+		"Status": status,
+	})
 }
 
-// showConfig показывает текущую конфигурацию бота
+// showConfig показывает текущую конфигурацию бота; секреты замаскированы
 func (b *Bot) showConfig(c tele.Context) error {
 	logger := NewLogger("CONFIG")
+	user := c.Sender()
+
+	entries := b.config.Entries()
+	settings := make([]string, 0, len(entries))
+	for _, e := range entries {
+		settings = append(settings, e.Key+": "+e.Value)
+	}
+
+	source := b.config.Source
+	if source == "" {
+		source = b.i18nManager.T(user, "config_source_env")
+	}
 
-	configInfo := fmt.Sprintf("🤖 Admin ID: %s\n"+
-		"📢 Channel Username: %s\n"+
-		"🌐 Use Official API: %t\n"+
-		"🔗 API URL: %s\n"+
-		"👥 Max Workers: %d\n"+
-		"⏱️ HTTP Timeout: %v\n"+
-		"📥 Download Timeout: %v",
-		b.config.AdminID,
-		b.config.ChannelUsername,
-		b.config.UseOfficialAPI,
-		b.config.TelegramAPIURL,
-		b.config.MaxWorkers,
-		b.config.HTTPTimeout,
-		b.config.DownloadTimeout)
-
-	info := b.i18nManager.T(c.Sender(), "config_info", configInfo)
+	info := b.i18nManager.T(user, "config_info", i18n.Args{
+		"Source":   source,
+		"Channel":  b.sponsorChannelList(),
+		"Settings": strings.Join(settings, "\n"),
+	})
 
 	logger.Info("Показана конфигурация бота")
 	return c.Send(info)
 }
+
+// sponsorChannelList перечисляет каналы спонсоров через запятую
+func (b *Bot) sponsorChannelList() string {
+	var names []string
+	for _, ch := range b.sponsors.Channels() {
+		names = append(names, ch.Channel)
+	}
+	return strings.Join(names, ", ")
+}
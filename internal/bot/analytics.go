@@ -0,0 +1,176 @@
+package bot
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"YoutubeDownloader/internal/i18n"
+	"YoutubeDownloader/internal/storage"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// Периоды отчетов аналитики по умолчанию и максимальные (ограничены длиной сообщения Telegram)
+const (
+	analyticsDefaultDays = 7
+	analyticsMaxDays     = 31
+	funnelDefaultDays    = 30
+	funnelMaxDays        = 365
+)
+
+// trackEvent записывает событие аналитики. Ошибка записи не должна мешать пользователю
+func (b *Bot) trackEvent(e storage.Event) {
+	if err := storage.RecordEvent(b.db, e); err != nil {
+		NewLogger("ANALYTICS").Warning("%v", err)
+	}
+}
+
+// recordDelivery учитывает отправленное пользователю видео, в том числе из кэша
+func (b *Bot) recordDelivery(userID int64) {
+	_ = IncrementDownloads(b.db, userID)
+	b.trackEvent(storage.Event{UserID: userID, Type: storage.EventDownloadDelivered})
+}
+
+// analyticsPeriod возвращает период из аргумента days: последние N дней, включая сегодня
+func analyticsPeriod(c tele.Context, defaultDays, maxDays int) (from, to time.Time, days int, ok bool) {
+	days = defaultDays
+	if args := commandArgs(c); args.Has("days") {
+		days = args.Int("days")
+	}
+	if days < 1 || days > maxDays {
+		return time.Time{}, time.Time{}, days, false
+	}
+	to = time.Now()
+	return to.AddDate(0, 0, -(days - 1)), to, days, true
+}
+
+// percent доля в процентах, округленная до целого
+func percent(part, total int64) int64 {
+	if total == 0 {
+		return 0
+	}
+	return int64(math.Round(float64(part) * 100 / float64(total)))
+}
+
+// handleAnalyticsCommand показывает DAU/WAU/MAU и активность по дням: /analytics [days]
+func (b *Bot) handleAnalyticsCommand(c tele.Context) error {
+	user := c.Sender()
+	from, to, days, ok := analyticsPeriod(c, analyticsDefaultDays, analyticsMaxDays)
+	if !ok {
+		return c.Send(b.i18nManager.T(user, "analytics.invalid_days", i18n.Args{"Max": analyticsMaxDays}))
+	}
+
+	activity, err := storage.GetDailyActivity(b.db, from, to)
+	if err != nil {
+		return c.Send(b.i18nManager.T(user, "stats.error", i18n.Args{"Error": err.Error()}))
+	}
+	if len(activity) == 0 {
+		return c.Send(b.i18nManager.T(user, "stats.no_data"))
+	}
+
+	var rows []string
+	var newUsers int64
+	for _, a := range activity {
+		newUsers += a.NewUsers
+		rows = append(rows, b.i18nManager.T(user, "analytics.daily_row", i18n.Args{
+			"Date":      a.Day.Format(time.DateOnly),
+			"DAU":       a.DAU,
+			"New":       a.NewUsers,
+			"Links":     a.Links,
+			"Paywalls":  a.Paywalls,
+			"Payments":  a.Payments,
+			"Downloads": a.Downloads,
+		}))
+	}
+
+	today := activity[len(activity)-1]
+	return c.Send(b.i18nManager.T(user, "analytics.daily", i18n.Args{
+		"Days":     days,
+		"DAU":      today.DAU,
+		"WAU":      today.WAU,
+		"MAU":      today.MAU,
+		"NewUsers": newUsers,
+		"Rows":     strings.Join(rows, "\n"),
+	}))
+}
+
+// handleRetentionCommand показывает D1/D7 удержание когорт новых пользователей: /retention [days]
+func (b *Bot) handleRetentionCommand(c tele.Context) error {
+	user := c.Sender()
+	from, to, days, ok := analyticsPeriod(c, analyticsDefaultDays*2, analyticsMaxDays)
+	if !ok {
+		return c.Send(b.i18nManager.T(user, "analytics.invalid_days", i18n.Args{"Max": analyticsMaxDays}))
+	}
+
+	cohorts, err := storage.GetRetention(b.db, from, to)
+	if err != nil {
+		return c.Send(b.i18nManager.T(user, "stats.error", i18n.Args{"Error": err.Error()}))
+	}
+	if len(cohorts) == 0 {
+		return c.Send(b.i18nManager.T(user, "stats.no_data"))
+	}
+
+	value := func(retained, size int64, ready bool) string {
+		if !ready {
+			return b.i18nManager.T(user, "analytics.retention_pending")
+		}
+		return b.i18nManager.T(user, "analytics.retention_value", i18n.Args{"Rate": percent(retained, size), "Count": retained})
+	}
+
+	rows := make([]string, 0, len(cohorts))
+	for _, r := range cohorts {
+		rows = append(rows, b.i18nManager.T(user, "analytics.retention_row", i18n.Args{
+			"Date": r.Day.Format(time.DateOnly),
+			"Size": r.Size,
+			"D1":   value(r.D1, r.Size, r.D1Ready),
+			"D7":   value(r.D7, r.Size, r.D7Ready),
+		}))
+	}
+
+	return c.Send(b.i18nManager.T(user, "analytics.retention", i18n.Args{"Days": days, "Rows": strings.Join(rows, "\n")}))
+}
+
+// handleFunnelCommand показывает воронку ссылка → пейволл → оплата и конверсию по планам: /funnel [days]
+func (b *Bot) handleFunnelCommand(c tele.Context) error {
+	user := c.Sender()
+	from, to, days, ok := analyticsPeriod(c, funnelDefaultDays, funnelMaxDays)
+	if !ok {
+		return c.Send(b.i18nManager.T(user, "analytics.invalid_days", i18n.Args{"Max": funnelMaxDays}))
+	}
+
+	funnel, err := storage.GetFunnel(b.db, from, to)
+	if err != nil {
+		return c.Send(b.i18nManager.T(user, "stats.error", i18n.Args{"Error": err.Error()}))
+	}
+
+	plans := b.i18nManager.T(user, "analytics.no_payments")
+	if len(funnel.Plans) > 0 {
+		rows := make([]string, 0, len(funnel.Plans))
+		for _, p := range funnel.Plans {
+			plan := p.Plan
+			if plan == "" {
+				plan = b.i18nManager.T(user, "analytics.plan_none")
+			}
+			rows = append(rows, b.i18nManager.T(user, "analytics.funnel_plan", i18n.Args{
+				"Plan":     plan,
+				"Payers":   p.Payers,
+				"Payments": p.Payments,
+				"Amount":   p.Amount,
+				"Rate":     percent(p.Payers, funnel.PaywallUsers),
+			}))
+		}
+		plans = strings.Join(rows, "\n")
+	}
+
+	return c.Send(b.i18nManager.T(user, "analytics.funnel", i18n.Args{
+		"Days":      days,
+		"Links":     funnel.LinkUsers,
+		"Paywall":   funnel.PaywallUsers,
+		"Shows":     funnel.PaywallShows,
+		"Payers":    funnel.Payers,
+		"Rate":      percent(funnel.Payers, funnel.PaywallUsers),
+		"Delivered": funnel.DeliveredUsers,
+		"Plans":     plans,
+	}))
+}
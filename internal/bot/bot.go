@@ -1,46 +1,54 @@
 package bot
 
 import (
+	"context"
 	"database/sql"
 	"net/http"
+	"time"
 
+	"YoutubeDownloader/internal/config"
 	"YoutubeDownloader/internal/i18n"
-	"YoutubeDownloader/internal/payment"
+	"YoutubeDownloader/internal/metrics"
+	"YoutubeDownloader/internal/pricing"
+	"YoutubeDownloader/internal/storage"
 
 	tele "gopkg.in/telebot.v4"
 )
 
-// NewBot создает новый экземпляр бота
-func NewBot(token, adminID, providerToken string, db *sql.DB) (*Bot, error) {
-	config := NewBotConfig(token, adminID, providerToken)
+// NewBot создает новый экземпляр бота. Конфигурация уже проверена config.Load,
+// логирование настроено вызывающим (logging.Setup)
+func NewBot(cfg *config.Config, db *sql.DB) (*Bot, error) {
 	logger := NewLogger("BOT")
 
 	logger.Info("Инициализация бота для Telegram Stars")
-	logger.LogConfig(config)
+	logger.LogConfig(cfg)
 
-	// Инициализируем менеджер локализации
+	// Инициализируем менеджер локализации: встроенные переводы + необязательная директория override
 	i18nManager := i18n.NewManager("ru")
-	if err := i18nManager.LoadTranslations("internal/i18n/translations"); err != nil {
-		logger.Error("Ошибка загрузки переводов: %v", err)
-		// Не прерываем инициализацию, используем fallback
-	} else {
-		logger.Info("Переводы загружены успешно")
+	counts, err := i18nManager.Reload(cfg.I18nOverrideDir)
+	if err != nil {
+		// Неполные переводы — ошибка конфигурации, не запускаемся с ними
+		return nil, err
 	}
+	logger.Info("Переводы загружены: %v", counts)
+	i18nManager.SetLanguageStore(storage.NewUserLanguageStore(db), i18n.DefaultPreferenceTTL)
 
-	// Создаем настройки для Telegram API
+	// Создаем настройки для Telegram API. chat_member не входит в апдейты по умолчанию,
+	// поэтому запрашиваем полный список
+	apiClient := &http.Client{Timeout: cfg.HTTPTimeout, Transport: metrics.InstrumentTransport(nil)}
 	settings := tele.Settings{
-		Token:  config.Token,
-		Poller: &tele.LongPoller{Timeout: DefaultPollerTimeout},
-		Client: &http.Client{Timeout: config.HTTPTimeout},
+		Token:  cfg.Token,
+		Poller: &tele.LongPoller{Timeout: DefaultPollerTimeout, AllowedUpdates: tele.AllowedUpdates},
+		Client: apiClient,
 	}
 
 	// Настройка URL для API
-	if config.UseOfficialAPI {
-		settings.URL = config.TelegramAPIURL
+	if cfg.UseOfficialAPI {
+		settings.URL = cfg.TelegramAPIURL
 		logger.Info("Используем ОФИЦИАЛЬНЫЙ Telegram Bot API: %s", settings.URL)
 	} else {
-		if config.TelegramAPIURL != "" {
-			settings.URL = config.TelegramAPIURL
+		if cfg.TelegramAPIURL != "" {
+			settings.URL = cfg.TelegramAPIURL
 			logger.Info("Используем ЛОКАЛЬНЫЙ Telegram Bot API: %s", settings.URL)
 		} else {
 			logger.Info("Используем дефолтный локальный API URL")
@@ -52,30 +60,97 @@ func NewBot(token, adminID, providerToken string, db *sql.DB) (*Bot, error) {
 		return nil, err
 	}
 
+	// Загружаем роли сотрудников; владелец всегда берется из ADMIN_ID
+	roles := NewRoleManager(db, cfg.AdminID)
+	if err := roles.Load(); err != nil {
+		logger.Error("Ошибка загрузки ролей: %v", err)
+	}
+
+	// Каналы спонсоров; пока список в БД пуст, используется CHANNEL_USERNAME
+	sponsors := NewSponsorGate(db, api, cfg.ChannelUsername, cfg.SponsorCheckTTL)
+	if err := sponsors.Load(); err != nil {
+		logger.Error("Ошибка загрузки каналов спонсоров: %v", err)
+	}
+
+	// Загружаем цены: из БД, из PRICING_FILE или значения по умолчанию
+	prices := pricing.NewManager(db)
+	if err := prices.Load(cfg.PricingFile); err != nil {
+		// Битая таблица цен — ошибка конфигурации, как и неполные переводы
+		return nil, err
+	}
+	logger.Info("Цены загружены (источник: %s)", prices.Source())
+
+	downloadManager := NewDownloadManager(cfg.MaxWorkers)
+	metrics.RegisterDownloadGauges(
+		func() float64 { return float64(downloadManager.QueueLength()) },
+		func() float64 { return float64(downloadManager.ActiveSlots()) },
+	)
+
 	logger.Info("Бот успешно инициализирован")
 
-	return &Bot{
-		api:                api,
-		config:             config,
-		transactionService: payment.NewTransactionService(),
-		downloadManager:    NewDownloadManager(config.MaxWorkers),
-		db:                 db,
-		i18nManager:        i18nManager,
-	}, nil
+	b := &Bot{
+		api:             api,
+		apiClient:       apiClient,
+		config:          cfg,
+		downloadManager: downloadManager,
+		db:              db,
+		i18nManager:     i18nManager,
+		roles:           roles,
+		pricing:         prices,
+		sponsors:        sponsors,
+		trxSessions:     make(map[string]*trxSession),
+		broadcastWake:   make(chan struct{}, 1),
+		startedAt:       time.Now(),
+	}
+	b.health = b.newHealthChecker()
+	return b, nil
 }
 
-// Run запускает бота
-func (b *Bot) Run() {
+// Run запускает бота и блокируется до отмены ctx, после чего останавливает его (см. shutdown)
+func (b *Bot) Run(ctx context.Context) {
 	logger := NewLogger("BOT")
 
 	// Настраиваем middleware
 	b.setupMiddleware()
 
-	// Регистрируем основные обработчики
+	// Задачи, не завершившиеся до перезапуска, уже не выполнятся
+	if n, err := storage.FailStaleDownloadJobs(b.db, "бот был перезапущен"); err != nil {
+		logger.Error("Ошибка закрытия незавершенных задач: %v", err)
+	} else if n > 0 {
+		logger.Warning("Помечено как failed незавершенных задач скачивания: %d", n)
+	}
+
+	// Регистрируем команды и основные обработчики
+	b.registerCommands()
 	b.registerHandlers()
 
+	// Публикуем меню команд для пользователей и сотрудников
+	go b.publishCommands()
+
+	// Служебный HTTP: метрики Prometheus и проверки состояния
+	b.startHTTPServer()
+
+	// Дайджесты и алерты в чаты администраторов
+	go b.runReports(ctx)
+
+	// Рассылки, подтвержденные администраторами, в том числе прерванные перезапуском
+	go b.runBroadcasts(ctx)
+
+	// Следим за директорией переводов
+	go b.i18nManager.Watch(ctx, b.config.I18nOverrideDir, b.config.I18nReloadInterval, func(counts map[string]int, err error) {
+		if err != nil {
+			logger.Error("Ошибка перезагрузки переводов: %v", err)
+			return
+		}
+		logger.Info("Переводы перезагружены: %v", counts)
+	})
+
 	logger.Info("Запуск бота...")
-	b.api.Start()
+	go b.api.Start()
+
+	<-ctx.Done()
+	logger.Info("Получен сигнал остановки")
+	b.shutdown()
 }
 
 // registerHandlers регистрирует все обработчики
@@ -86,6 +161,8 @@ func (b *Bot) registerHandlers() {
 	b.api.Handle(tele.OnText, b.handleMessage)
 	b.api.Handle(tele.OnCallback, b.handleCallback)
 	b.api.Handle(tele.OnPayment, b.handlePayment)
+	b.api.Handle(tele.OnChatMember, b.handleChatMember)
+	b.api.Handle(tele.OnMyChatMember, b.handleMyChatMember)
 
 	// Регистрируем обработчики для всех остальных типов апдейтов
 	b.registerAllUpdateHandlers()
@@ -108,7 +185,7 @@ func (b *Bot) registerAllUpdateHandlers() {
 		tele.OnNewGroupTitle, tele.OnNewGroupPhoto, tele.OnGroupPhotoDeleted,
 		tele.OnGroupCreated, tele.OnSuperGroupCreated, tele.OnChannelCreated,
 		tele.OnMigration, tele.OnMedia, tele.OnQuery, tele.OnInlineResult,
-		tele.OnShipping, tele.OnCheckout, tele.OnMyChatMember, tele.OnChatMember,
+		tele.OnShipping, tele.OnCheckout,
 		tele.OnChatJoinRequest, tele.OnProximityAlert, tele.OnAutoDeleteTimer,
 		tele.OnWebApp, tele.OnVideoChatStarted, tele.OnVideoChatEnded,
 		tele.OnVideoChatParticipants, tele.OnVideoChatScheduled, tele.OnBoost,
@@ -125,16 +202,33 @@ func (b *Bot) registerAllUpdateHandlers() {
 func (b *Bot) setupMiddleware() {
 	logger := NewLogger("MIDDLEWARE")
 
+	// 403 при ответе пользователю: он заблокировал бота или удалил аккаунт
+	b.api.Use(func(next tele.HandlerFunc) tele.HandlerFunc {
+		return func(c tele.Context) error {
+			err := next(c)
+			if err != nil && c.Sender() != nil {
+				b.noteSendError(c.Sender().ID, err)
+			}
+			return err
+		}
+	})
+
 	b.api.Use(func(next tele.HandlerFunc) tele.HandlerFunc {
 		return func(c tele.Context) error {
 			update := c.Update()
 
+			// Поля запроса для всех записей лога, сделанных при обработке апдейта
+			ctx := newRequestContext(c)
+			c.Set(requestContextKey, ctx)
+
 			// Логируем обновления
-			logger.LogUpdate(&update)
+			logger.WithContext(ctx).LogUpdate(&update)
+			metrics.Updates.WithLabelValues(getUpdateType(&update)).Inc()
 
 			// Обрабатываем платежи прямо в middleware
 			if update.Message != nil && update.Message.Payment != nil {
-				logger.Info("Найден платеж в Message: %+v", update.Message.Payment)
+				// charge_id в лог попадает только маскированным через LogPayment в handlePayment
+				logger.Info("Найден платеж в Message: user_id=%d", update.Message.Sender.ID)
 				return b.handlePayment(c)
 			}
 
@@ -143,6 +237,7 @@ func (b *Bot) setupMiddleware() {
 				logger.Info("PreCheckoutQuery: user_id=%d", update.PreCheckoutQuery.Sender.ID)
 				if err := c.Accept(); err != nil {
 					logger.Error("Ошибка подтверждения PreCheckoutQuery: %v", err)
+					b.trackPaymentError(update.PreCheckoutQuery.Sender.ID, paymentStagePreCheckout)
 				} else {
 					logger.Info("PreCheckoutQuery подтвержден для user_id=%d", update.PreCheckoutQuery.Sender.ID)
 				}
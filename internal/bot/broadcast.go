@@ -0,0 +1,409 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"YoutubeDownloader/internal/i18n"
+	"YoutubeDownloader/internal/logging"
+	"YoutubeDownloader/internal/storage"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// Параметры рассылок
+const (
+	broadcastBatchSize     = 100              // сколько получателей читать из БД за раз
+	broadcastPollInterval  = 30 * time.Second // как часто проверять очередь без сигнала о новой рассылке
+	broadcastMaxButtons    = 8
+	broadcastListLimit     = 10
+	broadcastFloodAttempts = 5 // повторы отправки одному получателю после 429 Too Many Requests
+)
+
+// wakeBroadcasts будит обработчик рассылок после подтверждения новой
+func (b *Bot) wakeBroadcasts() {
+	select {
+	case b.broadcastWake <- struct{}{}:
+	default:
+	}
+}
+
+// parseBroadcastButtons разбирает кнопки вида "Текст | https://ссылка; Текст 2 | https://ссылка2"
+func parseBroadcastButtons(s string) ([]storage.BroadcastButton, bool) {
+	var buttons []storage.BroadcastButton
+	for _, part := range strings.Split(s, ";") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		text, link, ok := strings.Cut(part, "|")
+		text, link = strings.TrimSpace(text), strings.TrimSpace(link)
+		if !ok || text == "" {
+			return nil, false
+		}
+		u, err := url.Parse(link)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http" && u.Scheme != "tg") {
+			return nil, false
+		}
+		buttons = append(buttons, storage.BroadcastButton{Text: text, URL: link})
+	}
+	return buttons, len(buttons) <= broadcastMaxButtons
+}
+
+// broadcastMarkup кнопки-ссылки рассылки, по одной в ряд. nil — кнопок нет
+func broadcastMarkup(buttons []storage.BroadcastButton) *tele.ReplyMarkup {
+	if len(buttons) == 0 {
+		return nil
+	}
+	rows := make([][]tele.InlineButton, 0, len(buttons))
+	for _, btn := range buttons {
+		rows = append(rows, []tele.InlineButton{{Text: btn.Text, URL: btn.URL}})
+	}
+	return &tele.ReplyMarkup{InlineKeyboard: rows}
+}
+
+// copyBroadcast копирует сообщение рассылки получателю вместе с кнопками
+func (b *Bot) copyBroadcast(to tele.Recipient, bc *storage.Broadcast) error {
+	var opts []interface{}
+	if markup := broadcastMarkup(bc.Buttons); markup != nil {
+		opts = append(opts, markup)
+	}
+	_, err := b.api.Copy(to, tele.StoredMessage{MessageID: strconv.Itoa(bc.MessageID), ChatID: bc.FromChatID}, opts...)
+	return err
+}
+
+// handleBroadcastCommand управляет рассылками:
+// ответом на сообщение — /broadcast <сегмент> [Текст | ссылка; ...] — черновик и предпросмотр,
+// /broadcast list, /broadcast status <id>, /broadcast cancel <id>
+func (b *Bot) handleBroadcastCommand(c tele.Context) error {
+	args := commandArgs(c)
+	user := c.Sender()
+	action := strings.ToLower(args.String("segment"))
+
+	switch action {
+	case "":
+		return c.Send(b.i18nManager.T(user, "broadcast.usage"))
+	case "list":
+		return b.sendBroadcastList(c)
+	case "status", "cancel":
+		id, err := strconv.ParseInt(strings.TrimSpace(args.String("params")), 10, 64)
+		if err != nil {
+			return c.Send(b.i18nManager.T(user, "broadcast.usage"))
+		}
+		if action == "cancel" {
+			return b.cancelBroadcast(c, id)
+		}
+		return b.sendBroadcastStatus(c, id)
+	}
+
+	// Новая рассылка: команда отправляется ответом на сообщение-образец
+	source := c.Message().ReplyTo
+	if source == nil {
+		return c.Send(b.i18nManager.T(user, "broadcast.reply_required"))
+	}
+	segment, err := storage.ParseBroadcastSegment(action)
+	if err != nil || (segment.Kind == storage.SegmentLanguage && !b.i18nManager.HasLanguage(segment.Language)) {
+		return c.Send(b.i18nManager.T(user, "broadcast.invalid_segment", i18n.Args{"Segment": action}))
+	}
+	buttons, ok := parseBroadcastButtons(args.String("params"))
+	if !ok {
+		return c.Send(b.i18nManager.T(user, "broadcast.invalid_buttons", i18n.Args{"Max": broadcastMaxButtons}))
+	}
+
+	bc := &storage.Broadcast{
+		AdminID:    user.ID,
+		FromChatID: source.Chat.ID,
+		MessageID:  source.ID,
+		Buttons:    buttons,
+		Segment:    segment.String(),
+	}
+	bc.ID, err = storage.CreateBroadcast(b.db, bc)
+	if err != nil {
+		NewLogger("BROADCAST").Error("%v", err)
+		return c.Send(b.i18nManager.T(user, "broadcast.error"))
+	}
+	audience, err := storage.CountBroadcastAudience(b.db, segment, b.i18nManager.FallbackLanguage())
+	if err != nil {
+		NewLogger("BROADCAST").Error("%v", err)
+		return c.Send(b.i18nManager.T(user, "broadcast.error"))
+	}
+
+	// Предпросмотр — ровно то, что получат пользователи
+	if err := b.copyBroadcast(user, bc); err != nil {
+		return c.Send(b.i18nManager.T(user, "broadcast.preview_error", i18n.Args{"Error": logging.Redact(err.Error())}))
+	}
+
+	id := strconv.FormatInt(bc.ID, 10)
+	markup := &tele.ReplyMarkup{InlineKeyboard: [][]tele.InlineButton{{
+		{Text: b.i18nManager.T(user, "broadcast.button_send"), Data: CallbackBroadcast + "|send|" + id},
+		{Text: b.i18nManager.T(user, "broadcast.button_cancel"), Data: CallbackBroadcast + "|cancel|" + id},
+	}}}
+	return c.Send(b.i18nManager.T(user, "broadcast.preview", i18n.Args{
+		"ID":       bc.ID,
+		"Segment":  bc.Segment,
+		"Audience": audience,
+		"Buttons":  len(buttons),
+	}), markup)
+}
+
+// handleBroadcastCallback подтверждает или отменяет черновик после предпросмотра: send|<id>, cancel|<id>
+func (b *Bot) handleBroadcastCallback(c tele.Context, data string) error {
+	_ = c.Respond()
+	user := c.Sender()
+
+	action, idStr, _ := strings.Cut(data, "|")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil
+	}
+	if action == "cancel" {
+		return b.cancelBroadcast(c, id)
+	}
+
+	bc, err := storage.GetBroadcast(b.db, id)
+	if err != nil || bc == nil {
+		return c.EditOrSend(b.i18nManager.T(user, "broadcast.not_found", i18n.Args{"ID": id}))
+	}
+	segment, err := storage.ParseBroadcastSegment(bc.Segment)
+	if err != nil {
+		return c.EditOrSend(b.i18nManager.T(user, "broadcast.error"))
+	}
+
+	count, err := storage.QueueBroadcast(b.db, id, segment, b.i18nManager.FallbackLanguage())
+	if errors.Is(err, storage.ErrBroadcastState) {
+		return c.EditOrSend(b.i18nManager.T(user, "broadcast.already_handled", i18n.Args{"ID": id}))
+	}
+	if err != nil {
+		NewLogger("BROADCAST").Error("%v", err)
+		return c.EditOrSend(b.i18nManager.T(user, "broadcast.error"))
+	}
+
+	NewLogger("BROADCAST").Info("Админ %d запустил рассылку #%d (%s): %d получателей", user.ID, id, bc.Segment, count)
+	b.wakeBroadcasts()
+	return c.EditOrSend(b.i18nManager.T(user, "broadcast.queued", i18n.Args{"ID": id, "Count": count}))
+}
+
+// cancelBroadcast отменяет черновик или остановку идущей рассылки
+func (b *Bot) cancelBroadcast(c tele.Context, id int64) error {
+	user := c.Sender()
+	if err := storage.CancelBroadcast(b.db, id); err != nil {
+		if errors.Is(err, storage.ErrBroadcastState) {
+			return c.EditOrSend(b.i18nManager.T(user, "broadcast.already_handled", i18n.Args{"ID": id}))
+		}
+		NewLogger("BROADCAST").Error("%v", err)
+		return c.EditOrSend(b.i18nManager.T(user, "broadcast.error"))
+	}
+	NewLogger("BROADCAST").Info("Админ %d отменил рассылку #%d", user.ID, id)
+	return c.EditOrSend(b.i18nManager.T(user, "broadcast.cancelled", i18n.Args{"ID": id}))
+}
+
+// broadcastStatusText строка со статусом и счетчиками рассылки
+func (b *Bot) broadcastStatusText(user *tele.User, bc *storage.Broadcast) string {
+	return b.i18nManager.T(user, "broadcast.status", i18n.Args{
+		"ID":      bc.ID,
+		"Status":  b.i18nManager.T(user, "broadcast.statuses."+bc.Status),
+		"Segment": bc.Segment,
+		"Created": bc.CreatedAt.Format("2006-01-02 15:04"),
+		"Total":   bc.Total,
+		"Pending": bc.Pending,
+		"Sent":    bc.Sent,
+		"Failed":  bc.Failed,
+		"Blocked": bc.Blocked,
+		"Skipped": bc.Skipped,
+	})
+}
+
+// sendBroadcastStatus показывает ход рассылки
+func (b *Bot) sendBroadcastStatus(c tele.Context, id int64) error {
+	bc, err := storage.GetBroadcast(b.db, id)
+	if err != nil {
+		return c.Send(b.i18nManager.T(c.Sender(), "broadcast.error"))
+	}
+	if bc == nil {
+		return c.Send(b.i18nManager.T(c.Sender(), "broadcast.not_found", i18n.Args{"ID": id}))
+	}
+	return c.Send(b.broadcastStatusText(c.Sender(), bc))
+}
+
+// sendBroadcastList показывает последние рассылки
+func (b *Bot) sendBroadcastList(c tele.Context) error {
+	list, err := storage.GetRecentBroadcasts(b.db, broadcastListLimit)
+	if err != nil {
+		return c.Send(b.i18nManager.T(c.Sender(), "broadcast.error"))
+	}
+	if len(list) == 0 {
+		return c.Send(b.i18nManager.T(c.Sender(), "broadcast.list_empty"))
+	}
+	rows := make([]string, 0, len(list))
+	for i := range list {
+		rows = append(rows, b.broadcastStatusText(c.Sender(), &list[i]))
+	}
+	return c.Send(b.i18nManager.T(c.Sender(), "broadcast.list", i18n.Args{"Rows": strings.Join(rows, "\n\n")}))
+}
+
+// handleUnsubscribeNews отписывает пользователя от рассылок
+func (b *Bot) handleUnsubscribeNews(c tele.Context) error {
+	if err := storage.SetNewsOptOut(b.db, c.Sender().ID, true); err != nil {
+		NewLogger("BROADCAST").Error("%v", err)
+		return c.Send(b.i18nManager.T(c.Sender(), "broadcast.error"))
+	}
+	return c.Send(b.i18nManager.T(c.Sender(), "broadcast.unsubscribed"))
+}
+
+// handleSubscribeNews возвращает пользователя в рассылки
+func (b *Bot) handleSubscribeNews(c tele.Context) error {
+	if err := storage.SetNewsOptOut(b.db, c.Sender().ID, false); err != nil {
+		NewLogger("BROADCAST").Error("%v", err)
+		return c.Send(b.i18nManager.T(c.Sender(), "broadcast.error"))
+	}
+	return c.Send(b.i18nManager.T(c.Sender(), "broadcast.subscribed"))
+}
+
+// broadcastOwner идентификатор экземпляра бота для аренды рассылок
+func broadcastOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d:%d", host, os.Getpid(), time.Now().UnixNano())
+}
+
+// runBroadcasts отправляет подтвержденные рассылки по очереди, пока не отменен ctx.
+// Рассылка, прерванная остановкой бота, продолжается после запуска с неотправленных получателей.
+// Каждую рассылку экземпляр берет в аренду, поэтому несколько экземпляров не отправляют одну и ту же
+func (b *Bot) runBroadcasts(ctx context.Context) {
+	ticker := time.NewTicker(broadcastPollInterval)
+	defer ticker.Stop()
+	owner := broadcastOwner()
+
+	for {
+		for ctx.Err() == nil {
+			id, err := storage.StartNextBroadcast(b.db, owner)
+			if err != nil {
+				NewLogger("BROADCAST").Error("%v", err)
+				break
+			}
+			if id == 0 {
+				break
+			}
+			b.deliverBroadcast(ctx, id, owner)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-b.broadcastWake:
+		}
+	}
+}
+
+// deliverBroadcast отправляет рассылку оставшимся получателям не быстрее broadcast_rate
+// сообщений в секунду и по завершении присылает автору отчет. Аренда owner продлевается
+// между пачками и не реже трети BroadcastLeaseTTL во время отправки
+func (b *Bot) deliverBroadcast(ctx context.Context, id int64, owner string) {
+	logger := NewLogger("BROADCAST")
+	defer func() {
+		if err := storage.ReleaseBroadcastLease(b.db, id, owner); err != nil {
+			logger.Warning("Ошибка снятия аренды рассылки #%d: %v", id, err)
+		}
+	}()
+
+	// renew продлевает аренду; false — рассылку отменили или она ушла другому экземпляру
+	renewed := time.Now()
+	renew := func() bool {
+		ok, err := storage.RenewBroadcastLease(b.db, id, owner)
+		if err != nil {
+			logger.Error("%v", err)
+			return false
+		}
+		renewed = time.Now()
+		return ok
+	}
+
+	bc, err := storage.GetBroadcast(b.db, id)
+	if err != nil || bc == nil {
+		logger.Error("Рассылка #%d не загружена: %v", id, err)
+		return
+	}
+	logger.Info("Рассылка #%d: осталось %d из %d получателей", id, bc.Pending, bc.Total)
+
+	limiter := time.NewTicker(time.Second / time.Duration(b.config.BroadcastRate))
+	defer limiter.Stop()
+
+	for {
+		// Отмена через /broadcast cancel проверяется между пачками
+		if !renew() {
+			break
+		}
+		recipients, err := storage.GetPendingBroadcastRecipients(b.db, id, broadcastBatchSize)
+		if err != nil {
+			logger.Error("%v", err)
+			return
+		}
+		if len(recipients) == 0 {
+			if err := storage.FinishBroadcast(b.db, id, owner); err != nil {
+				logger.Error("Ошибка завершения рассылки #%d: %v", id, err)
+			}
+			break
+		}
+
+		for _, userID := range recipients {
+			select {
+			case <-ctx.Done():
+				return
+			case <-limiter.C:
+			}
+			if time.Since(renewed) > storage.BroadcastLeaseTTL/3 && !renew() {
+				break
+			}
+			status, errText := b.sendBroadcastTo(ctx, bc, userID)
+			if status == storage.RecipientPending {
+				return // остановка бота во время паузы после 429
+			}
+			if err := storage.SetBroadcastRecipientStatus(b.db, id, userID, status, errText); err != nil {
+				logger.Error("%v", err)
+			}
+		}
+	}
+
+	// Рассылку, аренду которой перехватил другой экземпляр, он и завершит с отчетом
+	if bc, err = storage.GetBroadcast(b.db, id); err != nil || bc == nil || bc.Status == storage.BroadcastRunning {
+		return
+	}
+	logger.Info("Рассылка #%d остановлена (%s): доставлено %d, ошибок %d, заблокировали %d, пропущено %d",
+		id, bc.Status, bc.Sent, bc.Failed, bc.Blocked, bc.Skipped)
+	admin := &tele.User{ID: bc.AdminID}
+	if _, err := b.api.Send(admin, b.broadcastStatusText(admin, bc)); err != nil {
+		logger.Error("Ошибка отправки отчета о рассылке #%d: %v", id, err)
+	}
+}
+
+// sendBroadcastTo отправляет рассылку одному получателю и возвращает его статус.
+// При 429 ждет указанное Telegram время и повторяет; заблокировавшие бота отмечаются в users.state
+func (b *Bot) sendBroadcastTo(ctx context.Context, bc *storage.Broadcast, userID int64) (status, errText string) {
+	for attempt := 1; ; attempt++ {
+		err := b.copyBroadcast(tele.ChatID(userID), bc)
+		if err == nil {
+			return storage.RecipientSent, ""
+		}
+
+		var flood tele.FloodError
+		if errors.As(err, &flood) && attempt < broadcastFloodAttempts {
+			NewLogger("BROADCAST").Warning("Рассылка #%d: лимит Telegram, пауза %d с", bc.ID, flood.RetryAfter)
+			select {
+			case <-ctx.Done():
+				return storage.RecipientPending, ""
+			case <-time.After(time.Duration(flood.RetryAfter+1) * time.Second):
+			}
+			continue
+		}
+
+		if b.noteSendError(userID, err) {
+			return storage.RecipientBlocked, err.Error()
+		}
+		return storage.RecipientFailed, logging.Redact(err.Error())
+	}
+}
@@ -0,0 +1,403 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"YoutubeDownloader/internal/i18n"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// ArgType тип аргумента команды
+type ArgType int
+
+const (
+	ArgString ArgType = iota
+	ArgInt
+	ArgInt64
+)
+
+// ArgSpec описание аргумента команды
+type ArgSpec struct {
+	Name     string
+	Type     ArgType
+	Optional bool
+	Rest     bool // забирает весь остаток строки (только последний аргумент)
+}
+
+// Command описание команды бота
+type Command struct {
+	Name           string // имя без слеша
+	DescriptionKey string // ключ перевода для меню Telegram и /help
+	Role           Role
+	Args           []ArgSpec
+	Handler        tele.HandlerFunc
+	Hidden         bool // не показывать в меню и /help (служебные и тестовые команды)
+}
+
+// CommandArgs разобранные аргументы команды
+type CommandArgs map[string]interface{}
+
+// commandArgsKey ключ, под которым аргументы кладутся в tele.Context
+const commandArgsKey = "command_args"
+
+// Has проверяет, передан ли аргумент
+func (a CommandArgs) Has(name string) bool {
+	_, ok := a[name]
+	return ok
+}
+
+// String возвращает строковый аргумент
+func (a CommandArgs) String(name string) string {
+	v, _ := a[name].(string)
+	return v
+}
+
+// Int возвращает целочисленный аргумент
+func (a CommandArgs) Int(name string) int {
+	v, _ := a[name].(int)
+	return v
+}
+
+// Int64 возвращает аргумент типа int64
+func (a CommandArgs) Int64(name string) int64 {
+	v, _ := a[name].(int64)
+	return v
+}
+
+// commandArgs возвращает аргументы текущей команды
+func commandArgs(c tele.Context) CommandArgs {
+	if args, ok := c.Get(commandArgsKey).(CommandArgs); ok {
+		return args
+	}
+	return CommandArgs{}
+}
+
+// argError ошибка разбора аргументов
+type argError struct {
+	key  string // ключ перевода
+	name string
+}
+
+func (e *argError) Error() string {
+	return fmt.Sprintf("%s: %s", e.key, e.name)
+}
+
+// Usage возвращает строку использования команды: /refund <charge_id> [user_id]
+func (cmd *Command) Usage() string {
+	var sb strings.Builder
+	sb.WriteString("/" + cmd.Name)
+	for _, arg := range cmd.Args {
+		if arg.Optional {
+			sb.WriteString(" [" + arg.Name + "]")
+		} else {
+			sb.WriteString(" <" + arg.Name + ">")
+		}
+	}
+	return sb.String()
+}
+
+// ParseArgs разбирает аргументы команды согласно спецификации
+func (cmd *Command) ParseArgs(text string) (CommandArgs, error) {
+	args := CommandArgs{}
+	fields := strings.Fields(text)
+
+	for i, spec := range cmd.Args {
+		if i >= len(fields) {
+			if spec.Optional {
+				continue
+			}
+			return nil, &argError{key: "command_args.missing", name: spec.Name}
+		}
+
+		raw := fields[i]
+		if spec.Rest {
+			raw = strings.Join(fields[i:], " ")
+		}
+
+		switch spec.Type {
+		case ArgInt:
+			v, err := strconv.Atoi(raw)
+			if err != nil {
+				return nil, &argError{key: "command_args.invalid_number", name: spec.Name}
+			}
+			args[spec.Name] = v
+		case ArgInt64:
+			v, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return nil, &argError{key: "command_args.invalid_number", name: spec.Name}
+			}
+			args[spec.Name] = v
+		default:
+			args[spec.Name] = raw
+		}
+
+		if spec.Rest {
+			return args, nil
+		}
+	}
+
+	if len(fields) > len(cmd.Args) {
+		return nil, &argError{key: "command_args.too_many"}
+	}
+	return args, nil
+}
+
+// CommandRegistry реестр команд бота
+type CommandRegistry struct {
+	commands map[string]*Command
+	order    []string
+}
+
+// NewCommandRegistry создает пустой реестр команд
+func NewCommandRegistry() *CommandRegistry {
+	return &CommandRegistry{commands: make(map[string]*Command)}
+}
+
+// Register добавляет команду в реестр. Имя можно передавать со слешем (константы Cmd*)
+func (r *CommandRegistry) Register(cmd Command) {
+	cmd.Name = strings.TrimPrefix(cmd.Name, "/")
+	if _, exists := r.commands[cmd.Name]; !exists {
+		r.order = append(r.order, cmd.Name)
+	}
+	r.commands[cmd.Name] = &cmd
+}
+
+// Lookup ищет команду по имени
+func (r *CommandRegistry) Lookup(name string) (*Command, bool) {
+	cmd, ok := r.commands[name]
+	return cmd, ok
+}
+
+// Visible возвращает команды, доступные роли и не скрытые из меню, в порядке регистрации
+func (r *CommandRegistry) Visible(role Role) []*Command {
+	var result []*Command
+	for _, name := range r.order {
+		cmd := r.commands[name]
+		if !cmd.Hidden && role.Includes(cmd.Role) {
+			result = append(result, cmd)
+		}
+	}
+	return result
+}
+
+// parseCommandText отделяет имя команды от аргументов: "/refund@bot abc 1" -> ("refund", "abc 1")
+func parseCommandText(text, botUsername string) (string, string, bool) {
+	if !strings.HasPrefix(text, "/") {
+		return "", "", false
+	}
+
+	head, rest, _ := strings.Cut(text[1:], " ")
+	name, mention, hasMention := strings.Cut(head, "@")
+	if hasMention && botUsername != "" && !strings.EqualFold(mention, botUsername) {
+		return "", "", false // команда адресована другому боту
+	}
+	if name == "" {
+		return "", "", false
+	}
+	return strings.ToLower(name), strings.TrimSpace(rest), true
+}
+
+// dispatchCommand находит команду в реестре, проверяет права и аргументы и вызывает обработчик.
+// Возвращает (обработана_ли_команда, ошибка)
+func (b *Bot) dispatchCommand(c tele.Context) (bool, error) {
+	var botUsername string
+	if b.api.Me != nil {
+		botUsername = b.api.Me.Username
+	}
+
+	name, rest, ok := parseCommandText(c.Text(), botUsername)
+	if !ok {
+		return false, nil
+	}
+	cmd, ok := b.commands.Lookup(name)
+	if !ok {
+		return false, nil
+	}
+
+	handler := func(c tele.Context) error {
+		args, err := cmd.ParseArgs(rest)
+		if err != nil {
+			return b.sendCommandUsage(c, cmd, err)
+		}
+		c.Set(commandArgsKey, args)
+		return cmd.Handler(c)
+	}
+
+	return true, b.requireRole(cmd.Role, handler)(c)
+}
+
+// sendCommandUsage сообщает об ошибке в аргументах и показывает, как вызывать команду
+func (b *Bot) sendCommandUsage(c tele.Context, cmd *Command, err error) error {
+	reason := ""
+	if argErr, ok := err.(*argError); ok {
+		reason = b.i18nManager.T(c.Sender(), argErr.key, i18n.Args{"Name": argErr.name})
+	}
+	return c.Send(b.i18nManager.T(c.Sender(), "command_usage", i18n.Args{"Reason": reason, "Usage": cmd.Usage()}))
+}
+
+// sendHelp формирует /help из реестра для роли пользователя
+func (b *Bot) sendHelp(c tele.Context) error {
+	role := b.roles.RoleOf(c.Sender().ID)
+
+	var list strings.Builder
+	for _, cmd := range b.commands.Visible(role) {
+		list.WriteString(b.i18nManager.T(c.Sender(), "help.row", i18n.Args{
+			"Usage":       cmd.Usage(),
+			"Description": b.i18nManager.T(c.Sender(), cmd.DescriptionKey),
+		}))
+		list.WriteString("\n")
+	}
+
+	key := "help.user"
+	if role != RoleUser {
+		key = "help.staff"
+	}
+	return c.Send(b.i18nManager.T(c.Sender(), key, i18n.Args{"Role": string(role), "List": list.String()}))
+}
+
+// telegramCommands формирует список команд для меню Telegram на указанном языке.
+// Пустой язык означает fallback
+func (b *Bot) telegramCommands(role Role, lang string) []tele.Command {
+	var result []tele.Command
+	for _, cmd := range b.commands.Visible(role) {
+		result = append(result, tele.Command{
+			Text:        cmd.Name,
+			Description: b.i18nManager.TL(lang, cmd.DescriptionKey),
+		})
+	}
+	return result
+}
+
+// publishCommands публикует меню команд в Telegram: общее для всех пользователей
+// на каждом языке и персональное для каждого сотрудника
+func (b *Bot) publishCommands() {
+	logger := NewLogger("COMMANDS")
+
+	defaultScope := tele.CommandScope{Type: tele.CommandScopeDefault}
+	if err := b.api.SetCommands(b.telegramCommands(RoleUser, ""), defaultScope); err != nil {
+		logger.Error("Ошибка публикации команд по умолчанию: %v", err)
+	}
+	for _, lang := range b.i18nManager.GetAvailableLanguages() {
+		if err := b.api.SetCommands(b.telegramCommands(RoleUser, lang), defaultScope, lang); err != nil {
+			logger.Error("Ошибка публикации команд для языка %s: %v", lang, err)
+		}
+	}
+
+	for userID := range b.roles.Staff() {
+		b.publishStaffCommands(userID)
+	}
+	if ownerID, err := strconv.ParseInt(b.config.AdminID, 10, 64); err == nil {
+		b.publishStaffCommands(ownerID)
+	}
+
+	logger.Info("Меню команд опубликовано")
+}
+
+// publishStaffCommands публикует меню команд в личном чате сотрудника согласно его роли.
+// Для пользователей без роли персональное меню удаляется
+func (b *Bot) publishStaffCommands(userID int64) {
+	logger := NewLogger("COMMANDS")
+
+	role := b.roles.RoleOf(userID)
+	scope := tele.CommandScope{Type: tele.CommandScopeChat, ChatID: userID}
+	langs := append([]string{""}, b.i18nManager.GetAvailableLanguages()...)
+
+	for _, lang := range langs {
+		var err error
+		if role == RoleUser {
+			err = b.api.DeleteCommands(scope, lang)
+		} else {
+			err = b.api.SetCommands(b.telegramCommands(role, lang), scope, lang)
+		}
+		if err != nil {
+			logger.Error("Ошибка публикации команд для пользователя %d (язык %q): %v", userID, lang, err)
+		}
+	}
+}
+
+// registerCommands регистрирует все команды бота. Порядок регистрации задает порядок в меню и /help
+func (b *Bot) registerCommands() {
+	r := NewCommandRegistry()
+
+	// Команды пользователей
+	r.Register(Command{Name: CmdStart, DescriptionKey: "commands.start", Role: RoleUser, Handler: b.handleStart,
+		Args: []ArgSpec{{Name: "payload", Optional: true, Rest: true}}})
+	r.Register(Command{Name: CmdHelp, DescriptionKey: "commands.help", Role: RoleUser, Handler: b.sendHelp})
+	r.Register(Command{Name: CmdHistory, DescriptionKey: "commands.history", Role: RoleUser, Handler: b.sendHistory})
+	r.Register(Command{Name: CmdStatus, DescriptionKey: "commands.status", Role: RoleUser, Handler: b.sendStatus})
+	r.Register(Command{Name: CmdMyDownloads, DescriptionKey: "commands.mydownloads", Role: RoleUser, Handler: b.sendMyDownloads})
+	r.Register(Command{Name: CmdPromo, DescriptionKey: "commands.promo", Role: RoleUser, Handler: b.handlePromoCommand,
+		Args: []ArgSpec{{Name: "code"}}})
+	r.Register(Command{Name: CmdReferral, DescriptionKey: "commands.referral", Role: RoleUser, Handler: b.sendReferral})
+	r.Register(Command{Name: CmdLanguage, DescriptionKey: "commands.language", Role: RoleUser, Handler: b.sendLanguageMenu})
+	r.Register(Command{Name: CmdUnsubscribeNews, DescriptionKey: "commands.unsubscribe_news", Role: RoleUser, Handler: b.handleUnsubscribeNews})
+	r.Register(Command{Name: CmdSubscribeNews, DescriptionKey: "commands.subscribe_news", Role: RoleUser, Handler: b.handleSubscribeNews})
+
+	// Статистика
+	r.Register(Command{Name: CmdStats, DescriptionKey: "commands.stats", Role: RoleStatsViewer, Handler: b.sendTotalStats})
+	r.Register(Command{Name: CmdUserStats, DescriptionKey: "commands.userstats", Role: RoleStatsViewer, Handler: b.sendUserStats})
+	r.Register(Command{Name: CmdWeeklyStats, DescriptionKey: "commands.weeklystats", Role: RoleStatsViewer, Handler: b.sendWeeklyStats})
+	r.Register(Command{Name: CmdAnalytics, DescriptionKey: "commands.analytics", Role: RoleStatsViewer, Handler: b.handleAnalyticsCommand,
+		Args: []ArgSpec{{Name: "days", Type: ArgInt, Optional: true}}})
+	r.Register(Command{Name: CmdRetention, DescriptionKey: "commands.retention", Role: RoleStatsViewer, Handler: b.handleRetentionCommand,
+		Args: []ArgSpec{{Name: "days", Type: ArgInt, Optional: true}}})
+	r.Register(Command{Name: CmdFunnel, DescriptionKey: "commands.funnel", Role: RoleStatsViewer, Handler: b.handleFunnelCommand,
+		Args: []ArgSpec{{Name: "days", Type: ArgInt, Optional: true}}})
+	r.Register(Command{Name: CmdDigest, DescriptionKey: "commands.digest", Role: RoleStatsViewer, Handler: b.handleDigestCommand,
+		Args: []ArgSpec{{Name: "period", Optional: true}}})
+	r.Register(Command{Name: CmdCacheStats, DescriptionKey: "commands.cache_stats", Role: RoleStatsViewer, Handler: b.sendCacheStats})
+	r.Register(Command{Name: CmdActiveDownloads, DescriptionKey: "commands.active_downloads", Role: RoleStatsViewer, Handler: b.sendActiveDownloads})
+
+	// Поддержка
+	r.Register(Command{Name: CmdAdmin, DescriptionKey: "commands.admin", Role: RoleSupport, Handler: b.handleAdminCommand,
+		Args: []ArgSpec{{Name: "filters", Optional: true, Rest: true}}})
+	r.Register(Command{Name: CmdRefund, DescriptionKey: "commands.refund", Role: RoleSupport, Handler: b.handleRefundCommand,
+		Args: []ArgSpec{{Name: "charge_id"}, {Name: "user_id", Type: ArgInt64, Optional: true}, {Name: "reason", Optional: true, Rest: true}}})
+	r.Register(Command{Name: CmdCredits, DescriptionKey: "commands.credits", Role: RoleSupport, Handler: b.handleCreditsCommand,
+		Args: []ArgSpec{{Name: "user_id", Type: ArgInt64}, {Name: "amount", Type: ArgInt}, {Name: "reason", Optional: true, Rest: true}}})
+	r.Register(Command{Name: CmdPromos, DescriptionKey: "commands.promos", Role: RoleAdmin, Handler: b.handlePromosCommand,
+		Args: []ArgSpec{{Name: "action", Optional: true}, {Name: "params", Optional: true, Rest: true}}})
+	r.Register(Command{Name: CmdSponsors, DescriptionKey: "commands.sponsors", Role: RoleAdmin, Handler: b.handleSponsorsCommand,
+		Args: []ArgSpec{{Name: "action", Optional: true}, {Name: "params", Optional: true, Rest: true}}})
+	r.Register(Command{Name: CmdPrices, DescriptionKey: "commands.prices", Role: RoleAdmin, Handler: b.handlePricesCommand,
+		Args: []ArgSpec{{Name: "action", Optional: true}, {Name: "params", Optional: true, Rest: true}}})
+	r.Register(Command{Name: CmdBroadcast, DescriptionKey: "commands.broadcast", Role: RoleAdmin, Handler: b.handleBroadcastCommand,
+		Args: []ArgSpec{{Name: "segment", Optional: true}, {Name: "params", Optional: true, Rest: true}}})
+	r.Register(Command{Name: CmdRevenue, DescriptionKey: "commands.revenue", Role: RoleAdmin, Handler: b.handleRevenueCommand,
+		Args: []ArgSpec{{Name: "period", Optional: true}}})
+	r.Register(Command{Name: CmdHealth, DescriptionKey: "commands.health", Role: RoleSupport, Handler: b.handleHealthCommand})
+	r.Register(Command{Name: CmdBotInfo, DescriptionKey: "commands.bot_info", Role: RoleSupport, Handler: b.sendBotInfo})
+	r.Register(Command{Name: CmdAPIInfo, DescriptionKey: "commands.api_info", Role: RoleSupport, Handler: b.sendAPIInfo})
+	r.Register(Command{Name: CmdTestSubscription, DescriptionKey: "commands.test_subscription", Role: RoleSupport, Handler: b.testSubscription})
+	r.Register(Command{Name: CmdTestChannel, DescriptionKey: "commands.test_channel", Role: RoleSupport, Handler: b.testChannel})
+
+	// Администрирование
+	r.Register(Command{Name: CmdCacheClear, DescriptionKey: "commands.cache_clear", Role: RoleAdmin, Handler: b.clearAllCache})
+	r.Register(Command{Name: CmdCacheClean, DescriptionKey: "commands.cache_clean", Role: RoleAdmin, Handler: b.handleCacheCleanCommand,
+		Args: []ArgSpec{{Name: "days", Type: ArgInt}}})
+	r.Register(Command{Name: CmdConfig, DescriptionKey: "commands.config", Role: RoleAdmin, Handler: b.showConfig})
+	r.Register(Command{Name: CmdFixChannel, DescriptionKey: "commands.fix_channel", Role: RoleAdmin, Handler: b.fixChannelConfig})
+	r.Register(Command{Name: CmdReloadI18n, DescriptionKey: "commands.reload_i18n", Role: RoleAdmin, Handler: b.reloadTranslations})
+	r.Register(Command{Name: CmdRoles, DescriptionKey: "commands.roles", Role: RoleAdmin, Handler: b.sendRolesList})
+	r.Register(Command{Name: CmdGrant, DescriptionKey: "commands.grant", Role: RoleAdmin, Handler: b.handleGrantCommand,
+		Args: []ArgSpec{{Name: "user_id", Type: ArgInt64}, {Name: "role"}}})
+	r.Register(Command{Name: CmdRevoke, DescriptionKey: "commands.revoke", Role: RoleAdmin, Handler: b.handleRevokeCommand,
+		Args: []ArgSpec{{Name: "user_id", Type: ArgInt64}}})
+
+	// Тестовые команды платежей: доступны админам, но не показываются в меню
+	r.Register(Command{Name: CmdTestInvoice, DescriptionKey: "commands.test_invoice", Role: RoleAdmin, Hidden: true, Handler: b.sendTestInvoice})
+	r.Register(Command{Name: CmdTestDirect, DescriptionKey: "commands.test_direct", Role: RoleAdmin, Hidden: true, Handler: b.sendDirectInvoice})
+	r.Register(Command{Name: CmdTestPreCheckout, DescriptionKey: "commands.test_precheckout", Role: RoleAdmin, Hidden: true, Handler: func(c tele.Context) error {
+		return c.Send(b.i18nManager.T(c.Sender(), "test_precheckout_instructions"))
+	}})
+
+	b.commands = r
+}
+
+// sendWelcome отправляет приветствие на /start
+func (b *Bot) sendWelcome(c tele.Context) error {
+	return c.Send(b.i18nManager.T(c.Sender(), "welcome"))
+}
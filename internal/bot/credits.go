@@ -0,0 +1,234 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"YoutubeDownloader/internal/i18n"
+	"YoutubeDownloader/internal/storage"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// creditChargePrefix префикс charge_id задач скачивания, оплаченных кредитом: "credit:<id записи списания>"
+const creditChargePrefix = "credit:"
+
+// PromoListLimit сколько промокодов показывает /promos
+const PromoListLimit = 20
+
+// downloadWithCredit списывает кредит и запускает скачивание.
+// Возвращает false, если кредитов нет и нужно предложить оплату
+func (b *Bot) downloadWithCredit(c tele.Context, url string) (bool, error) {
+	logger := NewLogger("CREDITS").WithContext(requestContext(c))
+	user := c.Sender()
+
+	spendID, err := storage.SpendCredit(b.db, user.ID, url)
+	if err != nil {
+		logger.Error("Ошибка списания кредита пользователя %d: %v", user.ID, err)
+		return false, nil
+	}
+	if spendID == 0 {
+		return false, nil
+	}
+
+	balance, err := storage.GetCreditBalance(b.db, user.ID)
+	if err != nil {
+		logger.Warning("Ошибка получения баланса пользователя %d: %v", user.ID, err)
+	}
+
+	logger.Info("Пользователь %d скачивает за кредит (запись %d, осталось %d)", user.ID, spendID, balance)
+	b.downloadManager.Go(func() { b.sendVideo(c, url, creditChargePrefix+strconv.FormatInt(spendID, 10), 0) })
+	return true, c.Send(b.i18nManager.T(user, "credits.spent", i18n.Args{"Balance": balance}))
+}
+
+// refundFailedCredit возвращает кредит, если скачивание, оплаченное им, не удалось
+func (b *Bot) refundFailedCredit(userID int64, chargeID string) {
+	idStr, ok := strings.CutPrefix(chargeID, creditChargePrefix)
+	if !ok {
+		return
+	}
+	spendID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return
+	}
+	if err := storage.RefundCredit(b.db, userID, spendID); err != nil {
+		NewLogger("CREDITS").Error("Не удалось вернуть кредит %d пользователю %d: %v", spendID, userID, err)
+	}
+}
+
+// handlePromoCommand активирует промокод: /promo <code>
+func (b *Bot) handlePromoCommand(c tele.Context) error {
+	logger := NewLogger("PROMO")
+	user := c.Sender()
+	code := storage.NormalizePromoCode(commandArgs(c).String("code"))
+
+	credits, balance, err := storage.RedeemPromoCode(b.db, code, user.ID)
+	switch {
+	case err == nil:
+		logger.Info("Пользователь %d активировал промокод %s (+%d)", user.ID, code, credits)
+		return c.Send(b.i18nManager.T(user, "promo.redeemed", i18n.Args{"Count": credits, "Balance": balance}))
+	case errors.Is(err, storage.ErrPromoNotFound):
+		return c.Send(b.i18nManager.T(user, "promo.not_found"))
+	case errors.Is(err, storage.ErrPromoExpired):
+		return c.Send(b.i18nManager.T(user, "promo.expired"))
+	case errors.Is(err, storage.ErrPromoExhausted):
+		return c.Send(b.i18nManager.T(user, "promo.exhausted"))
+	case errors.Is(err, storage.ErrPromoAlreadyUsed):
+		return c.Send(b.i18nManager.T(user, "promo.already_used"))
+	default:
+		logger.Error("Ошибка активации промокода %s пользователем %d: %v", code, user.ID, err)
+		return c.Send(b.i18nManager.T(user, "promo.error"))
+	}
+}
+
+// handleCreditsCommand начисляет или списывает кредиты: /credits <user_id> <количество> [причина]
+func (b *Bot) handleCreditsCommand(c tele.Context) error {
+	logger := NewLogger("CREDITS")
+	args := commandArgs(c)
+	userID, amount := args.Int64("user_id"), args.Int("amount")
+
+	if amount == 0 {
+		return c.Send(b.i18nManager.T(c.Sender(), "credits.invalid_amount"))
+	}
+
+	applied, balance, err := storage.AddCredits(b.db, userID, amount, storage.CreditGrant, args.String("reason"), c.Sender().ID)
+	if err != nil {
+		logger.Error("Ошибка начисления кредитов пользователю %d: %v", userID, err)
+		return c.Send(b.i18nManager.T(c.Sender(), "credits.error"))
+	}
+
+	logger.Info("Админ %d изменил баланс пользователя %d на %d (запрошено %d): %s",
+		c.Sender().ID, userID, applied, amount, args.String("reason"))
+	if amount < 0 {
+		// Списание ограничено текущим балансом, поэтому показываем фактически списанное
+		return c.Send(b.i18nManager.T(c.Sender(), "credits.revoked", i18n.Args{"UserID": userID, "Amount": -applied, "Balance": balance}))
+	}
+	return c.Send(b.i18nManager.T(c.Sender(), "credits.granted", i18n.Args{"UserID": userID, "Amount": applied, "Balance": balance}))
+}
+
+// handlePromosCommand управляет промокодами:
+// /promos — список, /promos create <CODE> <кредиты> [uses=N] [per_user=N] [days=N], /promos disable <CODE>
+func (b *Bot) handlePromosCommand(c tele.Context) error {
+	logger := NewLogger("PROMO")
+	args := commandArgs(c)
+	user := c.Sender()
+	fields := strings.Fields(args.String("params"))
+
+	switch strings.ToLower(args.String("action")) {
+	case "":
+		return b.sendPromoList(c)
+	case "create":
+		if len(fields) < 2 {
+			return c.Send(b.i18nManager.T(user, "promos.usage"))
+		}
+		promo, err := parsePromoCode(fields[0], fields[1], fields[2:])
+		if err != nil {
+			return c.Send(b.i18nManager.T(user, "promos.invalid", i18n.Args{"Error": err.Error()}))
+		}
+		promo.CreatedBy = user.ID
+		if err := storage.CreatePromoCode(b.db, promo); err != nil {
+			logger.Error("Ошибка создания промокода %s: %v", promo.Code, err)
+			return c.Send(b.i18nManager.T(user, "promos.error"))
+		}
+		logger.Info("Админ %d создал промокод %s на %d кредитов", user.ID, promo.Code, promo.Credits)
+		return c.Send(b.i18nManager.T(user, "promos.created", i18n.Args{"Code": storage.NormalizePromoCode(promo.Code)}))
+	case "disable":
+		if len(fields) != 1 {
+			return c.Send(b.i18nManager.T(user, "promos.usage"))
+		}
+		found, err := storage.DisablePromoCode(b.db, fields[0])
+		if err != nil {
+			logger.Error("Ошибка отключения промокода %s: %v", fields[0], err)
+			return c.Send(b.i18nManager.T(user, "promos.error"))
+		}
+		if !found {
+			return c.Send(b.i18nManager.T(user, "promo.not_found"))
+		}
+		logger.Info("Админ %d отключил промокод %s", user.ID, fields[0])
+		return c.Send(b.i18nManager.T(user, "promos.disabled", i18n.Args{"Code": storage.NormalizePromoCode(fields[0])}))
+	default:
+		return c.Send(b.i18nManager.T(user, "promos.usage"))
+	}
+}
+
+// sendPromoList показывает последние промокоды
+func (b *Bot) sendPromoList(c tele.Context) error {
+	user := c.Sender()
+
+	promos, err := storage.GetPromoCodes(b.db, PromoListLimit)
+	if err != nil {
+		NewLogger("PROMO").Error("Ошибка получения промокодов: %v", err)
+		return c.Send(b.i18nManager.T(user, "promos.error"))
+	}
+	if len(promos) == 0 {
+		return c.Send(strings.Join([]string{
+			b.i18nManager.T(user, "promos.empty"),
+			b.i18nManager.T(user, "promos.usage"),
+		}, "\n\n"))
+	}
+
+	lines := []string{b.i18nManager.T(user, "promos.header")}
+	for _, p := range promos {
+		uses := strconv.Itoa(p.Uses)
+		if p.MaxUses > 0 {
+			uses = fmt.Sprintf("%d/%d", p.Uses, p.MaxUses)
+		}
+		expires := b.i18nManager.T(user, "promos.no_expiry")
+		if p.ExpiresAt != nil {
+			expires = p.ExpiresAt.Format("2006-01-02")
+		}
+		key := "promos.row"
+		if p.Disabled {
+			key = "promos.row_disabled"
+		}
+		lines = append(lines, b.i18nManager.T(user, key, i18n.Args{
+			"Code":    p.Code,
+			"Credits": p.Credits,
+			"Uses":    uses,
+			"PerUser": p.PerUserLimit,
+			"Expires": expires,
+		}))
+	}
+	lines = append(lines, "", b.i18nManager.T(user, "promos.usage"))
+	return c.Send(strings.Join(lines, "\n"))
+}
+
+// parsePromoCode разбирает параметры нового промокода
+func parsePromoCode(code, creditsStr string, params []string) (*storage.PromoCode, error) {
+	credits, err := strconv.Atoi(creditsStr)
+	if err != nil || credits < 1 {
+		return nil, fmt.Errorf("количество кредитов должно быть положительным: %s", creditsStr)
+	}
+	if strings.TrimSpace(code) == "" {
+		return nil, fmt.Errorf("пустой промокод")
+	}
+
+	promo := &storage.PromoCode{Code: code, Credits: credits, PerUserLimit: 1}
+	for _, param := range params {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return nil, fmt.Errorf("ожидается key=value: %s", param)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("некорректное значение %s: %s", key, value)
+		}
+		switch strings.ToLower(key) {
+		case "uses":
+			promo.MaxUses = n
+		case "per_user":
+			promo.PerUserLimit = n
+		case "days":
+			if n > 0 {
+				expires := time.Now().AddDate(0, 0, n)
+				promo.ExpiresAt = &expires
+			}
+		default:
+			return nil, fmt.Errorf("неизвестный параметр %s", key)
+		}
+	}
+	return promo, nil
+}
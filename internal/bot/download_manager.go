@@ -1,23 +1,97 @@
 package bot
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"YoutubeDownloader/internal/logging"
 )
 
+// ErrShutdown причина отмены задач, не успевших завершиться при остановке бота
+var ErrShutdown = errors.New("скачивание прервано остановкой бота")
+
 // NewDownloadManager создает новый менеджер скачиваний
 func NewDownloadManager(maxWorkers int) *DownloadManager {
+	stopCtx, abort := context.WithCancelCause(context.Background())
 	return &DownloadManager{
 		limiter:         make(chan struct{}, maxWorkers),
 		mutexMap:        make(map[string]*sync.Mutex),
 		mutexMutex:      sync.RWMutex{},
 		activeDownloads: make(map[string]*DownloadInfo),
 		downloadMutex:   sync.RWMutex{},
+		stopCtx:         stopCtx,
+		abort:           abort,
+	}
+}
+
+// Go запускает задачу скачивания в отдельной горутине и учитывает ее до завершения,
+// чтобы Drain мог дождаться незавершенных задач при остановке
+func (dm *DownloadManager) Go(job func()) {
+	dm.jobsMutex.Lock()
+	if dm.jobs == 0 {
+		dm.idle = make(chan struct{})
+	}
+	dm.jobs++
+	dm.jobsMutex.Unlock()
+
+	go func() {
+		defer func() {
+			dm.jobsMutex.Lock()
+			dm.jobs--
+			if dm.jobs == 0 {
+				close(dm.idle)
+			}
+			dm.jobsMutex.Unlock()
+		}()
+		job()
+	}()
+}
+
+// Jobs возвращает количество незавершенных задач скачивания
+func (dm *DownloadManager) Jobs() int {
+	dm.jobsMutex.Lock()
+	defer dm.jobsMutex.Unlock()
+	return dm.jobs
+}
+
+// Drain ждет завершения всех задач не дольше timeout. Возвращает false, если задачи остались
+func (dm *DownloadManager) Drain(timeout time.Duration) bool {
+	dm.jobsMutex.Lock()
+	if dm.jobs == 0 {
+		dm.jobsMutex.Unlock()
+		return true
+	}
+	idle := dm.idle
+	dm.jobsMutex.Unlock()
+
+	select {
+	case <-idle:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// JobContext связывает контекст задачи с остановкой менеджера: после Abort задача
+// отменяется с причиной ErrShutdown, а yt-dlp завершается
+func (dm *DownloadManager) JobContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(dm.stopCtx, func() { cancel(ErrShutdown) })
+	return ctx, func() {
+		stop()
+		cancel(nil)
 	}
 }
 
+// Abort отменяет все незавершенные задачи
+func (dm *DownloadManager) Abort() {
+	dm.abort(ErrShutdown)
+}
+
 // GetURLMutex возвращает мьютекс для конкретного URL
 func (dm *DownloadManager) GetURLMutex(url string) *sync.Mutex {
 	dm.mutexMutex.RLock()
@@ -44,26 +118,27 @@ func (dm *DownloadManager) CleanupURLMutex(url string) {
 	dm.mutexMutex.Unlock()
 }
 
-// StartDownload регистрирует начало скачивания
-func (dm *DownloadManager) StartDownload(url, requestID string, userID int64) *DownloadInfo {
+// StartDownload регистрирует начало скачивания. request_id и user_id берутся из контекста запроса
+func (dm *DownloadManager) StartDownload(ctx context.Context, url string) *DownloadInfo {
 	dm.downloadMutex.Lock()
 	defer dm.downloadMutex.Unlock()
 
+	fields, _ := logging.FieldsFrom(ctx)
 	downloadInfo := &DownloadInfo{
-		RequestID: requestID,
-		UserID:    userID,
+		RequestID: fields.RequestID,
+		UserID:    fields.UserID,
 		StartTime: time.Now(),
 		Done:      make(chan struct{}),
 	}
 
 	dm.activeDownloads[url] = downloadInfo
-	log.Printf("[DOWNLOAD] [%s] Зарегистрировано активное скачивание для URL: %s", requestID, url)
+	logging.Component("DOWNLOAD").InfoContext(ctx, "Зарегистрировано активное скачивание", "url", url)
 
 	return downloadInfo
 }
 
 // FinishDownload регистрирует завершение скачивания
-func (dm *DownloadManager) FinishDownload(url string, err error) {
+func (dm *DownloadManager) FinishDownload(ctx context.Context, url string, err error) {
 	dm.downloadMutex.Lock()
 	defer dm.downloadMutex.Unlock()
 
@@ -71,12 +146,12 @@ func (dm *DownloadManager) FinishDownload(url string, err error) {
 		downloadInfo.Error = err
 		close(downloadInfo.Done)
 		delete(dm.activeDownloads, url)
-		log.Printf("[DOWNLOAD] [%s] Завершено скачивание для URL: %s (ошибка: %v)", downloadInfo.RequestID, url, err)
+		logging.Component("DOWNLOAD").InfoContext(ctx, "Завершено скачивание", "url", url, "error", err)
 	}
 }
 
-// WaitForDownload ждет завершения активного скачивания
-func (dm *DownloadManager) WaitForDownload(url string, timeout time.Duration) (*DownloadInfo, error) {
+// WaitForDownload ждет завершения активного скачивания не дольше timeout или до отмены ctx
+func (dm *DownloadManager) WaitForDownload(ctx context.Context, url string, timeout time.Duration) (*DownloadInfo, error) {
 	dm.downloadMutex.RLock()
 	downloadInfo, exists := dm.activeDownloads[url]
 	dm.downloadMutex.RUnlock()
@@ -85,11 +160,14 @@ func (dm *DownloadManager) WaitForDownload(url string, timeout time.Duration) (*
 		return nil, nil // Нет активного скачивания
 	}
 
-	log.Printf("[DOWNLOAD] Ожидание завершения скачивания URL: %s (начато пользователем %d)", url, downloadInfo.UserID)
+	logging.Component("DOWNLOAD").InfoContext(ctx, "Ожидание завершения скачивания",
+		"url", url, "owner_request_id", downloadInfo.RequestID, "owner_user_id", downloadInfo.UserID)
 
 	select {
 	case <-downloadInfo.Done:
 		return downloadInfo, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	case <-time.After(timeout):
 		return nil, fmt.Errorf("таймаут ожидания скачивания")
 	}
@@ -126,6 +204,32 @@ func (dm *DownloadManager) AcquireDownloadSlot() bool {
 	}
 }
 
+// WaitDownloadSlot ждет свободный слот не дольше timeout или до отмены ctx. Пока задача ждет,
+// она учитывается в длине очереди
+func (dm *DownloadManager) WaitDownloadSlot(ctx context.Context, timeout time.Duration) bool {
+	atomic.AddInt32(&dm.queued, 1)
+	defer atomic.AddInt32(&dm.queued, -1)
+
+	select {
+	case dm.limiter <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// QueueLength возвращает количество задач, ожидающих слот
+func (dm *DownloadManager) QueueLength() int {
+	return int(atomic.LoadInt32(&dm.queued))
+}
+
+// ActiveSlots возвращает количество занятых слотов скачивания
+func (dm *DownloadManager) ActiveSlots() int {
+	return len(dm.limiter)
+}
+
 // ReleaseDownloadSlot освобождает слот для скачивания
 func (dm *DownloadManager) ReleaseDownloadSlot() {
 	select {
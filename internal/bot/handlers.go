@@ -6,7 +6,10 @@ import (
 	"strconv"
 	"strings"
 
+	"YoutubeDownloader/internal/i18n"
+	"YoutubeDownloader/internal/metrics"
 	"YoutubeDownloader/internal/payment"
+	"YoutubeDownloader/internal/storage"
 	"database/sql"
 
 	tele "gopkg.in/telebot.v4"
@@ -15,117 +18,41 @@ import (
 // handleMessage обрабатывает текстовые сообщения
 func (b *Bot) handleMessage(c tele.Context) error {
 	msg := c.Message()
-	logger := NewLogger("MESSAGE")
+	logger := NewLogger("MESSAGE").WithContext(requestContext(c))
 
 	// --- СТАТИСТИКА ---
 	userID := msg.Sender.ID
-	_ = UpdateUserStats(b.db, userID)
+	if created, err := UpdateUserStats(b.db, userID); err == nil && created {
+		_ = IncrementTotalUsers(b.db)
+	}
 	_ = UpdateWeeklyUserActivity(b.db, userID)
-	_ = IncrementTotalUsersIfNew(b.db, userID)
 	_ = IncrementTotalMessages(b.db)
-	// --- КОНЕЦ СТАТИСТИКИ ---
-
-	// --- /help ---
-	if msg.Text == "/help" {
-		isAdmin := b.config.AdminID != "" && b.config.AdminID == toStr(msg.Sender.ID)
-		if isAdmin {
-			return c.Send(b.i18nManager.T(msg.Sender, "help_admin"))
-		} else {
-			return nil // обычному пользователю не отправлять ничего
-		}
+	if prev, err := storage.TouchUser(b.db, userID, b.i18nManager.ResolveLanguage(msg.Sender.LanguageCode)); err != nil {
+		logger.Warning("%v", err)
+	} else {
+		b.userStateChanged(userID, prev, storage.UserActive)
 	}
-	// --- END /help ---
+	b.trackEvent(storage.Event{UserID: userID, Type: storage.EventMessage})
+	// --- КОНЕЦ СТАТИСТИКИ ---
 
 	logger.Info("user_id=%d, text=%q", msg.Sender.ID, msg.Text)
 
-	// Обработка команды /start
-	if msg.Text == CmdStart {
-		return c.Send(b.i18nManager.T(msg.Sender, "welcome"))
-	}
-
-	// Проверяем, является ли пользователь админом
-	isAdmin := b.config.AdminID != "" && b.config.AdminID == toStr(msg.Sender.ID)
-
-	// Обработка админских команд
-	if isAdmin {
-		handled, err := b.handleAdminCommands(c, msg)
-		if err != nil {
-			return err
-		}
-		if handled {
-			return nil // Команда была обработана, не обрабатываем дальше
-		}
-	}
-
-	// Обработка обычных команд пользователей
-	handled, err := b.handleUserCommands(c, msg)
-	if err != nil {
-		return err
-	}
+	// Команды из реестра: права и аргументы проверяет dispatchCommand
+	handled, err := b.dispatchCommand(c)
 	if handled {
-		return nil // Команда была обработана, не обрабатываем дальше
+		return err
 	}
 
+	// Админам скачивание бесплатно
+	isAdmin := b.hasRole(msg.Sender, RoleAdmin)
+
 	// Обработка URL
 	return b.handleURLMessage(c, msg, isAdmin)
 }
 
-// handleAdminCommands обрабатывает админские команды
-// Возвращает (обработана_ли_команда, ошибка)
-func (b *Bot) handleAdminCommands(c tele.Context, msg *tele.Message) (bool, error) {
-	// Массив админских команд с их обработчиками
-	adminCommands := []struct {
-		command string
-		handler func(tele.Context) error
-	}{
-		{CmdTestInvoice, b.sendTestInvoice},
-		{CmdTestPreCheckout, func(c tele.Context) error {
-			return c.Send(b.i18nManager.T(msg.Sender, "test_precheckout_instructions"))
-		}},
-		{CmdBotInfo, b.sendBotInfo},
-		{CmdTestDirect, b.sendDirectInvoice},
-		{CmdAPIInfo, b.sendAPIInfo},
-		{CmdCacheStats, b.sendCacheStats},
-		{CmdCacheClear, b.clearAllCache},
-		{CmdActiveDownloads, b.sendActiveDownloads},
-		{CmdAdmin, b.sendAdminTransactionsMenu},
-		{"/test_subscription", b.testSubscription},
-		{"/test_channel", b.testChannel},
-		{"/config", b.showConfig},
-		{"/fix_channel", b.fixChannelConfig},
-		{"/stats", b.sendTotalStats},
-		{"/userstats", b.sendUserStats},
-		{"/weeklystats", b.sendWeeklyStats},
-	}
-
-	// Проверяем точные совпадения команд
-	for _, cmd := range adminCommands {
-		if msg.Text == cmd.command {
-			return true, cmd.handler(c)
-		}
-	}
-
-	// Обработка команд с параметрами
-	if strings.HasPrefix(msg.Text, CmdCacheClean) {
-		return true, b.handleCacheCleanCommand(c, msg.Text)
-	}
-	if strings.HasPrefix(msg.Text, CmdRefund) {
-		return true, b.handleRefundCommand(c, msg.Text)
-	}
-
-	return false, nil
-}
-
-// handleUserCommands обрабатывает команды пользователей
-// Возвращает (обработана_ли_команда, ошибка)
-func (b *Bot) handleUserCommands(c tele.Context, msg *tele.Message) (bool, error) {
-	// Здесь можно добавить обработку команд для обычных пользователей
-	return false, nil
-}
-
 // handleURLMessage обрабатывает сообщения с URL
 func (b *Bot) handleURLMessage(c tele.Context, msg *tele.Message, isAdmin bool) error {
-	logger := NewLogger("URL_HANDLER")
+	logger := NewLogger("URL_HANDLER").WithContext(requestContext(c))
 
 	// Проверяем, есть ли текст в сообщении
 	if strings.TrimSpace(msg.Text) == "" {
@@ -142,80 +69,74 @@ func (b *Bot) handleURLMessage(c tele.Context, msg *tele.Message, isAdmin bool)
 	}
 
 	logger.Info("Обрабатываем URL: %s для пользователя %d (админ: %t)", url, msg.Sender.ID, isAdmin)
+	b.trackEvent(storage.Event{UserID: msg.Sender.ID, Type: storage.EventLink})
 
 	if isAdmin {
 		logger.Info("Пользователь %d является админом — скачивание бесплатно", msg.Sender.ID)
-		go b.sendVideo(c, url, "", 0)
+		b.downloadManager.Go(func() { b.sendVideo(c, url, "", 0) })
 		return nil
 	}
 
-	// ВСЕГДА проверяем подписку для не-админов
-	logger.Info("Проверяем подписку для пользователя %d", msg.Sender.ID)
+	// Премиум-подписчикам скачивание бесплатно и без лимита
+	tier := b.userTier(msg.Sender.ID)
+	if tier.Tier == TierPremium {
+		logger.Info("Пользователь %d с премиум-подпиской — скачивание бесплатно", msg.Sender.ID)
+		b.downloadManager.Go(func() { b.sendVideo(c, url, "", 0) })
+		return nil
+	}
 
-	if b.config.ChannelUsername == "" {
-		logger.Warning("ChannelUsername не задан в конфиге! Подписка не может быть проверена, предлагаем оплату.")
-		return b.sendPaymentKeyboardWithSubscriptions(c, url)
+	// ВСЕГДА проверяем подписку для не-админов
+	if !b.sponsors.Enabled() {
+		logger.Warning("Каналы спонсоров не настроены! Подписка не может быть проверена, предлагаем оплату.")
+		return b.offerPayment(c, url)
 	}
 
-	logger.Info("Проверяем подписку пользователя %d на канал %s", msg.Sender.ID, b.config.ChannelUsername)
-	isSub, err := b.CheckUserSubscriptionRaw(b.config.ChannelUsername, msg.Sender.ID)
+	logger.Info("Проверяем подписку пользователя %d на каналы спонсоров", msg.Sender.ID)
+	status, err := b.sponsors.Check(msg.Sender.ID, false)
 	if err != nil {
-		logger.Warning("Ошибка проверки подписки пользователя %d на канал %s: %v", msg.Sender.ID, b.config.ChannelUsername, err)
+		logger.Warning("Ошибка проверки подписки пользователя %d: %v", msg.Sender.ID, err)
 		logger.Info("Из-за ошибки проверки подписки предлагаем оплату")
-		return b.sendPaymentKeyboardWithSubscriptions(c, url)
-	}
+		return b.offerPayment(c, url)
+	}
+
+	if status.Passed {
+		if b.dailyLimitReached(msg.Sender.ID, tier) {
+			logger.Info("Пользователь %d исчерпал дневной лимит бесплатных скачиваний", msg.Sender.ID)
+			if started, err := b.downloadWithCredit(c, url); started {
+				return err
+			}
+			if err := c.Send(b.i18nManager.T(msg.Sender, "limits.daily_exceeded", i18n.Args{"Limit": tier.DailyLimit})); err != nil {
+				return err
+			}
+			return b.sendPaymentKeyboardWithSubscriptions(c, url)
+		}
 
-	if isSub {
-		logger.Info("Пользователь %d подписан на канал %s — скачивание бесплатно", msg.Sender.ID, b.config.ChannelUsername)
-		go b.sendVideo(c, url, "", 0)
+		logger.Info("Пользователь %d подписан на каналы спонсоров — скачивание бесплатно", msg.Sender.ID)
+		b.downloadManager.Go(func() { b.sendVideo(c, url, "", 0) })
 		return nil
 	}
 
-	logger.Info("Пользователь %d НЕ подписан на канал %s — предлагаем оплату", msg.Sender.ID, b.config.ChannelUsername)
-	return b.sendPaymentKeyboardWithSubscriptions(c, url)
+	logger.Info("Пользователь %d НЕ подписан на каналы спонсоров (%d) — предлагаем оплату", msg.Sender.ID, len(status.Missing))
+	return b.offerPayment(c, url)
 }
 
-// handleCacheCleanCommand обрабатывает команду очистки кэша
-func (b *Bot) handleCacheCleanCommand(c tele.Context, text string) error {
-	parts := strings.Fields(text)
-	if len(parts) < 2 {
-		return c.Send(b.i18nManager.T(c.Sender(), "invalid_days_format"))
-	}
-
-	daysStr := strings.TrimSpace(parts[1])
-	days, err := strconv.Atoi(daysStr)
-	if err != nil {
-		return c.Send(b.i18nManager.T(c.Sender(), "invalid_days"))
+// offerPayment тратит кредит на скачивание, а если кредитов нет — показывает платежную клавиатуру
+func (b *Bot) offerPayment(c tele.Context, url string) error {
+	if started, err := b.downloadWithCredit(c, url); started {
+		return err
 	}
-
-	return b.cleanOldCache(c, days)
+	return b.sendPaymentKeyboardWithSubscriptions(c, url)
 }
 
-// handleRefundCommand обрабатывает команду возврата
-func (b *Bot) handleRefundCommand(c tele.Context, text string) error {
-	parts := strings.Fields(text)
-	if len(parts) < 2 {
-		return c.Send(b.i18nManager.T(c.Sender(), "invalid_charge_id"))
-	}
-
-	chargeID := strings.TrimSpace(parts[1])
-	var userID int64 = 0
-
-	if len(parts) >= 3 {
-		parsed, err := strconv.ParseInt(parts[2], 10, 64)
-		if err != nil {
-			return c.Send(b.i18nManager.T(c.Sender(), "invalid_user_id"))
-		}
-		userID = parsed
-	}
-
-	return b.handleAdminRefundWithUserID(c, chargeID, userID)
+// handleCacheCleanCommand обрабатывает команду очистки кэша: /cache_clean <days>
+func (b *Bot) handleCacheCleanCommand(c tele.Context) error {
+	return b.cleanOldCache(c, commandArgs(c).Int("days"))
 }
 
 // handleCallback обрабатывает callback запросы
 func (b *Bot) handleCallback(c tele.Context) error {
 	cb := c.Callback()
-	logger := NewLogger("CALLBACK")
+	logger := NewLogger("CALLBACK").WithContext(requestContext(c))
 
 	logger.Info("user_id=%d, data=%q", cb.Sender.ID, cb.Data)
 
@@ -241,15 +162,43 @@ func (b *Bot) handleCallback(c tele.Context) error {
 		return b.sendSubscribeInvoice(c, "forever")
 	}
 
+	// Выбор языка
+	if strings.HasPrefix(data, CallbackSetLanguage+"|") {
+		return b.handleSetLanguage(c, strings.TrimPrefix(data, CallbackSetLanguage+"|"))
+	}
+
+	// Повторная отправка видео из /history
+	if strings.HasPrefix(data, CallbackResend+"|") {
+		return b.handleResend(c, strings.TrimPrefix(data, CallbackResend+"|"))
+	}
+
 	// Обработка платежей за видео
+	if strings.HasPrefix(data, CallbackPayPlan+"|") {
+		return b.sendSubscribeInvoice(c, strings.TrimPrefix(data, CallbackPayPlan+"|"))
+	}
+
 	if strings.HasPrefix(data, CallbackPayVideo+"|") {
 		return b.handleVideoPaymentCallback(c, data)
 	}
 
-	// Обработка админских возвратов
-	if strings.HasPrefix(data, CallbackAdminRefund+"|") && b.config.AdminID != "" && b.config.AdminID == toStr(c.Sender().ID) {
+	// Подтверждение рассылки после предпросмотра
+	if strings.HasPrefix(data, CallbackBroadcast+"|") {
+		return b.requireRole(RoleAdmin, func(c tele.Context) error {
+			return b.handleBroadcastCallback(c, strings.TrimPrefix(data, CallbackBroadcast+"|"))
+		})(c)
+	}
+
+	// Браузер транзакций и возвраты
+	if strings.HasPrefix(data, CallbackAdminTrx+"|") {
+		return b.requireRole(RoleSupport, func(c tele.Context) error {
+			return b.handleAdminTrxCallback(c, strings.TrimPrefix(data, CallbackAdminTrx+"|"))
+		})(c)
+	}
+	if strings.HasPrefix(data, CallbackAdminRefund+"|") {
 		chargeID := strings.TrimPrefix(data, CallbackAdminRefund+"|")
-		return b.handleAdminRefund(c, chargeID)
+		return b.requireRole(RoleSupport, func(c tele.Context) error {
+			return b.handleLegacyRefundCallback(c, chargeID)
+		})(c)
 	}
 
 	return nil
@@ -273,7 +222,7 @@ func (b *Bot) handleVideoPaymentCallback(c tele.Context, data string) error {
 
 // handlePayment обрабатывает платежи
 func (b *Bot) handlePayment(c tele.Context) error {
-	logger := NewLogger("PAYMENT")
+	logger := NewLogger("PAYMENT").WithContext(requestContext(c))
 	logger.Debug("Вызван handlePayment")
 
 	// Пробуем получить платеж разными способами
@@ -292,53 +241,42 @@ func (b *Bot) handlePayment(c tele.Context) error {
 
 	if paymentInfo == nil {
 		logger.Debug("paymentInfo == nil, событие не обработано")
-		return c.Send("Ошибка: информация об оплате не получена")
+		return c.Send(b.i18nManager.T(c.Sender(), "payment_info_missing"))
 	}
 
 	userID := c.Sender().ID
 	payload := paymentInfo.Payload
 	amount := paymentInfo.Total
-	chargeID := paymentInfo.ProviderChargeID
+	chargeID := paymentInfo.TelegramChargeID
 
 	logger.LogPayment(userID, payload, chargeID, amount)
 
-	// Логируем все транзакции до обновления
-	trxs2, err2 := payment.GetAllTransactionsFromDB(b.db)
-	if err2 == nil {
-		logger.Debug("Все транзакции до обновления: %+v", trxs2)
-	} else {
-		logger.Debug("Ошибка получения всех транзакций: %v", err2)
-	}
-
 	// Обрабатываем платеж
 	return b.processPayment(c, paymentInfo)
 }
 
 // processPayment обрабатывает платеж
 func (b *Bot) processPayment(c tele.Context, paymentInfo *tele.Payment) error {
-	logger := NewLogger("PAYMENT")
+	logger := NewLogger("PAYMENT").WithContext(requestContext(c))
 
 	payload := paymentInfo.Payload
 	amount := paymentInfo.Total
-	chargeID := paymentInfo.ProviderChargeID
+	// Для Telegram Stars возврат делается по telegram_payment_charge_id; provider charge id пустой
+	chargeID := paymentInfo.TelegramChargeID
 
-	// Обновляем статус транзакции
-	err := UpdateTransactionStatus(b.db, chargeID, "success")
-	if err != nil {
-		logger.Error("Ошибка обновления статуса транзакции: %v", err)
-		return c.Send(b.i18nManager.T(c.Sender(), "error_processing_payment"))
-	}
-
-	// Логируем все транзакции после обновления
-	trxs3, err3 := payment.GetAllTransactionsFromDB(b.db)
-	if err3 == nil {
-		logger.Debug("Все транзакции после обновления: %+v", trxs3)
-	} else {
-		logger.Debug("Ошибка получения всех транзакций после обновления: %v", err3)
+	// Тип платежа — префикс payload: trx, video, subscribe
+	kind, _, _ := strings.Cut(payload, "|")
+	if kind != "trx" && kind != "video" && kind != "subscribe" {
+		kind = "unknown"
 	}
+	metrics.Payments.WithLabelValues(kind).Inc()
+	metrics.PaymentStars.WithLabelValues(kind).Add(float64(amount))
 
 	// Обрабатываем разные типы платежей
-	if strings.HasPrefix(payload, "video|") {
+	if strings.HasPrefix(payload, "trx|") {
+		return b.handleTransactionPayment(c, payload, chargeID, amount)
+
+	} else if strings.HasPrefix(payload, "video|") {
 		return b.handleVideoPayment(c, payload, chargeID, amount)
 
 	} else if strings.HasPrefix(payload, "subscribe|") {
@@ -349,79 +287,119 @@ func (b *Bot) processPayment(c tele.Context, paymentInfo *tele.Payment) error {
 	return c.Send(b.i18nManager.T(c.Sender(), "payment_processed"))
 }
 
-// handleVideoPayment обрабатывает платеж за видео
+// handleTransactionPayment обрабатывает оплату инвойса, выставленного по транзакции из БД
+func (b *Bot) handleTransactionPayment(c tele.Context, payload, chargeID string, amount int) error {
+	logger := NewLogger("PAYMENT").WithContext(requestContext(c))
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(payload, "trx|"), 10, 64)
+	if err != nil {
+		logger.Error("Некорректный payload платежа: %s", payload)
+		b.trackPaymentError(c.Sender().ID, paymentStageProcessing)
+		return c.Send(b.i18nManager.T(c.Sender(), "error_processing_payment"))
+	}
+
+	if err := payment.UpdateTransactionAfterPayment(b.db, id, chargeID, payment.StatusSuccess); err != nil {
+		logger.Error("Ошибка обновления транзакции %d после оплаты: %v", id, err)
+		b.trackPaymentError(c.Sender().ID, paymentStageProcessing)
+		return c.Send(b.i18nManager.T(c.Sender(), "error_processing_payment"))
+	}
+
+	trx, err := payment.GetTransactionByID(b.db, id)
+	if err != nil {
+		logger.Error("Ошибка получения транзакции %d: %v", id, err)
+		b.trackPaymentError(c.Sender().ID, paymentStageProcessing)
+		return c.Send(b.i18nManager.T(c.Sender(), "error_processing_payment"))
+	}
+
+	b.trackEvent(storage.Event{UserID: c.Sender().ID, Type: storage.EventPayment, Plan: trx.PricingRule, Amount: amount})
+	b.downloadManager.Go(func() { b.sendVideo(c, trx.URL, chargeID, amount) })
+	return c.Send(b.i18nManager.T(c.Sender(), "payment_accepted"))
+}
+
+// handleVideoPayment обрабатывает платеж за видео по инвойсам старого формата "video|<url>"
 func (b *Bot) handleVideoPayment(c tele.Context, payload, chargeID string, amount int) error {
 	url := strings.TrimPrefix(payload, "video|")
-	go b.sendVideo(c, url, chargeID, amount)
+	b.trackEvent(storage.Event{UserID: c.Sender().ID, Type: storage.EventPayment, Amount: amount})
+	b.downloadManager.Go(func() { b.sendVideo(c, url, chargeID, amount) })
 	return c.Send(b.i18nManager.T(c.Sender(), "payment_accepted"))
 }
 
 // handleSubscribePayment обрабатывает платеж за подписку
 func (b *Bot) handleSubscribePayment(c tele.Context, payload, chargeID string, amount int) error {
-	period := strings.TrimPrefix(payload, "subscribe|")
-	return c.Send(b.i18nManager.T(c.Sender(), "subscription_payment_accepted", period))
+	logger := NewLogger("SUBSCRIBE")
+
+	planID := strings.TrimPrefix(payload, "subscribe|")
+	plan, ok := b.subscriptionPlan(planID)
+	if !ok {
+		logger.Error("Оплачен неизвестный план подписки %s пользователем %d", planID, c.Sender().ID)
+		b.trackPaymentError(c.Sender().ID, paymentStageProcessing)
+		return c.Send(b.i18nManager.T(c.Sender(), "premium.activation_error"))
+	}
+
+	until, err := b.activatePremium(c, plan, payload, chargeID, amount)
+	if err != nil {
+		logger.Error("Ошибка активации подписки %s для пользователя %d: %v", planID, c.Sender().ID, err)
+		b.trackPaymentError(c.Sender().ID, paymentStageProcessing)
+		return c.Send(b.i18nManager.T(c.Sender(), "premium.activation_error"))
+	}
+	b.trackEvent(storage.Event{UserID: c.Sender().ID, Type: storage.EventPayment, Plan: "plan:" + plan.ID, Amount: amount})
+
+	return c.Send(strings.Join([]string{
+		b.i18nManager.T(c.Sender(), "subscription_payment_accepted", i18n.Args{"Name": b.planName(c.Sender(), plan)}),
+		b.i18nManager.T(c.Sender(), "premium.active", i18n.Args{"Until": until}),
+	}, "\n"))
 }
 
-// handleChannelSubscription обрабатывает нажатие кнопки подписки на канал
+// handleChannelSubscription обрабатывает нажатие кнопки подписки на каналы спонсоров
 func (b *Bot) handleChannelSubscription(c tele.Context) error {
 	logger := NewLogger("CHANNEL_SUB")
 
-	if b.config.ChannelUsername == "" {
-		logger.Warning("ChannelUsername не задан в конфиге")
+	if !b.sponsors.Enabled() {
+		logger.Warning("Каналы спонсоров не настроены")
 		return c.Send(b.i18nManager.T(c.Sender(), "channel_not_configured"))
 	}
 
-	// Убираем @ если есть
-	channelUsername := strings.TrimPrefix(b.config.ChannelUsername, "@")
-
-	// Создаем ссылку на канал
-	channelLink := fmt.Sprintf("https://t.me/%s", channelUsername)
-
-	message := b.i18nManager.T(c.Sender(), "subscribe_channel_message", channelLink)
-
-	// Создаем клавиатуру с кнопкой перехода на канал
-	markup := &tele.ReplyMarkup{InlineKeyboard: [][]tele.InlineButton{
-		{
-			{
-				Text: b.i18nManager.T(c.Sender(), "go_to_channel"),
-				URL:  channelLink,
-			},
-		},
-		{
-			{
-				Text: b.i18nManager.T(c.Sender(), "check_subscription"),
-				Data: "check_subscription",
-			},
-		},
-	}}
-
-	return c.Send(message, markup)
+	// Показываем только каналы, на которые пользователь еще не подписан
+	channels := b.sponsors.Channels()
+	if status, err := b.sponsors.Check(c.Sender().ID, false); err == nil && !status.Passed {
+		channels = status.Missing
+	}
+
+	b.waitForSponsors(c.Sender().ID)
+	return c.Send(b.sponsorMessage(c.Sender(), channels), b.sponsorKeyboard(c.Sender(), channels), tele.NoPreview)
 }
 
 // handleCheckSubscription обрабатывает проверку подписки пользователя
 func (b *Bot) handleCheckSubscription(c tele.Context) error {
 	logger := NewLogger("CHECK_SUB")
 
-	if b.config.ChannelUsername == "" {
-		logger.Warning("ChannelUsername не задан в конфиге")
+	if !b.sponsors.Enabled() {
+		logger.Warning("Каналы спонсоров не настроены")
 		return c.Send(b.i18nManager.T(c.Sender(), "channel_not_configured"))
 	}
 
-	logger.Info("Проверяем подписку пользователя %d на канал %s", c.Sender().ID, b.config.ChannelUsername)
+	logger.Info("Проверяем подписку пользователя %d на каналы спонсоров", c.Sender().ID)
 
-	isSub, err := b.CheckUserSubscriptionRaw(b.config.ChannelUsername, c.Sender().ID)
+	status, err := b.sponsors.Check(c.Sender().ID, true)
 	if err != nil {
 		logger.Warning("Ошибка проверки подписки: %v", err)
 		return c.Send(b.i18nManager.T(c.Sender(), "channel_not_configured"))
 	}
 
-	if isSub {
-		logger.Info("Пользователь %d подписан на канал %s", c.Sender().ID, b.config.ChannelUsername)
+	if status.Passed {
+		logger.Info("Пользователь %d подписан на каналы спонсоров", c.Sender().ID)
+		if _, err := storage.RemoveSponsorWaiter(b.db, c.Sender().ID); err != nil {
+			logger.Warning("Ошибка снятия ожидания подписки: %v", err)
+		}
 		return c.Send(b.i18nManager.T(c.Sender(), "subscribed_success"))
-	} else {
-		logger.Info("Пользователь %d НЕ подписан на канал %s", c.Sender().ID, b.config.ChannelUsername)
-		return c.Send(b.i18nManager.T(c.Sender(), "not_subscribed"))
 	}
+
+	logger.Info("Пользователь %d НЕ подписан на каналы спонсоров (%d)", c.Sender().ID, len(status.Missing))
+	b.waitForSponsors(c.Sender().ID)
+	return c.Send(strings.Join([]string{
+		b.i18nManager.T(c.Sender(), "not_subscribed"),
+		b.sponsorMessage(c.Sender(), status.Missing),
+	}, "\n\n"), b.sponsorKeyboard(c.Sender(), status.Missing), tele.NoPreview)
 }
 
 // fixChannelConfig помогает исправить конфигурацию канала
@@ -432,67 +410,60 @@ func (b *Bot) fixChannelConfig(c tele.Context) error {
 	logger.Info("Текущий канал в конфиге: %s", currentChannel)
 
 	if currentChannel == "" {
-		return c.Send("❌ CHANNEL_USERNAME не задан в конфиге!\n\nДобавьте в docker-compose.yml:\n``\n- CHANNEL_USERNAME=ваш_канал_без_собачки\n``")
+		return c.Send(b.i18nManager.T(c.Sender(), "channel_fix.not_set"))
 	}
 
 	// Убираем @ если есть
 	channelUsername := strings.TrimPrefix(currentChannel, "@")
 
-	message := fmt.Sprintf(`🔧 Диагностика канала:
-
-📋 Текущий канал: %s
-🔍 Ищем канал: %s
-
-❌ Ошибка: Канал не найден!
-
-💡 Возможные причины:
-1. Канал не существует
-2. Неправильное имя канала
-3. Бот не добавлен в канал
-4. Канал приватный
-
-🛠️ Для исправления:
-1. Создайте канал или используйте существующий
-2. Добавьте бота как администратора
-3. Укажите правильное имя канала в конфиге
-4. Перезапустите бота
-
-📝 Пример правильного конфига:
-CHANNEL_USERNAME=ваш_канал_без_собачки
-`, currentChannel, channelUsername)
+	message := b.i18nManager.T(c.Sender(), "channel_fix.diagnostics", i18n.Args{
+		"Channel":  currentChannel,
+		"Username": channelUsername,
+	})
 
 	return c.Send(message)
 }
 
 // sendTotalStats отправляет админу общую статистику
 func (b *Bot) sendTotalStats(c tele.Context) error {
-	row := b.db.QueryRow(`SELECT total_users, total_downloads, total_messages, updated_at FROM total_stats WHERE id = 1`)
-	var users, downloads, messages int64
+	row := b.db.QueryRow(`SELECT total_downloads, total_messages, updated_at FROM total_stats WHERE id = 1`)
+	var downloads, messages int64
 	var updatedAt string
-	err := row.Scan(&users, &downloads, &messages, &updatedAt)
+	err := row.Scan(&downloads, &messages, &updatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows || err.Error() == "sql: no rows in result set" {
-			return c.Send(b.i18nManager.T(c.Sender(), "stats_no_data"))
+			return c.Send(b.i18nManager.T(c.Sender(), "stats.no_data"))
 		}
-		return c.Send(b.i18nManager.T(c.Sender(), "stats_error", map[string]interface{}{"Error": err.Error()}))
+		return c.Send(b.i18nManager.T(c.Sender(), "stats.error", i18n.Args{"Error": err.Error()}))
 	}
-	msg := b.i18nManager.T(c.Sender(), "stats_total", map[string]interface{}{
-		"Users":     users,
-		"Downloads": downloads,
-		"Messages":  messages,
-		"UpdatedAt": updatedAt,
+	// Пользователи считаются по user_stats, как в /userstats и /weeklystats: заблокировавшие
+	// бота и удалившие аккаунт показываются отдельно
+	active, blocked, deactivated, err := storage.CountUsersByState(b.db)
+	if err != nil {
+		return c.Send(b.i18nManager.T(c.Sender(), "stats.error", i18n.Args{"Error": err.Error()}))
+	}
+	msg := b.i18nManager.T(c.Sender(), "stats.total", i18n.Args{
+		"Users":       active,
+		"Blocked":     blocked,
+		"Deactivated": deactivated,
+		"Downloads":   downloads,
+		"Messages":    messages,
+		"UpdatedAt":   updatedAt,
 	})
 	return c.Send(msg)
 }
 
-// sendUserStats отправляет админу топ-10 пользователей по сообщениям и скачиваниям
+// sendUserStats отправляет админу топ-10 активных пользователей по сообщениям и скачиваниям
 func (b *Bot) sendUserStats(c tele.Context) error {
-	rows, err := b.db.Query(`SELECT user_id, messages, downloads, last_active FROM user_stats ORDER BY messages DESC LIMIT 10`)
+	rows, err := b.db.Query(`SELECT s.user_id, s.messages, s.downloads, s.last_active FROM user_stats s
+		LEFT JOIN users u ON u.user_id = s.user_id
+		WHERE COALESCE(u.state, 'active') = 'active'
+		ORDER BY s.messages DESC LIMIT 10`)
 	if err != nil {
 		if err == sql.ErrNoRows || err.Error() == "sql: no rows in result set" {
-			return c.Send(b.i18nManager.T(c.Sender(), "stats_no_data"))
+			return c.Send(b.i18nManager.T(c.Sender(), "stats.no_data"))
 		}
-		return c.Send(b.i18nManager.T(c.Sender(), "stats_error", map[string]interface{}{"Error": err.Error()}))
+		return c.Send(b.i18nManager.T(c.Sender(), "stats.error", i18n.Args{"Error": err.Error()}))
 	}
 	defer rows.Close()
 	var list string
@@ -501,7 +472,7 @@ func (b *Bot) sendUserStats(c tele.Context) error {
 		var userID, messages, downloads int64
 		var lastActive string
 		_ = rows.Scan(&userID, &messages, &downloads, &lastActive)
-		list += b.i18nManager.T(c.Sender(), "stats_user_row", map[string]interface{}{
+		list += b.i18nManager.T(c.Sender(), "stats.user_row", i18n.Args{
 			"UserID":     userID,
 			"Messages":   messages,
 			"Downloads":  downloads,
@@ -510,24 +481,34 @@ func (b *Bot) sendUserStats(c tele.Context) error {
 		found = true
 	}
 	if !found {
-		return c.Send(b.i18nManager.T(c.Sender(), "stats_no_data"))
+		return c.Send(b.i18nManager.T(c.Sender(), "stats.no_data"))
+	}
+	msg := b.i18nManager.T(c.Sender(), "stats.user_top", i18n.Args{"List": list})
+
+	referrers, err := b.topReferrersText(c.Sender())
+	if err != nil {
+		NewLogger("STATS").Warning("Ошибка получения топа приглашений: %v", err)
+	}
+	if referrers != "" {
+		msg = strings.Join([]string{msg, referrers}, "\n\n")
 	}
-	msg := b.i18nManager.T(c.Sender(), "stats_user_top", map[string]interface{}{"List": list})
 	return c.Send(msg)
 }
 
-// sendWeeklyStats отправляет админу количество уникальных пользователей за последние 7 дней
+// sendWeeklyStats отправляет админу количество уникальных активных пользователей за последние 7 дней
 func (b *Bot) sendWeeklyStats(c tele.Context) error {
-	row := b.db.QueryRow(`SELECT COUNT(DISTINCT user_id) FROM weekly_user_activity WHERE activity_date >= CURRENT_DATE - INTERVAL '7 days'`)
+	row := b.db.QueryRow(`SELECT COUNT(DISTINCT a.user_id) FROM weekly_user_activity a
+		LEFT JOIN users u ON u.user_id = a.user_id
+		WHERE a.activity_date >= CURRENT_DATE - INTERVAL '7 days' AND COALESCE(u.state, 'active') = 'active'`)
 	var count int64
 	err := row.Scan(&count)
 	if err != nil {
 		if err == sql.ErrNoRows || err.Error() == "sql: no rows in result set" {
-			return c.Send(b.i18nManager.T(c.Sender(), "stats_no_data"))
+			return c.Send(b.i18nManager.T(c.Sender(), "stats.no_data"))
 		}
-		return c.Send(b.i18nManager.T(c.Sender(), "stats_error", map[string]interface{}{"Error": err.Error()}))
+		return c.Send(b.i18nManager.T(c.Sender(), "stats.error", i18n.Args{"Error": err.Error()}))
 	}
-	msg := b.i18nManager.T(c.Sender(), "stats_weekly", map[string]interface{}{"Count": count})
+	msg := b.i18nManager.T(c.Sender(), "stats.weekly", i18n.Args{"Count": count})
 	return c.Send(msg)
 }
 
@@ -0,0 +1,118 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"YoutubeDownloader/internal/downloader"
+	"YoutubeDownloader/internal/health"
+	"YoutubeDownloader/internal/i18n"
+	"YoutubeDownloader/internal/utils"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// newHealthChecker собирает проверки зависимостей для /readyz и /health
+func (b *Bot) newHealthChecker() *health.Checker {
+	return health.NewChecker(HealthCheckTimeout, HealthCacheTTL,
+		health.Check{Name: "database", Critical: true, Run: b.checkDatabase},
+		health.Check{Name: "telegram_api", Critical: true, Run: b.checkTelegramAPI},
+		health.Check{Name: "yt-dlp", Critical: true, Run: downloader.YtDlpVersion},
+		health.Check{Name: "ffmpeg", Run: downloader.FFmpegVersion},
+		health.Check{Name: "temp_dir", Critical: true, Run: b.checkTempDir},
+	)
+}
+
+// checkDatabase проверяет соединение с БД
+func (b *Bot) checkDatabase(ctx context.Context) (string, error) {
+	if err := b.db.PingContext(ctx); err != nil {
+		return "", err
+	}
+	stats := b.db.Stats()
+	return fmt.Sprintf("open=%d in_use=%d", stats.OpenConnections, stats.InUse), nil
+}
+
+// checkTelegramAPI проверяет доступность Bot API запросом getMe. Запрос строится
+// с ctx, поэтому таймаут проверки прерывает его, а не только перестает ждать ответ
+func (b *Bot) checkTelegramAPI(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.api.URL+"/bot"+b.api.Token+"/getMe", nil)
+	if err != nil {
+		// Текст ошибки содержит URL с токеном
+		return "", errors.New("некорректный адрес Bot API")
+	}
+	resp, err := b.apiClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return "", urlErr.Err
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("некорректный ответ getMe (HTTP %d): %v", resp.StatusCode, err)
+	}
+	if !result.OK {
+		return "", fmt.Errorf("getMe: %s", result.Description)
+	}
+	return b.config.TelegramAPIURL, nil
+}
+
+// checkTempDir проверяет запись во временную директорию и свободное место
+func (b *Bot) checkTempDir(ctx context.Context) (string, error) {
+	if err := os.MkdirAll(downloader.TempDir, 0755); err != nil {
+		return "", err
+	}
+	if err := utils.DiagnoseFileSystem(downloader.TempDir); err != nil {
+		return "", err
+	}
+
+	free, err := utils.FreeSpace(downloader.TempDir)
+	if err != nil {
+		return "свободное место неизвестно: " + err.Error(), nil
+	}
+	freeMB := int64(free / (1024 * 1024))
+	if freeMB < int64(b.config.HealthMinFreeMB) {
+		return "", fmt.Errorf("свободно %d МБ, нужно не меньше %d МБ", freeMB, b.config.HealthMinFreeMB)
+	}
+	return fmt.Sprintf("свободно %d МБ", freeMB), nil
+}
+
+// handleHealthCommand показывает отчет о зависимостях: /health
+func (b *Bot) handleHealthCommand(c tele.Context) error {
+	user := c.Sender()
+	report := b.health.Report(requestContext(c), true)
+
+	rows := make([]string, 0, len(report.Checks))
+	for _, r := range report.Checks {
+		icon, detail := "✅", r.Detail
+		if r.Status == health.StatusFail {
+			icon, detail = "❌", r.Error
+			if !r.Critical {
+				icon = "⚠️"
+			}
+		}
+		rows = append(rows, b.i18nManager.T(user, "health.row", i18n.Args{
+			"Icon":     icon,
+			"Name":     r.Name,
+			"Detail":   detail,
+			"Duration": int(r.DurationMS),
+		}))
+	}
+
+	return c.Send(b.i18nManager.T(user, "health.report", i18n.Args{
+		"Status": string(report.Status),
+		"Checks": strings.Join(rows, "\n"),
+	}), tele.NoPreview)
+}
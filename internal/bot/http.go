@@ -0,0 +1,38 @@
+package bot
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"YoutubeDownloader/internal/health"
+	"YoutubeDownloader/internal/metrics"
+)
+
+// startHTTPServer запускает служебный HTTP-сервер (метрики Prometheus, /healthz, /readyz) на HTTP_ADDR.
+// Он не зависит от способа получения апдейтов и работает и с long polling, и с вебхуком
+func (b *Bot) startHTTPServer() {
+	logger := NewLogger("HTTP")
+	if b.config.HTTPAddr == "" {
+		logger.Info("HTTP_ADDR не задан — служебный HTTP-сервер отключен")
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", health.LiveHandler(b.startedAt))
+	mux.Handle("/readyz", health.ReadyHandler(b.health))
+
+	b.httpServer = &http.Server{
+		Addr:              b.config.HTTPAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		logger.Info("Служебный HTTP-сервер слушает %s", b.config.HTTPAddr)
+		if err := b.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Ошибка служебного HTTP-сервера: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"strings"
+
+	"YoutubeDownloader/internal/i18n"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// sendLanguageMenu отправляет клавиатуру выбора языка
+func (b *Bot) sendLanguageMenu(c tele.Context) error {
+	var btns [][]tele.InlineButton
+	for _, lang := range b.i18nManager.GetAvailableLanguages() {
+		btns = append(btns, []tele.InlineButton{{
+			Text: b.i18nManager.TL(lang, "language_name"),
+			Data: CallbackSetLanguage + "|" + lang,
+		}})
+	}
+
+	markup := &tele.ReplyMarkup{InlineKeyboard: btns}
+	return c.Send(b.i18nManager.T(c.Sender(), "language_choose"), markup)
+}
+
+// handleSetLanguage сохраняет выбранный пользователем язык
+func (b *Bot) handleSetLanguage(c tele.Context, lang string) error {
+	logger := NewLogger("LANGUAGE")
+
+	if !b.i18nManager.HasLanguage(lang) {
+		return c.Send(b.i18nManager.T(c.Sender(), "language_unknown"))
+	}
+
+	if err := b.i18nManager.SetUserLanguage(c.Sender().ID, lang); err != nil {
+		logger.Error("Ошибка сохранения языка %s для пользователя %d: %v", lang, c.Sender().ID, err)
+		return c.Send(b.i18nManager.T(c.Sender(), "language_error"))
+	}
+
+	logger.Info("Пользователь %d выбрал язык %s", c.Sender().ID, lang)
+	_ = c.Respond()
+	return c.Send(b.i18nManager.TL(lang, "language_changed", i18n.Args{"Language": b.i18nManager.TL(lang, "language_name")}))
+}
+
+// reloadTranslations перезагружает переводы и сообщает, сколько ключей загружено
+func (b *Bot) reloadTranslations(c tele.Context) error {
+	logger := NewLogger("I18N")
+
+	counts, err := b.i18nManager.Reload(b.config.I18nOverrideDir)
+	if err != nil {
+		logger.Error("Ошибка перезагрузки переводов: %v", err)
+		return c.Send(b.i18nManager.T(c.Sender(), "i18n_reload_error", i18n.Args{"Error": err.Error()}))
+	}
+
+	var list strings.Builder
+	for _, lang := range b.i18nManager.GetAvailableLanguages() {
+		list.WriteString(b.i18nManager.T(c.Sender(), "i18n_reload_row", i18n.Args{"Lang": lang, "Count": counts[lang]}))
+		list.WriteString("\n")
+	}
+
+	logger.Info("Переводы перезагружены по команде администратора: %v", counts)
+	return c.Send(b.i18nManager.T(c.Sender(), "i18n_reloaded", i18n.Args{"List": list.String()}))
+}
@@ -1,41 +1,85 @@
 package bot
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
+	"YoutubeDownloader/internal/config"
+	"YoutubeDownloader/internal/logging"
+
 	tele "gopkg.in/telebot.v4"
 )
 
-// Logger предоставляет структурированное логирование
+// requestContextKey ключ tele.Context, под которым middleware сохраняет контекст запроса
+const requestContextKey = "request_ctx"
+
+// newRequestContext создает контекст запроса с новым request_id и отправителем апдейта
+func newRequestContext(c tele.Context) context.Context {
+	fields := logging.Fields{RequestID: GenerateRequestID()}
+	if sender := c.Sender(); sender != nil {
+		fields.UserID = sender.ID
+	}
+	if chat := c.Chat(); chat != nil {
+		fields.ChatID = chat.ID
+	}
+	return logging.WithFields(context.Background(), fields)
+}
+
+// requestContext возвращает контекст запроса, созданный middleware. Для вызовов вне
+// обработки апдейта создается новый
+func requestContext(c tele.Context) context.Context {
+	if ctx, ok := c.Get(requestContextKey).(context.Context); ok {
+		return ctx
+	}
+	return newRequestContext(c)
+}
+
+// Logger пишет в slog с полем component. Уровень и формат задаются в logging.Setup,
+// поля запроса берутся из контекста (см. WithContext)
 type Logger struct {
 	prefix string
+	ctx    context.Context
 }
 
 // NewLogger создает новый логгер с префиксом
 func NewLogger(prefix string) *Logger {
-	return &Logger{prefix: prefix}
+	return &Logger{prefix: prefix, ctx: context.Background()}
+}
+
+// WithContext возвращает логгер, добавляющий к записям request_id, user_id и chat_id из ctx
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	return &Logger{prefix: l.prefix, ctx: ctx}
+}
+
+// log форматирует сообщение, только если уровень включен
+func (l *Logger) log(level slog.Level, format string, args ...interface{}) {
+	logger := slog.Default()
+	if !logger.Enabled(l.ctx, level) {
+		return
+	}
+	logger.Log(l.ctx, level, fmt.Sprintf(format, args...), "component", l.prefix)
 }
 
 // Info логирует информационное сообщение
 func (l *Logger) Info(format string, args ...interface{}) {
-	log.Printf("[%s] %s", l.prefix, fmt.Sprintf(format, args...))
+	l.log(slog.LevelInfo, format, args...)
 }
 
 // Error логирует ошибку
 func (l *Logger) Error(format string, args ...interface{}) {
-	log.Printf("[%s] ERROR: %s", l.prefix, fmt.Sprintf(format, args...))
+	l.log(slog.LevelError, format, args...)
 }
 
 // Debug логирует отладочное сообщение
 func (l *Logger) Debug(format string, args ...interface{}) {
-	log.Printf("[%s] DEBUG: %s", l.prefix, fmt.Sprintf(format, args...))
+	l.log(slog.LevelDebug, format, args...)
 }
 
 // Warning логирует предупреждение
 func (l *Logger) Warning(format string, args ...interface{}) {
-	log.Printf("[%s] WARNING: %s", l.prefix, fmt.Sprintf(format, args...))
+	l.log(slog.LevelWarn, format, args...)
 }
 
 // LogUpdate логирует обновление Telegram
@@ -50,9 +94,9 @@ func (l *Logger) LogUpdate(update *tele.Update) {
 	}
 }
 
-// LogPayment логирует информацию о платеже
+// LogPayment логирует информацию о платеже; charge_id маскируется
 func (l *Logger) LogPayment(userID int64, payload, chargeID string, amount int) {
-	l.Info("Payment: user_id=%d, payload=%s, amount=%d, charge_id=%s", userID, payload, amount, chargeID)
+	l.Info("Payment: user_id=%d, payload=%s, amount=%d, charge_id=%s", userID, payload, amount, logging.Mask(chargeID))
 }
 
 // LogDownload логирует информацию о скачивании
@@ -76,7 +120,7 @@ func (l *Logger) LogPerformance(operation string, startTime time.Time) {
 }
 
 // LogConfig логирует конфигурацию
-func (l *Logger) LogConfig(config *BotConfig) {
-	l.Info("Bot configuration: max_workers=%d, use_official_api=%t, api_url=%s",
-		config.MaxWorkers, config.UseOfficialAPI, config.TelegramAPIURL)
+func (l *Logger) LogConfig(cfg *config.Config) {
+	l.Info("Bot configuration: max_workers=%d, use_official_api=%t, api_url=%s, log_level=%s, log_format=%s",
+		cfg.MaxWorkers, cfg.UseOfficialAPI, cfg.TelegramAPIURL, cfg.LogLevel, cfg.LogFormat)
 }
@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"time"
+
+	"YoutubeDownloader/internal/storage"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// SponsorWaitTTL сколько ждать подписки пользователя, которому показали список каналов,
+// чтобы уведомить его о разблокировке бесплатных скачиваний
+const SponsorWaitTTL = 7 * 24 * time.Hour
+
+// handleChatMember обрабатывает подписку и отписку в каналах спонсоров.
+// Апдейты приходят только из каналов, где бот администратор
+func (b *Bot) handleChatMember(c tele.Context) error {
+	logger := NewLogger("MEMBERSHIP")
+	upd := c.ChatMember()
+	if upd == nil || upd.NewChatMember == nil || upd.NewChatMember.User == nil {
+		return nil
+	}
+
+	ch, ok := b.sponsors.Match(upd.Chat)
+	if !ok {
+		logger.Debug("chat_member из чата %d не относится к каналам спонсоров", upd.Chat.ID)
+		return nil
+	}
+
+	// Апдейт пришел — значит бот администратор, даже если при загрузке это не удалось проверить
+	b.sponsors.SetTracked(ch.Channel, true)
+
+	user := upd.NewChatMember.User
+	member := isChannelMember(upd.NewChatMember)
+	wasMember := upd.OldChatMember != nil && isChannelMember(upd.OldChatMember)
+	if member == wasMember {
+		return nil
+	}
+
+	b.sponsors.Record(ch.Channel, user.ID, member)
+	if !member {
+		logger.Info("Пользователь %d отписался от %s", user.ID, ch.Channel)
+		return nil
+	}
+
+	logger.Info("Пользователь %d подписался на %s", user.ID, ch.Channel)
+	b.notifySponsorWaiter(user)
+	return nil
+}
+
+// handleMyChatMember отслеживает блокировку бота пользователями и права бота в каналах
+// спонсоров: без прав администратора chat_member апдейты не приходят и подписки снова
+// проверяются запросами к Telegram
+func (b *Bot) handleMyChatMember(c tele.Context) error {
+	logger := NewLogger("MEMBERSHIP")
+	upd := c.ChatMember()
+	if upd == nil || upd.NewChatMember == nil {
+		return nil
+	}
+
+	if upd.Chat != nil && upd.Chat.Type == tele.ChatPrivate {
+		b.handlePrivateChatMember(upd)
+		return nil
+	}
+
+	ch, ok := b.sponsors.Match(upd.Chat)
+	if !ok {
+		update := c.Update()
+		logger.Info("Получен апдейт типа %s из чата %d", getUpdateType(&update), upd.Chat.ID)
+		return nil
+	}
+
+	role := upd.NewChatMember.Role
+	admin := role == tele.Administrator || role == tele.Creator
+	b.sponsors.SetTracked(ch.Channel, admin)
+	if admin {
+		logger.Info("Бот стал администратором в %s — подписки отслеживаются по апдейтам", ch.Channel)
+	} else {
+		logger.Warning("Бот больше не администратор в %s (%s) — подписки проверяются запросами к Telegram", ch.Channel, role)
+	}
+	return nil
+}
+
+// waitForSponsors запоминает, что пользователю показали список каналов: после подписки
+// он получит уведомление о бесплатных скачиваниях
+func (b *Bot) waitForSponsors(userID int64) {
+	if err := storage.AddSponsorWaiter(b.db, userID, SponsorWaitTTL); err != nil {
+		NewLogger("MEMBERSHIP").Warning("Ошибка сохранения ожидания подписки %d: %v", userID, err)
+	}
+}
+
+// notifySponsorWaiter сообщает ожидавшему пользователю, что бесплатные скачивания открыты,
+// если после подписки выполнены все условия
+func (b *Bot) notifySponsorWaiter(user *tele.User) {
+	logger := NewLogger("MEMBERSHIP")
+
+	waiting, err := storage.IsSponsorWaiter(b.db, user.ID, SponsorWaitTTL)
+	if err != nil {
+		logger.Warning("Ошибка проверки ожидания подписки %d: %v", user.ID, err)
+		return
+	}
+	if !waiting {
+		return
+	}
+
+	status, err := b.sponsors.Check(user.ID, false)
+	if err != nil {
+		logger.Warning("Ошибка проверки подписки пользователя %d: %v", user.ID, err)
+		return
+	}
+	if !status.Passed {
+		logger.Info("Пользователь %d подписан еще не на все каналы (%d)", user.ID, len(status.Missing))
+		return
+	}
+
+	// Удаление — признак того, что уведомление еще не отправлено параллельным апдейтом
+	removed, err := storage.RemoveSponsorWaiter(b.db, user.ID)
+	if err != nil || !removed {
+		return
+	}
+
+	if _, err := b.api.Send(user, b.i18nManager.T(user, "sponsors.unlocked")); err != nil {
+		b.noteSendError(user.ID, err)
+		logger.Warning("Не удалось уведомить пользователя %d о подписке: %v", user.ID, err)
+		return
+	}
+	logger.Info("Пользователь %d уведомлен о разблокировке бесплатных скачиваний", user.ID)
+}
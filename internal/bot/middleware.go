@@ -16,57 +16,13 @@ type updateTypeChecker struct {
 	updateType string
 }
 
-// setupMiddlewareLegacy настраивает middleware для бота (legacy версия)
-func (b *Bot) setupMiddlewareLegacy() {
-	logger := NewLogger("MIDDLEWARE")
-
-	b.api.Use(func(next tele.HandlerFunc) tele.HandlerFunc {
-		return func(c tele.Context) error {
-			update := c.Update()
-
-			// Логируем обновления
-			logger.LogUpdate(&update)
-
-			// Обрабатываем платежи прямо в middleware
-			if update.Message != nil && update.Message.Payment != nil {
-				logger.Info("Найден платеж в Message: %+v", update.Message.Payment)
-				return b.handlePayment(c)
-			}
-
-			// Автоматически подтверждаем PreCheckoutQuery
-			if update.PreCheckoutQuery != nil {
-				logger.Info("PreCheckoutQuery: user_id=%d", update.PreCheckoutQuery.Sender.ID)
-				if err := c.Accept(); err != nil {
-					logger.Error("Ошибка подтверждения PreCheckoutQuery: %v", err)
-				} else {
-					logger.Info("PreCheckoutQuery подтвержден для user_id=%d", update.PreCheckoutQuery.Sender.ID)
-				}
-				return nil // Не передаем дальше
-			}
-
-			return next(c)
-		}
-	})
-
-	logger.Info("Middleware настроен")
-}
-
-// handleAnyUpdateLegacy обработчик для всех типов апдейтов
-func (b *Bot) handleAnyUpdateLegacy(c tele.Context) error {
-	logger := NewLogger("LEGACY_HANDLER")
-
-	// Логируем необработанные апдейты для отладки
-	update := c.Update()
-	logger.Info("Получен необработанный апдейт типа: %s", getUpdateType(&update))
-
-	// Можно добавить обработку специфических типов апдейтов здесь
-	// Например, логирование, статистика, уведомления и т.д.
-
-	return nil
-}
-
 // Определение типа сообщения через красивый массив
 func getMessageType(msg *tele.Message) string {
+	// getUpdateType вычисляет тип сообщения для любого апдейта, в том числе без сообщения
+	if msg == nil {
+		return "none"
+	}
+
 	checkers := []messageTypeChecker{
 		{func(m *tele.Message) bool { return m.Text != "" }, "text"},
 		{func(m *tele.Message) bool { return m.Photo != nil }, "photo"},
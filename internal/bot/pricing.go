@@ -0,0 +1,296 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"YoutubeDownloader/internal/downloader"
+	"YoutubeDownloader/internal/i18n"
+	"YoutubeDownloader/internal/pricing"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// foreverPremium срок, на который продлевается бессрочная подписка
+const foreverPremium = 100 * 365 * 24 * time.Hour
+
+// quoteVideo рассчитывает цену разового скачивания. Метаданные видео запрашиваются
+// только если правила от них зависят; при ошибке применяются правила без них
+func (b *Bot) quoteVideo(url string) pricing.Quote {
+	table := b.pricing.Table()
+	media := pricing.Media{Type: pricing.DetectMediaType(url)}
+
+	if table.NeedsProbe() {
+		meta, err := downloader.ProbeVideo(url, PriceProbeTimeout)
+		if err != nil {
+			NewLogger("PRICING").Warning("Не удалось получить метаданные %s: %v", url, err)
+		} else {
+			media.Duration = time.Duration(meta.Duration * float64(time.Second))
+			media.Size = meta.Size()
+			media.Height = meta.Height
+		}
+	}
+
+	return table.PriceFor(media)
+}
+
+// subscriptionPlan ищет план подписки. Планы по умолчанию остаются доступны для
+// инвойсов, выставленных до их удаления из таблицы цен
+func (b *Bot) subscriptionPlan(id string) (pricing.Plan, bool) {
+	if plan, ok := b.pricing.Table().Plan(id); ok {
+		return plan, true
+	}
+	return pricing.Default().Plan(id)
+}
+
+// planDuration возвращает срок, на который план продлевает подписку
+func planDuration(plan pricing.Plan) time.Duration {
+	if plan.Duration == 0 {
+		return foreverPremium
+	}
+	return time.Duration(plan.Duration)
+}
+
+// planName возвращает локализованное название плана: для стандартных планов
+// есть готовые переводы, остальные называются по длительности
+func (b *Bot) planName(user *tele.User, plan pricing.Plan) string {
+	key := "subscription_" + plan.ID
+	if b.i18nManager.HasKey("ru", key) {
+		return b.i18nManager.T(user, key)
+	}
+	if plan.Duration == 0 {
+		return b.i18nManager.T(user, "subscription_forever")
+	}
+	days := int(time.Duration(plan.Duration).Hours() / 24)
+	return b.i18nManager.T(user, "pricing.plan_days", i18n.Args{"Count": days})
+}
+
+// handlePricesCommand показывает и изменяет таблицу цен:
+// /prices [default|rule|delrule|plan|delplan|reset] ...
+func (b *Bot) handlePricesCommand(c tele.Context) error {
+	logger := NewLogger("PRICING")
+	args := commandArgs(c)
+	user := c.Sender()
+
+	if !args.Has("action") {
+		return b.sendPrices(c)
+	}
+
+	fields := strings.Fields(args.String("params"))
+	var change func(t *pricing.Table) error
+
+	switch action := strings.ToLower(args.String("action")); action {
+	case "default":
+		if len(fields) != 1 {
+			return c.Send(b.i18nManager.T(user, "prices.usage"))
+		}
+		price, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return c.Send(b.i18nManager.T(user, "prices.usage"))
+		}
+		change = func(t *pricing.Table) error {
+			t.DefaultPrice = price
+			return nil
+		}
+	case "rule":
+		if len(fields) < 2 {
+			return c.Send(b.i18nManager.T(user, "prices.usage"))
+		}
+		rule, err := parsePriceRule(fields[0], fields[1:])
+		if err != nil {
+			return c.Send(b.i18nManager.T(user, "prices.invalid", i18n.Args{"Error": err.Error()}))
+		}
+		change = func(t *pricing.Table) error {
+			for i := range t.Rules {
+				if t.Rules[i].ID == rule.ID {
+					t.Rules[i] = rule
+					return nil
+				}
+			}
+			t.Rules = append(t.Rules, rule)
+			return nil
+		}
+	case "plan":
+		if len(fields) != 3 {
+			return c.Send(b.i18nManager.T(user, "prices.usage"))
+		}
+		plan, err := parsePricePlan(fields[0], fields[1], fields[2])
+		if err != nil {
+			return c.Send(b.i18nManager.T(user, "prices.invalid", i18n.Args{"Error": err.Error()}))
+		}
+		change = func(t *pricing.Table) error {
+			for i := range t.Plans {
+				if t.Plans[i].ID == plan.ID {
+					t.Plans[i] = plan
+					return nil
+				}
+			}
+			t.Plans = append(t.Plans, plan)
+			return nil
+		}
+	case "delrule", "delplan":
+		if len(fields) != 1 {
+			return c.Send(b.i18nManager.T(user, "prices.usage"))
+		}
+		id := fields[0]
+		found := false
+		change = func(t *pricing.Table) error {
+			if action == "delrule" {
+				for i := range t.Rules {
+					if t.Rules[i].ID == id {
+						t.Rules = append(t.Rules[:i], t.Rules[i+1:]...)
+						found = true
+						break
+					}
+				}
+			} else {
+				for i := range t.Plans {
+					if t.Plans[i].ID == id {
+						t.Plans = append(t.Plans[:i], t.Plans[i+1:]...)
+						found = true
+						break
+					}
+				}
+			}
+			if !found {
+				return errPriceNotFound
+			}
+			return nil
+		}
+	case "reset":
+		change = func(t *pricing.Table) error {
+			*t = *pricing.Default()
+			return nil
+		}
+	default:
+		return c.Send(b.i18nManager.T(user, "prices.usage"))
+	}
+
+	if _, err := b.pricing.Update(user.ID, change); err != nil {
+		switch {
+		case errors.Is(err, errPriceNotFound):
+			return c.Send(b.i18nManager.T(user, "prices.not_found", i18n.Args{"ID": fields[0]}))
+		case errors.Is(err, pricing.ErrInvalid):
+			return c.Send(b.i18nManager.T(user, "prices.invalid", i18n.Args{"Error": err.Error()}))
+		default:
+			logger.Error("Ошибка сохранения цен: %v", err)
+			return c.Send(b.i18nManager.T(user, "prices.error"))
+		}
+	}
+
+	logger.Info("Админ %d изменил цены: %s %s", user.ID, args.String("action"), args.String("params"))
+	if err := c.Send(b.i18nManager.T(user, "prices.updated")); err != nil {
+		return err
+	}
+	return b.sendPrices(c)
+}
+
+// errPriceNotFound удаляемое правило или план не найдены
+var errPriceNotFound = errors.New("не найдено")
+
+// sendPrices показывает действующую таблицу цен
+func (b *Bot) sendPrices(c tele.Context) error {
+	user := c.Sender()
+	table := b.pricing.Table()
+
+	rules := make([]string, 0, len(table.Rules))
+	for _, r := range table.Rules {
+		rules = append(rules, b.i18nManager.T(user, "prices.rule_row", i18n.Args{
+			"ID":         r.ID,
+			"Conditions": r.Conditions(),
+			"Price":      r.Price,
+		}))
+	}
+	if len(rules) == 0 {
+		rules = append(rules, b.i18nManager.T(user, "prices.none"))
+	}
+
+	plans := make([]string, 0, len(table.Plans))
+	for _, p := range table.Plans {
+		duration := b.i18nManager.T(user, "prices.forever")
+		if p.Duration > 0 {
+			duration = b.i18nManager.T(user, "prices.plan_days", i18n.Args{"Days": int(time.Duration(p.Duration).Hours() / 24)})
+		}
+		plans = append(plans, b.i18nManager.T(user, "prices.plan_row", i18n.Args{
+			"ID":       p.ID,
+			"Duration": duration,
+			"Price":    p.Price,
+		}))
+	}
+	if len(plans) == 0 {
+		plans = append(plans, b.i18nManager.T(user, "prices.none"))
+	}
+
+	return c.Send(strings.Join([]string{
+		b.i18nManager.T(user, "prices.view", i18n.Args{
+			"Source":  b.pricing.Source(),
+			"Default": table.DefaultPrice,
+			"Rules":   strings.Join(rules, "\n"),
+			"Plans":   strings.Join(plans, "\n"),
+		}),
+		b.i18nManager.T(user, "prices.usage"),
+	}, "\n\n"))
+}
+
+// parsePriceRule разбирает правило из аргументов вида key=value
+func parsePriceRule(id string, params []string) (pricing.Rule, error) {
+	rule := pricing.Rule{ID: id}
+	for _, param := range params {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return rule, fmt.Errorf("ожидается key=value: %s", param)
+		}
+
+		var err error
+		switch strings.ToLower(key) {
+		case "price":
+			rule.Price, err = strconv.Atoi(value)
+		case "type":
+			rule.MediaType = strings.ToLower(value)
+		case "quality":
+			rule.Quality = strings.ToLower(value)
+		case "min_duration", "max_duration":
+			var d time.Duration
+			if d, err = pricing.ParseDuration(value); err == nil {
+				if strings.ToLower(key) == "min_duration" {
+					rule.MinDuration = pricing.Duration(d)
+				} else {
+					rule.MaxDuration = pricing.Duration(d)
+				}
+			}
+		case "min_size_mb":
+			rule.MinSizeMB, err = strconv.ParseInt(value, 10, 64)
+		case "max_size_mb":
+			rule.MaxSizeMB, err = strconv.ParseInt(value, 10, 64)
+		default:
+			return rule, fmt.Errorf("неизвестный параметр %s", key)
+		}
+		if err != nil {
+			return rule, fmt.Errorf("некорректное значение %s: %s", key, value)
+		}
+	}
+	return rule, nil
+}
+
+// parsePricePlan разбирает план подписки: длительность ("30d", "720h") или forever
+func parsePricePlan(id, durationStr, priceStr string) (pricing.Plan, error) {
+	plan := pricing.Plan{ID: id}
+
+	if strings.ToLower(durationStr) != "forever" {
+		d, err := pricing.ParseDuration(durationStr)
+		if err != nil || d <= 0 {
+			return plan, fmt.Errorf("некорректная длительность: %s", durationStr)
+		}
+		plan.Duration = pricing.Duration(d)
+	}
+
+	price, err := strconv.Atoi(priceStr)
+	if err != nil {
+		return plan, fmt.Errorf("некорректная цена: %s", priceStr)
+	}
+	plan.Price = price
+	return plan, nil
+}
@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"YoutubeDownloader/internal/i18n"
+	"YoutubeDownloader/internal/storage"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// referralPayloadPrefix префикс payload /start в реферальной ссылке: t.me/<bot>?start=ref_<user_id>
+const referralPayloadPrefix = "ref_"
+
+// TopReferrersLimit сколько пригласивших показывать в статистике
+const TopReferrersLimit = 10
+
+// handleStart обрабатывает /start: сохраняет приглашение из payload и отправляет приветствие
+func (b *Bot) handleStart(c tele.Context) error {
+	if payload := commandArgs(c).String("payload"); payload != "" {
+		b.handleReferralPayload(c, payload)
+	}
+	return b.sendWelcome(c)
+}
+
+// handleReferralPayload засчитывает приглашение по payload "ref_<user_id>"
+func (b *Bot) handleReferralPayload(c tele.Context, payload string) {
+	logger := NewLogger("REFERRAL")
+
+	idStr, ok := strings.CutPrefix(payload, referralPayloadPrefix)
+	if !ok {
+		return
+	}
+	referrerID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || referrerID <= 0 {
+		logger.Warning("Некорректный реферальный payload: %q", payload)
+		return
+	}
+
+	created, err := storage.CreateReferral(b.db, referrerID, c.Sender().ID)
+	if err != nil {
+		logger.Error("Ошибка сохранения приглашения %d -> %d: %v", referrerID, c.Sender().ID, err)
+		return
+	}
+	if created {
+		logger.Info("Пользователь %d пришел по приглашению %d", c.Sender().ID, referrerID)
+	}
+}
+
+// rewardReferral начисляет награду пригласившему и приглашенному после первого успешного скачивания
+func (b *Bot) rewardReferral(refereeID int64) {
+	logger := NewLogger("REFERRAL")
+
+	if b.config.ReferralRewardCredits == 0 && b.config.ReferralRewardDays == 0 {
+		return
+	}
+
+	referrerID, err := storage.GrantReferralReward(b.db, refereeID,
+		b.config.ReferralRewardCredits, time.Duration(b.config.ReferralRewardDays)*24*time.Hour)
+	if err != nil {
+		logger.Error("Ошибка начисления награды за приглашение пользователя %d: %v", refereeID, err)
+		return
+	}
+	if referrerID == 0 {
+		return
+	}
+
+	for _, userID := range []int64{referrerID, refereeID} {
+		user := &tele.User{ID: userID}
+		key := "referral.rewarded_referrer"
+		if userID == refereeID {
+			key = "referral.rewarded_referee"
+		}
+		text := b.i18nManager.T(user, key, i18n.Args{"Reward": b.referralRewardText(user)})
+		if _, err := b.api.Send(user, text); err != nil {
+			b.noteSendError(userID, err)
+			logger.Warning("Не удалось уведомить пользователя %d о награде: %v", userID, err)
+		}
+	}
+	logger.Info("Начислена награда за приглашение: %d пригласил %d", referrerID, refereeID)
+}
+
+// sendReferral показывает персональную реферальную ссылку и статистику приглашений
+func (b *Bot) sendReferral(c tele.Context) error {
+	user := c.Sender()
+
+	stats, err := storage.GetReferrerStats(b.db, user.ID)
+	if err != nil {
+		NewLogger("REFERRAL").Error("Ошибка получения приглашений пользователя %d: %v", user.ID, err)
+		return c.Send(b.i18nManager.T(user, "referral.error"))
+	}
+
+	return c.Send(b.i18nManager.T(user, "referral.info", i18n.Args{
+		"Link":     b.referralLink(user.ID),
+		"Reward":   b.referralRewardText(user),
+		"Invited":  stats.Invited,
+		"Rewarded": stats.Rewarded,
+	}), tele.NoPreview)
+}
+
+// referralLink возвращает персональную ссылку-приглашение
+func (b *Bot) referralLink(userID int64) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s%d", b.api.Me.Username, referralPayloadPrefix, userID)
+}
+
+// referralRewardText описывает награду за приглашение
+func (b *Bot) referralRewardText(user *tele.User) string {
+	var parts []string
+	if b.config.ReferralRewardCredits > 0 {
+		parts = append(parts, b.i18nManager.T(user, "referral.reward_credits", i18n.Args{"Count": b.config.ReferralRewardCredits}))
+	}
+	if b.config.ReferralRewardDays > 0 {
+		parts = append(parts, b.i18nManager.T(user, "referral.reward_days", i18n.Args{"Count": b.config.ReferralRewardDays}))
+	}
+	if len(parts) == 0 {
+		return b.i18nManager.T(user, "referral.reward_none")
+	}
+	return strings.Join(parts, " + ")
+}
+
+// topReferrersText формирует топ пригласивших для статистики
+func (b *Bot) topReferrersText(user *tele.User) (string, error) {
+	top, err := storage.GetTopReferrers(b.db, TopReferrersLimit)
+	if err != nil || len(top) == 0 {
+		return "", err
+	}
+
+	lines := []string{b.i18nManager.T(user, "stats.referrers_header")}
+	for _, s := range top {
+		lines = append(lines, b.i18nManager.T(user, "stats.referrer_row", i18n.Args{
+			"UserID":   s.UserID,
+			"Invited":  s.Invited,
+			"Rewarded": s.Rewarded,
+		}))
+	}
+	return strings.Join(lines, "\n"), nil
+}
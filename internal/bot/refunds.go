@@ -0,0 +1,438 @@
+package bot
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"YoutubeDownloader/internal/i18n"
+	"YoutubeDownloader/internal/logging"
+	"YoutubeDownloader/internal/metrics"
+	"YoutubeDownloader/internal/payment"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// Действия браузера транзакций в callback "adm_trx|<действие>|<сессия>|<страница>|<id>"
+const (
+	trxActionList    = "l"
+	trxActionDetail  = "d"
+	trxActionAsk     = "r"
+	trxActionConfirm = "c"
+)
+
+const (
+	trxPageSize   = 8
+	trxSessionTTL = time.Hour
+)
+
+// trxSession фильтр и причина возврата, выбранные админом. Хранятся в памяти,
+// потому что в callback data помещается только 64 байта
+type trxSession struct {
+	filter    payment.TransactionFilter
+	reason    string
+	createdAt time.Time
+}
+
+// newTrxSession сохраняет сессию браузера и возвращает ее токен
+func (b *Bot) newTrxSession(filter payment.TransactionFilter, reason string) string {
+	b.trxSessionsMutex.Lock()
+	defer b.trxSessionsMutex.Unlock()
+
+	now := time.Now()
+	for token, s := range b.trxSessions {
+		if now.Sub(s.createdAt) > trxSessionTTL {
+			delete(b.trxSessions, token)
+		}
+	}
+
+	token := GenerateRequestID()[:8]
+	b.trxSessions[token] = &trxSession{filter: filter, reason: reason, createdAt: now}
+	return token
+}
+
+// trxSessionByToken возвращает сессию браузера; nil, если она истекла
+func (b *Bot) trxSessionByToken(token string) *trxSession {
+	b.trxSessionsMutex.Lock()
+	defer b.trxSessionsMutex.Unlock()
+
+	s, ok := b.trxSessions[token]
+	if !ok || time.Since(s.createdAt) > trxSessionTTL {
+		return nil
+	}
+	return s
+}
+
+// parseTrxFilter разбирает фильтры вида "user:123 status:success from:2024-07-01 to:2024-07-31 url:youtube".
+// Дата to включается целиком
+func parseTrxFilter(text string) (payment.TransactionFilter, error) {
+	var f payment.TransactionFilter
+	for _, token := range strings.Fields(text) {
+		key, value, ok := strings.Cut(token, ":")
+		if !ok || value == "" {
+			return f, fmt.Errorf("некорректный фильтр %q", token)
+		}
+
+		switch key = strings.ToLower(key); key {
+		case "user":
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return f, fmt.Errorf("некорректный user_id %q", value)
+			}
+			f.UserID = id
+		case "status":
+			f.Status = strings.ToLower(value)
+		case "from", "to":
+			date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+			if err != nil {
+				return f, fmt.Errorf("некорректная дата %q, нужен формат ГГГГ-ММ-ДД", value)
+			}
+			if key == "from" {
+				f.From = &date
+			} else {
+				end := date.AddDate(0, 0, 1)
+				f.To = &end
+			}
+		case "url":
+			f.URL = value
+		default:
+			return f, fmt.Errorf("неизвестный фильтр %q", key)
+		}
+	}
+	return f, nil
+}
+
+// describeTrxFilter возвращает фильтр в том же виде, в котором его вводят
+func describeTrxFilter(f payment.TransactionFilter) string {
+	var parts []string
+	if f.UserID != 0 {
+		parts = append(parts, fmt.Sprintf("user:%d", f.UserID))
+	}
+	if f.Status != "" {
+		parts = append(parts, "status:"+f.Status)
+	}
+	if f.From != nil {
+		parts = append(parts, "from:"+f.From.Format("2006-01-02"))
+	}
+	if f.To != nil {
+		parts = append(parts, "to:"+f.To.AddDate(0, 0, -1).Format("2006-01-02"))
+	}
+	if f.URL != "" {
+		parts = append(parts, "url:"+f.URL)
+	}
+	return strings.Join(parts, " ")
+}
+
+// trxCallback формирует callback data браузера транзакций
+func trxCallback(action, token string, page int, id int64) string {
+	return fmt.Sprintf("%s|%s|%s|%d|%d", CallbackAdminTrx, action, token, page, id)
+}
+
+// handleAdminCommand открывает браузер транзакций: /admin [фильтры]
+func (b *Bot) handleAdminCommand(c tele.Context) error {
+	filter, err := parseTrxFilter(commandArgs(c).String("filters"))
+	if err != nil {
+		return c.Send(b.i18nManager.T(c.Sender(), "admin_trx.invalid_filter", i18n.Args{"Error": err.Error()}))
+	}
+
+	token := b.newTrxSession(filter, "")
+	return b.showTrxList(c, token, 0)
+}
+
+// handleAdminTrxCallback обрабатывает навигацию по браузеру транзакций
+func (b *Bot) handleAdminTrxCallback(c tele.Context, data string) error {
+	_ = c.Respond()
+
+	parts := strings.Split(data, "|")
+	if len(parts) != 4 {
+		return nil
+	}
+	action, token := parts[0], parts[1]
+	page, _ := strconv.Atoi(parts[2])
+	id, _ := strconv.ParseInt(parts[3], 10, 64)
+
+	if b.trxSessionByToken(token) == nil {
+		return c.Send(b.i18nManager.T(c.Sender(), "admin_trx.session_expired"))
+	}
+
+	switch action {
+	case trxActionList:
+		return b.showTrxList(c, token, page)
+	case trxActionDetail:
+		return b.showTrxDetail(c, token, page, id)
+	case trxActionAsk:
+		return b.askTrxRefund(c, token, page, id)
+	case trxActionConfirm:
+		return b.confirmTrxRefund(c, token, page, id)
+	}
+	return nil
+}
+
+// trxStatusText статус транзакции в браузере; зависший возврат выделяется
+func (b *Bot) trxStatusText(user *tele.User, trx *payment.Transaction) string {
+	if trx.IsStaleRefund() {
+		return b.i18nManager.T(user, "admin_trx.status_stale_refund", i18n.Args{"Status": trx.Status})
+	}
+	return trx.Status
+}
+
+// showTrxList показывает страницу транзакций по фильтру сессии
+func (b *Bot) showTrxList(c tele.Context, token string, page int) error {
+	logger := NewLogger("ADMIN")
+	session := b.trxSessionByToken(token)
+	if session == nil {
+		return c.Send(b.i18nManager.T(c.Sender(), "admin_trx.session_expired"))
+	}
+
+	trxs, total, err := payment.SearchTransactions(b.db, session.filter, trxPageSize, page*trxPageSize)
+	if err != nil {
+		logger.Error("Ошибка поиска транзакций: %v", err)
+		return c.Send(b.i18nManager.T(c.Sender(), "admin_trx.error"))
+	}
+	if total == 0 {
+		return c.EditOrSend(b.i18nManager.T(c.Sender(), "admin_trx.empty"))
+	}
+
+	pages := (total + trxPageSize - 1) / trxPageSize
+	filter := describeTrxFilter(session.filter)
+	if filter == "" {
+		filter = b.i18nManager.T(c.Sender(), "admin_trx.filter_none")
+	}
+
+	var text strings.Builder
+	text.WriteString(b.i18nManager.T(c.Sender(), "admin_trx.header", i18n.Args{
+		"Total": total, "Page": page + 1, "Pages": pages, "Filter": filter,
+	}))
+	text.WriteString("\n\n")
+
+	markup := &tele.ReplyMarkup{}
+	for i := range trxs {
+		trx := &trxs[i]
+		status := b.trxStatusText(c.Sender(), trx)
+		text.WriteString(b.i18nManager.T(c.Sender(), "admin_trx.row", i18n.Args{
+			"ID": trx.ID, "Date": trx.CreatedAt, "UserID": trx.TelegramUserID, "Amount": trx.Amount, "Status": status,
+		}))
+		text.WriteString("\n")
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []tele.InlineButton{{
+			Text: b.i18nManager.T(c.Sender(), "admin_trx.button", i18n.Args{"ID": trx.ID, "Amount": trx.Amount, "Status": status}),
+			Data: trxCallback(trxActionDetail, token, page, trx.ID),
+		}})
+	}
+
+	var nav []tele.InlineButton
+	if page > 0 {
+		nav = append(nav, tele.InlineButton{Text: b.i18nManager.T(c.Sender(), "admin_trx.prev"), Data: trxCallback(trxActionList, token, page-1, 0)})
+	}
+	if page+1 < pages {
+		nav = append(nav, tele.InlineButton{Text: b.i18nManager.T(c.Sender(), "admin_trx.next"), Data: trxCallback(trxActionList, token, page+1, 0)})
+	}
+	if len(nav) > 0 {
+		markup.InlineKeyboard = append(markup.InlineKeyboard, nav)
+	}
+
+	return c.EditOrSend(text.String(), markup, tele.NoPreview)
+}
+
+// showTrxDetail показывает транзакцию, историю попыток возврата и кнопку возврата
+func (b *Bot) showTrxDetail(c tele.Context, token string, page int, id int64) error {
+	logger := NewLogger("ADMIN")
+
+	trx, err := payment.GetTransactionByID(b.db, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Send(b.i18nManager.T(c.Sender(), "transaction_not_found"))
+		}
+		logger.Error("Ошибка получения транзакции %d: %v", id, err)
+		return c.Send(b.i18nManager.T(c.Sender(), "admin_trx.error"))
+	}
+
+	var text strings.Builder
+	text.WriteString(b.i18nManager.T(c.Sender(), "admin_trx.detail", i18n.Args{
+		"ID":       trx.ID,
+		"UserID":   trx.TelegramUserID,
+		"Amount":   trx.Amount,
+		"Rule":     trx.PricingRule,
+		"Status":   b.trxStatusText(c.Sender(), trx),
+		"Payload":  trx.InvoicePayload,
+		"URL":      trx.URL,
+		"ChargeID": trx.TelegramPaymentChargeID,
+		"Date":     trx.CreatedAt,
+	}))
+	if trx.IsStaleRefund() {
+		text.WriteString("\n\n")
+		text.WriteString(b.i18nManager.T(c.Sender(), "admin_trx.stale_refund", i18n.Args{"Since": trx.UpdatedAt}))
+	}
+
+	audit, err := payment.GetRefundAuditByTransaction(b.db, trx.ID)
+	if err != nil {
+		logger.Warning("Ошибка получения аудита возвратов для транзакции %d: %v", trx.ID, err)
+	}
+	if len(audit) > 0 {
+		text.WriteString("\n\n")
+		text.WriteString(b.i18nManager.T(c.Sender(), "admin_trx.audit_header"))
+		for _, a := range audit {
+			resultKey := "admin_trx.audit_failed"
+			if a.Success {
+				resultKey = "admin_trx.audit_success"
+			}
+			text.WriteString("\n")
+			text.WriteString(b.i18nManager.T(c.Sender(), "admin_trx.audit_row", i18n.Args{
+				"Date": a.CreatedAt, "AdminID": a.AdminID, "Result": b.i18nManager.T(c.Sender(), resultKey), "Reason": a.Reason,
+			}))
+		}
+	}
+
+	markup := &tele.ReplyMarkup{}
+	if trx.IsRefundable() {
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []tele.InlineButton{{
+			Text: b.i18nManager.T(c.Sender(), "admin_trx.refund_button"),
+			Data: trxCallback(trxActionAsk, token, page, trx.ID),
+		}})
+	}
+	markup.InlineKeyboard = append(markup.InlineKeyboard, []tele.InlineButton{{
+		Text: b.i18nManager.T(c.Sender(), "admin_trx.back"),
+		Data: trxCallback(trxActionList, token, page, 0),
+	}})
+
+	return c.EditOrSend(text.String(), markup, tele.NoPreview)
+}
+
+// askTrxRefund просит подтвердить возврат
+func (b *Bot) askTrxRefund(c tele.Context, token string, page int, id int64) error {
+	trx, err := payment.GetTransactionByID(b.db, id)
+	if err != nil {
+		return c.Send(b.i18nManager.T(c.Sender(), "transaction_not_found"))
+	}
+	if !trx.IsRefundable() {
+		return c.Send(b.i18nManager.T(c.Sender(), "refund.not_refundable", i18n.Args{"ID": trx.ID, "Status": trx.Status}))
+	}
+
+	markup := &tele.ReplyMarkup{InlineKeyboard: [][]tele.InlineButton{{
+		{Text: b.i18nManager.T(c.Sender(), "admin_trx.confirm_button"), Data: trxCallback(trxActionConfirm, token, page, trx.ID)},
+		{Text: b.i18nManager.T(c.Sender(), "admin_trx.cancel_button"), Data: trxCallback(trxActionDetail, token, page, trx.ID)},
+	}}}
+
+	return c.EditOrSend(b.i18nManager.T(c.Sender(), "admin_trx.confirm", i18n.Args{
+		"ID": trx.ID, "UserID": trx.TelegramUserID, "Amount": trx.Amount,
+	}), markup)
+}
+
+// confirmTrxRefund выполняет подтвержденный возврат
+func (b *Bot) confirmTrxRefund(c tele.Context, token string, page int, id int64) error {
+	trx, err := payment.GetTransactionByID(b.db, id)
+	if err != nil {
+		return c.Send(b.i18nManager.T(c.Sender(), "transaction_not_found"))
+	}
+
+	reason := ""
+	if session := b.trxSessionByToken(token); session != nil {
+		reason = session.reason
+	}
+	if reason == "" {
+		reason = "admin panel"
+	}
+
+	if err := b.refundTransaction(c.Sender().ID, trx, trx.TelegramUserID, reason); err != nil {
+		return b.sendRefundError(c, trx, err)
+	}
+
+	back := &tele.ReplyMarkup{InlineKeyboard: [][]tele.InlineButton{{{
+		Text: b.i18nManager.T(c.Sender(), "admin_trx.back"),
+		Data: trxCallback(trxActionDetail, token, page, trx.ID),
+	}}}}
+	return c.EditOrSend(b.i18nManager.T(c.Sender(), "refund.success_user", i18n.Args{
+		"ChargeID": trx.TelegramPaymentChargeID, "UserID": trx.TelegramUserID, "Amount": trx.Amount,
+	}), back)
+}
+
+// refundTransaction возвращает средства по транзакции из БД (см. payment.RefundTransaction)
+func (b *Bot) refundTransaction(adminID int64, trx *payment.Transaction, userID int64, reason string) error {
+	if err := payment.RefundTransaction(b.db, b.api, trx, adminID, userID, reason); err != nil {
+		return err
+	}
+	NewLogger("REFUND").Info("Админ %d вернул %d XTR пользователю %d по транзакции %d", adminID, trx.Amount, userID, trx.ID)
+	return nil
+}
+
+// writeRefundAudit сохраняет попытку возврата; ошибка аудита не должна терять результат возврата
+func (b *Bot) writeRefundAudit(a *payment.RefundAudit) {
+	if err := payment.InsertRefundAudit(b.db, a); err != nil {
+		NewLogger("REFUND").Error("Ошибка записи аудита возврата (charge_id=%s, success=%t): %v", logging.Mask(a.ChargeID), a.Success, err)
+	}
+}
+
+// sendRefundError сообщает админу о неудачном возврате
+func (b *Bot) sendRefundError(c tele.Context, trx *payment.Transaction, err error) error {
+	if err == payment.ErrNotRefundable {
+		return c.Send(b.i18nManager.T(c.Sender(), "refund.not_refundable", i18n.Args{"ID": trx.ID, "Status": trx.Status}))
+	}
+	NewLogger("REFUND").LogErrorWithContext("Ошибка возврата средств", err, logging.Mask(trx.TelegramPaymentChargeID))
+	return c.Send(b.i18nManager.T(c.Sender(), "refund.failed_user", i18n.Args{
+		"ChargeID": trx.TelegramPaymentChargeID, "Error": err.Error(), "UserID": trx.TelegramUserID,
+	}))
+}
+
+// handleRefundCommand обрабатывает команду возврата: /refund <charge_id> [user_id] [reason].
+// Если транзакция есть в БД, показывает подтверждение; иначе при указанном user_id
+// отправляет возврат в Telegram напрямую
+func (b *Bot) handleRefundCommand(c tele.Context) error {
+	logger := NewLogger("REFUND")
+
+	args := commandArgs(c)
+	chargeID := args.String("charge_id")
+	userID := args.Int64("user_id")
+	reason := args.String("reason")
+
+	trx, err := payment.GetTransactionByChargeID(b.db, chargeID)
+	if err == nil {
+		token := b.newTrxSession(payment.TransactionFilter{UserID: trx.TelegramUserID}, reason)
+		if !trx.IsRefundable() {
+			return b.showTrxDetail(c, token, 0, trx.ID)
+		}
+		return b.askTrxRefund(c, token, 0, trx.ID)
+	}
+	if err != sql.ErrNoRows {
+		logger.Error("Ошибка поиска транзакции по charge_id %s: %v", logging.Mask(chargeID), err)
+		return c.Send(b.i18nManager.T(c.Sender(), "admin_trx.error"))
+	}
+
+	if userID == 0 {
+		return c.Send(b.i18nManager.T(c.Sender(), "refund.no_user"))
+	}
+	if reason == "" {
+		reason = "manual refund"
+	}
+
+	response, refundErr := payment.RefundStarPayment(b.api, userID, chargeID, 0, reason)
+	metrics.Refunds.WithLabelValues("manual", metrics.Outcome(refundErr == nil)).Inc()
+	b.writeRefundAudit(&payment.RefundAudit{
+		ChargeID: chargeID,
+		UserID:   userID,
+		AdminID:  c.Sender().ID,
+		Reason:   reason,
+		Success:  refundErr == nil,
+		Response: response,
+	})
+	if refundErr != nil {
+		logger.LogErrorWithContext("Ошибка возврата средств (транзакция не найдена в БД)", refundErr, logging.Mask(chargeID))
+		return c.Send(b.i18nManager.T(c.Sender(), "refund.failed_manual_user", i18n.Args{"ChargeID": chargeID, "Error": refundErr.Error(), "UserID": userID}))
+	}
+
+	logger.Info("Админ %d выполнил возврат по charge_id %s пользователю %d без транзакции в БД", c.Sender().ID, logging.Mask(chargeID), userID)
+	return c.Send(b.i18nManager.T(c.Sender(), "refund.attempt_user", i18n.Args{"ChargeID": chargeID, "UserID": userID}))
+}
+
+// handleLegacyRefundCallback обрабатывает кнопки "admin_refund|<charge_id>" из старых меню:
+// вместо немедленного возврата показывает карточку транзакции с подтверждением
+func (b *Bot) handleLegacyRefundCallback(c tele.Context, chargeID string) error {
+	_ = c.Respond()
+
+	trx, err := payment.GetTransactionByChargeID(b.db, chargeID)
+	if err != nil {
+		return c.Send(b.i18nManager.T(c.Sender(), "transaction_not_found"))
+	}
+	token := b.newTrxSession(payment.TransactionFilter{UserID: trx.TelegramUserID}, "")
+	return b.showTrxDetail(c, token, 0, trx.ID)
+}
@@ -0,0 +1,274 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"YoutubeDownloader/internal/config"
+	"YoutubeDownloader/internal/i18n"
+	"YoutubeDownloader/internal/storage"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// Этапы платежа, на которых записывается событие payment_error
+const (
+	paymentStageTransaction = "transaction" // не удалось создать транзакцию
+	paymentStageInvoice     = "invoice"     // не удалось отправить инвойс
+	paymentStagePreCheckout = "precheckout" // не удалось подтвердить PreCheckoutQuery
+	paymentStageProcessing  = "processing"  // оплата получена, но не обработана
+)
+
+// Виды дайджестов
+const (
+	digestDaily  = "daily"
+	digestWeekly = "weekly"
+)
+
+// Виды алертов
+const (
+	alertDownloads = "downloads"
+	alertPayments  = "payments"
+)
+
+// reportCheckInterval как часто проверяются расписание дайджестов и пороги алертов
+const reportCheckInterval = time.Minute
+
+// trackPaymentError записывает ошибку платежа для дайджестов и алертов
+func (b *Bot) trackPaymentError(userID int64, stage string) {
+	b.trackEvent(storage.Event{UserID: userID, Type: storage.EventPaymentError, Plan: stage})
+}
+
+// runReports отправляет дайджесты по расписанию и алерты при всплеске ошибок, пока не отменен ctx
+func (b *Bot) runReports(ctx context.Context) {
+	logger := NewLogger("REPORTS")
+
+	if len(b.config.Reports.ChatIDs(b.config.AdminID)) == 0 {
+		logger.Info("Чаты для отчетов не заданы: дайджесты и алерты отключены")
+		return
+	}
+
+	ticker := time.NewTicker(reportCheckInterval)
+	defer ticker.Stop()
+
+	lastAlerts := make(map[string]time.Time)
+	for {
+		b.sendDueDigests(time.Now())
+		b.checkAlerts(time.Now(), lastAlerts)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// digestPeriod возвращает последний период дайджеста, время отправки которого уже наступило.
+// Ежедневный охватывает прошедшие календарные сутки, еженедельный — семь дней до дня weekly_day.
+// Оба отправляются во время daily_at (еженедельный — в 09:00, если ежедневный отключен)
+func digestPeriod(kind string, now time.Time, r config.Reports) (from, to time.Time, ok bool) {
+	hour, minute, dailyOK := r.DailyTime()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	sendAt := func(day time.Time) time.Time {
+		return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+
+	switch kind {
+	case digestDaily:
+		if !dailyOK {
+			return time.Time{}, time.Time{}, false
+		}
+		to = today
+		if now.Before(sendAt(today)) {
+			to = today.AddDate(0, 0, -1)
+		}
+		return to.AddDate(0, 0, -1), to, true
+
+	case digestWeekly:
+		weekday, weeklyOK := r.Weekday()
+		if !weeklyOK {
+			return time.Time{}, time.Time{}, false
+		}
+		if !dailyOK {
+			hour, minute = 9, 0
+		}
+		to = today.AddDate(0, 0, -((int(now.Weekday()) - int(weekday) + 7) % 7))
+		if now.Before(sendAt(to)) {
+			to = to.AddDate(0, 0, -7)
+		}
+		return to.AddDate(0, 0, -7), to, true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// sendDueDigests отправляет дайджесты, время которых наступило. Период отмечается в БД до
+// отправки, поэтому после перезапуска или на второй реплике дайджест не дублируется
+func (b *Bot) sendDueDigests(now time.Time) {
+	logger := NewLogger("REPORTS")
+
+	for _, kind := range []string{digestDaily, digestWeekly} {
+		from, to, ok := digestPeriod(kind, now, b.config.Reports)
+		if !ok {
+			continue
+		}
+
+		claimed, err := storage.ClaimReportRun(b.db, kind, from)
+		if err != nil {
+			logger.Error("%v", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		digest, err := storage.GetDigest(b.db, from, to)
+		if err != nil {
+			logger.Error("Ошибка сборки дайджеста %s: %v", kind, err)
+			_ = storage.ReleaseReportRun(b.db, kind, from)
+			continue
+		}
+
+		sent := b.sendToReportChats(func(user *tele.User) string {
+			return b.digestText(user, b.digestTitle(user, kind, from, to), digest)
+		})
+		if sent == 0 {
+			_ = storage.ReleaseReportRun(b.db, kind, from)
+			continue
+		}
+		logger.Info("Дайджест %s за %s отправлен в %d чат(ов)", kind, from.Format(time.DateOnly), sent)
+	}
+}
+
+// checkAlerts сообщает о всплеске неудачных скачиваний и ошибок платежей за окно alert_window.
+// Повторный алерт того же вида отправляется не раньше alert_cooldown
+func (b *Bot) checkAlerts(now time.Time, lastAlerts map[string]time.Time) {
+	logger := NewLogger("REPORTS")
+	cfg := b.config.Reports
+
+	if cfg.AlertDownloadFailures == 0 && cfg.AlertPaymentErrors == 0 {
+		return
+	}
+
+	counts, err := storage.GetAlertCounts(b.db, cfg.AlertWindow)
+	if err != nil {
+		logger.Error("%v", err)
+		return
+	}
+
+	alert := func(kind string, render func(user *tele.User) string) {
+		if last, ok := lastAlerts[kind]; ok && now.Sub(last) < cfg.AlertCooldown {
+			return
+		}
+		if b.sendToReportChats(render) > 0 {
+			lastAlerts[kind] = now
+		}
+	}
+
+	if cfg.AlertDownloadFailures > 0 && counts.FailedDownloads >= int64(cfg.AlertDownloadFailures) {
+		logger.Warning("Всплеск неудачных скачиваний: %d из %d за %s", counts.FailedDownloads, counts.Downloads, cfg.AlertWindow)
+		alert(alertDownloads, func(user *tele.User) string {
+			return b.i18nManager.T(user, "reports.alert_downloads", i18n.Args{
+				"Window":    cfg.AlertWindow,
+				"Failed":    counts.FailedDownloads,
+				"Total":     counts.Downloads,
+				"Threshold": cfg.AlertDownloadFailures,
+			})
+		})
+	}
+	if cfg.AlertPaymentErrors > 0 && counts.PaymentErrors >= int64(cfg.AlertPaymentErrors) {
+		logger.Warning("Всплеск ошибок платежей: %d за %s", counts.PaymentErrors, cfg.AlertWindow)
+		alert(alertPayments, func(user *tele.User) string {
+			return b.i18nManager.T(user, "reports.alert_payments", i18n.Args{
+				"Window":    cfg.AlertWindow,
+				"Count":     counts.PaymentErrors,
+				"Threshold": cfg.AlertPaymentErrors,
+			})
+		})
+	}
+}
+
+// sendToReportChats отправляет сообщение в чаты отчетов на языке каждого чата.
+// Возвращает число чатов, куда сообщение доставлено
+func (b *Bot) sendToReportChats(render func(user *tele.User) string) int {
+	logger := NewLogger("REPORTS")
+
+	sent := 0
+	for _, chatID := range b.config.Reports.ChatIDs(b.config.AdminID) {
+		if _, err := b.api.Send(tele.ChatID(chatID), render(&tele.User{ID: chatID})); err != nil {
+			logger.Error("Ошибка отправки отчета в чат %d: %v", chatID, err)
+			continue
+		}
+		sent++
+	}
+	return sent
+}
+
+// digestTitle заголовок дайджеста по расписанию: сутки или неделя, последний день включительно
+func (b *Bot) digestTitle(user *tele.User, kind string, from, to time.Time) string {
+	if kind == digestWeekly {
+		return b.i18nManager.T(user, "reports.weekly_title", i18n.Args{
+			"From": from.Format(time.DateOnly),
+			"To":   to.AddDate(0, 0, -1).Format(time.DateOnly),
+		})
+	}
+	return b.i18nManager.T(user, "reports.daily_title", i18n.Args{"Date": from.Format(time.DateOnly)})
+}
+
+// digestText форматирует дайджест с заголовком title
+func (b *Bot) digestText(user *tele.User, title string, d *storage.Digest) string {
+	top := func(list []storage.NamedCount) string {
+		if len(list) == 0 {
+			return b.i18nManager.T(user, "reports.top_empty")
+		}
+		rows := make([]string, 0, len(list))
+		for _, item := range list {
+			rows = append(rows, b.i18nManager.T(user, "reports.top_row", i18n.Args{"Name": item.Name, "Count": item.Count}))
+		}
+		return strings.Join(rows, "\n")
+	}
+
+	return b.i18nManager.T(user, "reports.digest", i18n.Args{
+		"Title":         title,
+		"NewUsers":      d.NewUsers,
+		"ActiveUsers":   d.ActiveUsers,
+		"Downloads":     d.Downloads,
+		"CacheRate":     d.CacheHitRate(),
+		"Failed":        d.FailedDownloads,
+		"Revenue":       d.Revenue,
+		"Payments":      d.Payments,
+		"Refunds":       d.Refunds,
+		"Refunded":      d.RefundedStars,
+		"FailedRefunds": d.FailedRefunds,
+		"PaymentErrors": d.PaymentErrors,
+		"Sites":         top(d.TopSites),
+		"Extractors":    top(d.TopFailingExtractors),
+	})
+}
+
+// handleDigestCommand показывает сводку за последние 24 часа или 7 дней: /digest [daily|weekly]
+func (b *Bot) handleDigestCommand(c tele.Context) error {
+	kind := strings.ToLower(commandArgs(c).String("period"))
+	if kind == "" {
+		kind = digestDaily
+	}
+
+	to := time.Now()
+	var from time.Time
+	switch kind {
+	case digestDaily:
+		from = to.AddDate(0, 0, -1)
+	case digestWeekly:
+		from = to.AddDate(0, 0, -7)
+	default:
+		return c.Send(b.i18nManager.T(c.Sender(), "reports.digest_usage"))
+	}
+
+	digest, err := storage.GetDigest(b.db, from, to)
+	if err != nil {
+		return c.Send(b.i18nManager.T(c.Sender(), "stats.error", i18n.Args{"Error": err.Error()}))
+	}
+	title := b.i18nManager.T(c.Sender(), "reports.recent_title", i18n.Args{"Since": from})
+	return c.Send(b.digestText(c.Sender(), title, digest))
+}
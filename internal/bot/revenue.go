@@ -0,0 +1,142 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"YoutubeDownloader/internal/i18n"
+	"YoutubeDownloader/internal/revenue"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// Ограничения /revenue: период в днях и число расхождений в сообщении
+const (
+	revenueMaxDays       = 366
+	revenueMaxMismatches = 15
+)
+
+// revenuePeriod разбирает аргумент /revenue: пусто — текущий месяц, ГГГГ-ММ — месяц,
+// число — последние N дней, включая сегодня. Возвращает период [from, to) и заголовок
+func (b *Bot) revenuePeriod(user *tele.User, arg string) (from, to time.Time, title string, ok bool) {
+	now := time.Now()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	if arg != "" {
+		if days, err := strconv.Atoi(arg); err == nil {
+			if days < 1 || days > revenueMaxDays {
+				return time.Time{}, time.Time{}, "", false
+			}
+			from = time.Date(now.Year(), now.Month(), now.Day()-(days-1), 0, 0, 0, 0, now.Location())
+			return from, now, b.i18nManager.T(user, "revenue.title_days", i18n.Args{"Days": days}), true
+		}
+		parsed, err := time.ParseInLocation("2006-01", arg, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, "", false
+		}
+		month = parsed
+	}
+	return month, month.AddDate(0, 1, 0), b.i18nManager.T(user, "revenue.title_month", i18n.Args{"Month": month.Format("2006-01")}), true
+}
+
+// revenueProduct название продукта для отчета
+func (b *Bot) revenueProduct(user *tele.User, product string) string {
+	switch {
+	case product == revenue.ProductVideo:
+		return b.i18nManager.T(user, "revenue.product_video")
+	case product == revenue.ProductSubscription:
+		return b.i18nManager.T(user, "revenue.product_subscription")
+	case strings.HasPrefix(product, "plan:"):
+		return b.i18nManager.T(user, "revenue.product_plan", i18n.Args{"Plan": strings.TrimPrefix(product, "plan:")})
+	}
+	return b.i18nManager.T(user, "revenue.product_unknown")
+}
+
+// handleRevenueCommand показывает выручку по продуктам и сверку с Telegram Stars:
+// /revenue [ГГГГ-ММ|дни]
+func (b *Bot) handleRevenueCommand(c tele.Context) error {
+	user := c.Sender()
+	from, to, title, ok := b.revenuePeriod(user, commandArgs(c).String("period"))
+	if !ok {
+		return c.Send(b.i18nManager.T(user, "revenue.usage", i18n.Args{"Max": revenueMaxDays}))
+	}
+
+	ledger, err := revenue.GetLedger(b.db, from, to)
+	if err != nil {
+		return c.Send(b.i18nManager.T(user, "stats.error", i18n.Args{"Error": err.Error()}))
+	}
+
+	products := b.i18nManager.T(user, "revenue.no_data")
+	if byProduct := ledger.ByProduct(); len(byProduct) > 0 {
+		rows := make([]string, 0, len(byProduct))
+		for _, r := range byProduct {
+			rows = append(rows, b.i18nManager.T(user, "revenue.product_row", i18n.Args{
+				"Product":  b.revenueProduct(user, r.Product),
+				"Payments": r.Payments,
+				"Gross":    r.Gross,
+				"Refunded": r.Refunded,
+				"Net":      r.Net(),
+			}))
+		}
+		products = strings.Join(rows, "\n")
+	}
+
+	total := ledger.Total()
+	return c.Send(b.i18nManager.T(user, "revenue.report", i18n.Args{
+		"Title":          title,
+		"Payments":       total.Payments,
+		"Gross":          total.Gross,
+		"Refunds":        total.Refunds,
+		"Refunded":       total.Refunded,
+		"Net":            total.Net(),
+		"Products":       products,
+		"Reconciliation": b.reconciliationText(user, from, to),
+	}))
+}
+
+// reconciliationText сверяет период с Telegram и форматирует итоги и расхождения
+func (b *Bot) reconciliationText(user *tele.User, from, to time.Time) string {
+	rec, err := revenue.Reconcile(b.db, b.api, from, to)
+	if err != nil {
+		NewLogger("REVENUE").Error("Ошибка сверки с Telegram: %v", err)
+		return b.i18nManager.T(user, "revenue.reconcile_error", i18n.Args{"Error": err.Error()})
+	}
+
+	summary := func(result string) string {
+		return b.i18nManager.T(user, "revenue.reconcile", i18n.Args{
+			"Payments": rec.TelegramPayments,
+			"Gross":    rec.TelegramGross,
+			"Refunds":  rec.TelegramRefunds,
+			"Refunded": rec.TelegramRefunded,
+			"Result":   result,
+		})
+	}
+	if len(rec.Mismatches) == 0 {
+		return summary(b.i18nManager.T(user, "revenue.reconcile_ok"))
+	}
+
+	shown := rec.Mismatches
+	if len(shown) > revenueMaxMismatches {
+		shown = shown[:revenueMaxMismatches]
+	}
+	rows := make([]string, 0, len(shown)+1)
+	for _, m := range shown {
+		args := i18n.Args{
+			"ChargeID":       m.ChargeID,
+			"UserID":         m.UserID,
+			"Amount":         m.Amount,
+			"TelegramAmount": m.TelegramAmount,
+			"Date":           m.At.Format("2006-01-02 15:04"),
+		}
+		args["Kind"] = b.i18nManager.T(user, "revenue.mismatch."+m.Kind, args)
+		rows = append(rows, b.i18nManager.T(user, "revenue.mismatch_row", args))
+	}
+	if hidden := len(rec.Mismatches) - len(shown); hidden > 0 {
+		rows = append(rows, b.i18nManager.T(user, "revenue.mismatches_more", i18n.Args{"Count": hidden}))
+	}
+	return summary(b.i18nManager.T(user, "revenue.mismatches", i18n.Args{
+		"Count": len(rec.Mismatches),
+		"Rows":  strings.Join(rows, "\n"),
+	}))
+}
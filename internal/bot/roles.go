@@ -0,0 +1,259 @@
+package bot
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"sync"
+
+	"YoutubeDownloader/internal/i18n"
+	"YoutubeDownloader/internal/storage"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// Role роль пользователя бота. Роли упорядочены: каждая следующая включает права предыдущих
+type Role string
+
+const (
+	RoleUser        Role = "user"
+	RoleStatsViewer Role = "stats_viewer"
+	RoleSupport     Role = "support"
+	RoleAdmin       Role = "admin"
+	RoleOwner       Role = "owner"
+)
+
+// roleLevels уровни ролей для сравнения
+var roleLevels = map[Role]int{
+	RoleUser:        0,
+	RoleStatsViewer: 1,
+	RoleSupport:     2,
+	RoleAdmin:       3,
+	RoleOwner:       4,
+}
+
+// grantableRoles роли, которые можно выдать командой /grant
+var grantableRoles = []Role{RoleStatsViewer, RoleSupport, RoleAdmin}
+
+// ParseRole разбирает имя роли
+func ParseRole(name string) (Role, bool) {
+	role := Role(strings.ToLower(strings.TrimSpace(name)))
+	_, ok := roleLevels[role]
+	return role, ok
+}
+
+// Includes проверяет, что роль дает права роли required
+func (r Role) Includes(required Role) bool {
+	return roleLevels[r] >= roleLevels[required]
+}
+
+// RoleManager хранит роли сотрудников в памяти и в БД
+type RoleManager struct {
+	db      *sql.DB
+	ownerID string
+	roles   map[int64]Role
+	mutex   sync.RWMutex
+}
+
+// NewRoleManager создает менеджер ролей. ownerID — владелец бота из конфигурации (ADMIN_ID)
+func NewRoleManager(db *sql.DB, ownerID string) *RoleManager {
+	return &RoleManager{
+		db:      db,
+		ownerID: ownerID,
+		roles:   make(map[int64]Role),
+	}
+}
+
+// Load загружает выданные роли из БД
+func (rm *RoleManager) Load() error {
+	records, err := storage.GetUserRoles(rm.db)
+	if err != nil {
+		return err
+	}
+
+	roles := make(map[int64]Role, len(records))
+	for _, r := range records {
+		if role, ok := ParseRole(r.Role); ok {
+			roles[r.UserID] = role
+		}
+	}
+
+	rm.mutex.Lock()
+	rm.roles = roles
+	rm.mutex.Unlock()
+	return nil
+}
+
+// RoleOf возвращает роль пользователя
+func (rm *RoleManager) RoleOf(userID int64) Role {
+	if rm.ownerID != "" && rm.ownerID == toStr(userID) {
+		return RoleOwner
+	}
+
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	if role, ok := rm.roles[userID]; ok {
+		return role
+	}
+	return RoleUser
+}
+
+// Grant выдает роль пользователю
+func (rm *RoleManager) Grant(userID int64, role Role, grantedBy int64) error {
+	if err := storage.SetUserRole(rm.db, userID, string(role), grantedBy); err != nil {
+		return err
+	}
+
+	rm.mutex.Lock()
+	rm.roles[userID] = role
+	rm.mutex.Unlock()
+	return nil
+}
+
+// Revoke отзывает роль пользователя
+func (rm *RoleManager) Revoke(userID int64) error {
+	if err := storage.DeleteUserRole(rm.db, userID); err != nil {
+		return err
+	}
+
+	rm.mutex.Lock()
+	delete(rm.roles, userID)
+	rm.mutex.Unlock()
+	return nil
+}
+
+// Staff возвращает всех пользователей с ролями, кроме владельца
+func (rm *RoleManager) Staff() map[int64]Role {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	result := make(map[int64]Role, len(rm.roles))
+	for id, role := range rm.roles {
+		result[id] = role
+	}
+	return result
+}
+
+// hasRole проверяет, что у пользователя есть права роли required
+func (b *Bot) hasRole(user *tele.User, required Role) bool {
+	if user == nil {
+		return false
+	}
+	return b.roles.RoleOf(user.ID).Includes(required)
+}
+
+// requireRole middleware: пропускает к обработчику только пользователей с нужной ролью
+// и логирует попытки доступа без прав
+func (b *Bot) requireRole(required Role, next tele.HandlerFunc) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		if b.hasRole(c.Sender(), required) {
+			return next(c)
+		}
+
+		logger := NewLogger("ACCESS")
+		var userID int64
+		if c.Sender() != nil {
+			userID = c.Sender().ID
+		}
+		action := c.Text()
+		if cb := c.Callback(); cb != nil {
+			action = cb.Data
+		}
+		logger.Warning("Отказано в доступе: user_id=%d, роль=%s, требуется=%s, действие=%q",
+			userID, b.roles.RoleOf(userID), required, action)
+
+		return c.Send(b.i18nManager.T(c.Sender(), "access_denied"))
+	}
+}
+
+// handleGrantCommand выдает роль: /grant <user_id> <role>
+func (b *Bot) handleGrantCommand(c tele.Context) error {
+	logger := NewLogger("ROLES")
+
+	args := commandArgs(c)
+	userID := args.Int64("user_id")
+
+	role, ok := ParseRole(args.String("role"))
+	if !ok || role == RoleUser || role == RoleOwner {
+		return c.Send(b.i18nManager.T(c.Sender(), "roles.invalid_role", i18n.Args{"Roles": rolesList(grantableRoles)}))
+	}
+
+	// Выдавать можно только роли ниже своей и только тем, кто ниже тебя
+	actorRole := b.roles.RoleOf(c.Sender().ID)
+	if roleLevels[role] >= roleLevels[actorRole] || roleLevels[b.roles.RoleOf(userID)] >= roleLevels[actorRole] {
+		logger.Warning("Пользователь %d (%s) пытался выдать роль %s пользователю %d", c.Sender().ID, actorRole, role, userID)
+		return c.Send(b.i18nManager.T(c.Sender(), "roles.forbidden"))
+	}
+
+	if err := b.roles.Grant(userID, role, c.Sender().ID); err != nil {
+		logger.Error("Ошибка выдачи роли %s пользователю %d: %v", role, userID, err)
+		return c.Send(b.i18nManager.T(c.Sender(), "roles.error"))
+	}
+
+	logger.Info("Пользователь %d выдал роль %s пользователю %d", c.Sender().ID, role, userID)
+	go b.publishStaffCommands(userID)
+	return c.Send(b.i18nManager.T(c.Sender(), "roles.granted", i18n.Args{"UserID": userID, "Role": string(role)}))
+}
+
+// handleRevokeCommand отзывает роль: /revoke <user_id>
+func (b *Bot) handleRevokeCommand(c tele.Context) error {
+	logger := NewLogger("ROLES")
+
+	userID := commandArgs(c).Int64("user_id")
+
+	targetRole := b.roles.RoleOf(userID)
+	if targetRole == RoleUser {
+		return c.Send(b.i18nManager.T(c.Sender(), "roles.not_found", i18n.Args{"UserID": userID}))
+	}
+
+	actorRole := b.roles.RoleOf(c.Sender().ID)
+	if roleLevels[targetRole] >= roleLevels[actorRole] {
+		logger.Warning("Пользователь %d (%s) пытался отозвать роль %s у пользователя %d", c.Sender().ID, actorRole, targetRole, userID)
+		return c.Send(b.i18nManager.T(c.Sender(), "roles.forbidden"))
+	}
+
+	if err := b.roles.Revoke(userID); err != nil {
+		logger.Error("Ошибка отзыва роли у пользователя %d: %v", userID, err)
+		return c.Send(b.i18nManager.T(c.Sender(), "roles.error"))
+	}
+
+	logger.Info("Пользователь %d отозвал роль %s у пользователя %d", c.Sender().ID, targetRole, userID)
+	go b.publishStaffCommands(userID)
+	return c.Send(b.i18nManager.T(c.Sender(), "roles.revoked", i18n.Args{"UserID": userID, "Role": string(targetRole)}))
+}
+
+// sendRolesList отправляет список сотрудников и их ролей
+func (b *Bot) sendRolesList(c tele.Context) error {
+	staff := b.roles.Staff()
+	if len(staff) == 0 {
+		return c.Send(b.i18nManager.T(c.Sender(), "roles.empty"))
+	}
+
+	ids := make([]int64, 0, len(staff))
+	for id := range staff {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if staff[ids[i]] != staff[ids[j]] {
+			return roleLevels[staff[ids[i]]] > roleLevels[staff[ids[j]]]
+		}
+		return ids[i] < ids[j]
+	})
+
+	var list strings.Builder
+	for _, id := range ids {
+		list.WriteString(b.i18nManager.T(c.Sender(), "roles.row", i18n.Args{"UserID": id, "Role": string(staff[id])}))
+		list.WriteString("\n")
+	}
+
+	return c.Send(b.i18nManager.T(c.Sender(), "roles.list", i18n.Args{"List": list.String()}))
+}
+
+func rolesList(roles []Role) string {
+	names := make([]string, 0, len(roles))
+	for _, r := range roles {
+		names = append(names, string(r))
+	}
+	return strings.Join(names, ", ")
+}
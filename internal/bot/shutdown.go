@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"context"
+	"strings"
+
+	"YoutubeDownloader/internal/downloader"
+	"YoutubeDownloader/internal/i18n"
+	"YoutubeDownloader/internal/payment"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// shutdown останавливает бота: перестает принимать апдейты, ждет незавершенные
+// скачивания не дольше ShutdownTimeout, прерывает оставшиеся, останавливает
+// служебный HTTP-сервер и удаляет временные файлы процесса. Пул соединений с БД
+// закрывает владелец (main) после возврата из Run
+func (b *Bot) shutdown() {
+	logger := NewLogger("SHUTDOWN")
+
+	logger.Info("Останавливаем получение апдейтов")
+	b.api.Stop()
+
+	if jobs := b.downloadManager.Jobs(); jobs > 0 {
+		logger.Info("Ждем незавершенные скачивания: %d (не дольше %v)", jobs, b.config.ShutdownTimeout)
+		if !b.downloadManager.Drain(b.config.ShutdownTimeout) {
+			logger.Warning("Скачивания не завершились за %v, прерываем: %d", b.config.ShutdownTimeout, b.downloadManager.Jobs())
+			b.downloadManager.Abort()
+			if !b.downloadManager.Drain(ShutdownAbortGrace) {
+				logger.Error("Задачи не завершились после отмены: %d", b.downloadManager.Jobs())
+			}
+		}
+	}
+
+	if b.httpServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), ShutdownAbortGrace)
+		if err := b.httpServer.Shutdown(ctx); err != nil {
+			logger.Warning("Ошибка остановки служебного HTTP-сервера: %v", err)
+		}
+		cancel()
+	}
+
+	if removed, err := downloader.RemoveTempFiles(); err != nil {
+		logger.Warning("Ошибка удаления временных файлов: %v", err)
+	} else if removed > 0 {
+		logger.Info("Удалено временных файлов: %d", removed)
+	}
+
+	logger.Info("Бот остановлен")
+}
+
+// handleInterruptedDownload возвращает оплату в Stars за скачивание, прерванное остановкой
+// бота, и предлагает пользователю повторить запрос. Кредиты возвращаются отдельно
+// (см. refundFailedCredit), задача уже отмечена как failed
+func (b *Bot) handleInterruptedDownload(c tele.Context, chargeID string) {
+	logger := NewLogger("SHUTDOWN").WithContext(requestContext(c))
+	user := c.Sender()
+
+	if chargeID == "" || strings.HasPrefix(chargeID, creditChargePrefix) {
+		b.api.Send(user, b.i18nManager.T(user, "shutdown.interrupted"))
+		return
+	}
+
+	trx, err := payment.GetTransactionByChargeID(b.db, chargeID)
+	if err == nil {
+		err = b.refundTransaction(0, trx, user.ID, ErrShutdown.Error())
+	}
+	if err != nil {
+		logger.Error("Не удалось вернуть оплату за прерванное скачивание: %v", err)
+		b.api.Send(user, b.i18nManager.T(user, "shutdown.interrupted"))
+		return
+	}
+	b.api.Send(user, b.i18nManager.T(user, "shutdown.refunded", i18n.Args{"Amount": trx.Amount}))
+}
@@ -0,0 +1,489 @@
+package bot
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"YoutubeDownloader/internal/i18n"
+	"YoutubeDownloader/internal/storage"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// channelRecipient канал по @username или chat_id для запросов к Bot API
+type channelRecipient string
+
+func (r channelRecipient) Recipient() string { return string(r) }
+
+// NormalizeChannel приводит канал к виду "@username" или "-100..." (chat_id)
+func NormalizeChannel(channel string) string {
+	channel = strings.TrimSpace(channel)
+	channel = strings.TrimPrefix(channel, "https://t.me/")
+	if channel == "" || strings.HasPrefix(channel, "@") || strings.HasPrefix(channel, "-") {
+		return channel
+	}
+	return "@" + channel
+}
+
+// channelLink возвращает ссылку для кнопки подписки на канал
+func channelLink(ch storage.SponsorChannel) string {
+	if ch.InviteLink != "" {
+		return ch.InviteLink
+	}
+	if strings.HasPrefix(ch.Channel, "@") {
+		return "https://t.me/" + strings.TrimPrefix(ch.Channel, "@")
+	}
+	return ""
+}
+
+// channelTitle возвращает название канала для сообщений
+func channelTitle(ch storage.SponsorChannel) string {
+	if ch.Title != "" {
+		return ch.Title
+	}
+	return ch.Channel
+}
+
+// membershipKey ключ кэша проверок подписки
+type membershipKey struct {
+	channel string
+	userID  int64
+}
+
+// cachedMembership результат проверки подписки в кэше
+type cachedMembership struct {
+	member    bool
+	expiresAt time.Time
+}
+
+// SponsorStatus результат проверки подписок пользователя
+type SponsorStatus struct {
+	Passed  bool
+	Missing []storage.SponsorChannel // каналы, на которые нужно подписаться
+}
+
+// SponsorGate проверяет подписку пользователя на каналы спонсоров. Пользователь проходит,
+// если подписан на все обязательные каналы и хотя бы на один необязательный (если такие есть).
+// В каналах, где бот администратор, подписки отслеживаются по chat_member апдейтам, и
+// проверка берет статус из channel_memberships без запроса к Telegram
+type SponsorGate struct {
+	db       *sql.DB
+	api      *tele.Bot
+	legacy   string // CHANNEL_USERNAME: используется, пока список каналов в БД пуст
+	channels []storage.SponsorChannel
+	tracked  map[string]time.Time // канал -> с какого момента приходят chat_member апдейты
+	mutex    sync.RWMutex
+
+	ttl        time.Duration
+	cache      map[membershipKey]cachedMembership
+	cacheMutex sync.Mutex
+}
+
+// NewSponsorGate создает проверку подписок. legacyChannel — канал из CHANNEL_USERNAME
+func NewSponsorGate(db *sql.DB, api *tele.Bot, legacyChannel string, ttl time.Duration) *SponsorGate {
+	return &SponsorGate{
+		db:      db,
+		api:     api,
+		legacy:  NormalizeChannel(legacyChannel),
+		ttl:     ttl,
+		tracked: make(map[string]time.Time),
+		cache:   make(map[membershipKey]cachedMembership),
+	}
+}
+
+// Load загружает список каналов из БД
+func (g *SponsorGate) Load() error {
+	channels, err := storage.GetSponsorChannels(g.db)
+	if err != nil {
+		return err
+	}
+
+	g.mutex.Lock()
+	g.channels = channels
+	g.mutex.Unlock()
+
+	g.refreshTracking()
+	return nil
+}
+
+// refreshTracking проверяет, в каких каналах бот администратор и получает chat_member апдейты.
+// Статусы, записанные до начала отслеживания, могли устареть, поэтому отсчет начинается заново
+func (g *SponsorGate) refreshTracking() {
+	logger := NewLogger("SPONSORS")
+	if g.api.Me == nil {
+		return
+	}
+
+	for _, ch := range g.Channels() {
+		cm, err := g.api.ChatMemberOf(channelRecipient(ch.Channel), g.api.Me)
+		if err != nil {
+			logger.Warning("Не удалось проверить права бота в %s: %v", ch.Channel, err)
+			g.SetTracked(ch.Channel, false)
+			continue
+		}
+		admin := cm.Role == tele.Administrator || cm.Role == tele.Creator
+		if _, ok := g.Tracked(ch.Channel); ok == admin {
+			continue
+		}
+		g.SetTracked(ch.Channel, admin)
+		if admin {
+			logger.Info("Бот администратор в %s — подписки отслеживаются по апдейтам", ch.Channel)
+		} else {
+			logger.Info("Бот не администратор в %s — подписки проверяются запросами к Telegram", ch.Channel)
+		}
+	}
+}
+
+// SetTracked включает или выключает отслеживание подписок канала по апдейтам
+func (g *SponsorGate) SetTracked(channel string, tracked bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if !tracked {
+		delete(g.tracked, channel)
+		return
+	}
+	if _, ok := g.tracked[channel]; !ok {
+		g.tracked[channel] = time.Now()
+	}
+}
+
+// Tracked возвращает, с какого момента подписки канала отслеживаются по апдейтам
+func (g *SponsorGate) Tracked(channel string) (time.Time, bool) {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	since, ok := g.tracked[channel]
+	return since, ok
+}
+
+// Match находит канал спонсора, к которому относится чат из апдейта
+func (g *SponsorGate) Match(chat *tele.Chat) (storage.SponsorChannel, bool) {
+	if chat == nil {
+		return storage.SponsorChannel{}, false
+	}
+	id := strconv.FormatInt(chat.ID, 10)
+	for _, ch := range g.Channels() {
+		if ch.Channel == id || (chat.Username != "" && strings.EqualFold(ch.Channel, "@"+chat.Username)) {
+			return ch, true
+		}
+	}
+	return storage.SponsorChannel{}, false
+}
+
+// Channels возвращает действующий список каналов
+func (g *SponsorGate) Channels() []storage.SponsorChannel {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	if len(g.channels) == 0 && g.legacy != "" {
+		return []storage.SponsorChannel{{Channel: g.legacy, Required: true}}
+	}
+	return append([]storage.SponsorChannel(nil), g.channels...)
+}
+
+// Enabled проверяет, настроен ли хотя бы один канал
+func (g *SponsorGate) Enabled() bool {
+	return len(g.Channels()) > 0
+}
+
+// Save добавляет канал или меняет его настройки
+func (g *SponsorGate) Save(ch *storage.SponsorChannel) error {
+	if err := storage.SaveSponsorChannel(g.db, ch); err != nil {
+		return err
+	}
+	return g.Load()
+}
+
+// Remove удаляет канал. Возвращает false, если канала не было
+func (g *SponsorGate) Remove(channel string) (bool, error) {
+	found, err := storage.DeleteSponsorChannel(g.db, channel)
+	if err != nil || !found {
+		return found, err
+	}
+	return true, g.Load()
+}
+
+// Check проверяет подписки пользователя. force — не использовать кэш (кнопка "Проверить подписку")
+func (g *SponsorGate) Check(userID int64, force bool) (SponsorStatus, error) {
+	var status SponsorStatus
+	var optional []storage.SponsorChannel
+	optionalJoined := false
+
+	for _, ch := range g.Channels() {
+		member, err := g.IsMember(ch.Channel, userID, force)
+		if err != nil {
+			return status, fmt.Errorf("канал %s: %v", ch.Channel, err)
+		}
+
+		switch {
+		case ch.Required && !member:
+			status.Missing = append(status.Missing, ch)
+		case !ch.Required:
+			optional = append(optional, ch)
+			optionalJoined = optionalJoined || member
+		}
+	}
+
+	if len(optional) > 0 && !optionalJoined {
+		status.Missing = append(status.Missing, optional...)
+	}
+	status.Passed = len(status.Missing) == 0
+	return status, nil
+}
+
+// IsMember проверяет подписку пользователя на канал с учетом кэша
+func (g *SponsorGate) IsMember(channel string, userID int64, force bool) (bool, error) {
+	key := membershipKey{channel: channel, userID: userID}
+
+	if !force {
+		g.cacheMutex.Lock()
+		cached, ok := g.cache[key]
+		g.cacheMutex.Unlock()
+		if ok && time.Now().Before(cached.expiresAt) {
+			return cached.member, nil
+		}
+
+		// Канал отслеживается по апдейтам: статус в БД актуален, если записан после начала отслеживания
+		if since, tracked := g.Tracked(channel); tracked {
+			member, checkedAt, found, err := storage.GetChannelMembership(g.db, channel, userID)
+			if err != nil {
+				NewLogger("SPONSORS").Warning("Ошибка чтения подписки %d на %s: %v", userID, channel, err)
+			} else if found && !checkedAt.Before(since) {
+				g.SetMember(channel, userID, member)
+				return member, nil
+			}
+		}
+	}
+
+	cm, err := g.api.ChatMemberOf(channelRecipient(channel), &tele.User{ID: userID})
+	if err != nil {
+		return false, err
+	}
+	member := isChannelMember(cm)
+
+	g.Record(channel, userID, member)
+	return member, nil
+}
+
+// Record сохраняет статус подписки в кэш и в channel_memberships
+func (g *SponsorGate) Record(channel string, userID int64, member bool) {
+	g.SetMember(channel, userID, member)
+	if err := storage.RecordChannelMembership(g.db, channel, userID, member); err != nil {
+		NewLogger("SPONSORS").Warning("Ошибка сохранения подписки %d на %s: %v", userID, channel, err)
+	}
+}
+
+// SetMember обновляет кэш подписки пользователя на канал
+func (g *SponsorGate) SetMember(channel string, userID int64, member bool) {
+	g.cacheMutex.Lock()
+	defer g.cacheMutex.Unlock()
+
+	g.cache[membershipKey{channel: channel, userID: userID}] = cachedMembership{member: member, expiresAt: time.Now().Add(g.ttl)}
+
+	// Заодно убираем устаревшие записи, чтобы кэш не рос бесконечно
+	if len(g.cache) > 10000 {
+		now := time.Now()
+		for k, v := range g.cache {
+			if now.After(v.expiresAt) {
+				delete(g.cache, k)
+			}
+		}
+	}
+}
+
+// isChannelMember определяет подписку по статусу участника канала
+func isChannelMember(cm *tele.ChatMember) bool {
+	switch cm.Role {
+	case tele.Member, tele.Administrator, tele.Creator:
+		return true
+	case tele.Restricted:
+		return cm.Member
+	default:
+		return false
+	}
+}
+
+// sponsorKeyboard формирует клавиатуру "подпишитесь на эти каналы" с кнопкой проверки
+func (b *Bot) sponsorKeyboard(user *tele.User, channels []storage.SponsorChannel) *tele.ReplyMarkup {
+	var rows [][]tele.InlineButton
+	for _, ch := range channels {
+		link := channelLink(ch)
+		if link == "" {
+			continue
+		}
+		rows = append(rows, []tele.InlineButton{{
+			Text: b.i18nManager.T(user, "sponsors.channel_button", i18n.Args{"Title": channelTitle(ch)}),
+			URL:  link,
+		}})
+	}
+	rows = append(rows, []tele.InlineButton{{
+		Text: b.i18nManager.T(user, "check_subscription"),
+		Data: "check_subscription",
+	}})
+	return &tele.ReplyMarkup{InlineKeyboard: rows}
+}
+
+// sponsorMessage описывает, на какие каналы нужно подписаться
+func (b *Bot) sponsorMessage(user *tele.User, channels []storage.SponsorChannel) string {
+	var required, optional []string
+	for _, ch := range channels {
+		if ch.Required {
+			required = append(required, "• "+channelTitle(ch))
+		} else {
+			optional = append(optional, "• "+channelTitle(ch))
+		}
+	}
+
+	parts := []string{b.i18nManager.T(user, "sponsors.subscribe_header")}
+	if len(required) > 0 {
+		parts = append(parts, b.i18nManager.T(user, "sponsors.required", i18n.Args{"List": strings.Join(required, "\n")}))
+	}
+	if len(optional) > 0 {
+		parts = append(parts, b.i18nManager.T(user, "sponsors.optional", i18n.Args{"List": strings.Join(optional, "\n")}))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// handleSponsorsCommand управляет каналами спонсоров:
+// /sponsors — список и конверсии, /sponsors add <канал> [required|optional] [ссылка],
+// /sponsors rule <канал> required|optional, /sponsors remove <канал>
+func (b *Bot) handleSponsorsCommand(c tele.Context) error {
+	logger := NewLogger("SPONSORS")
+	args := commandArgs(c)
+	user := c.Sender()
+	fields := strings.Fields(args.String("params"))
+
+	switch strings.ToLower(args.String("action")) {
+	case "":
+		return b.sendSponsorList(c)
+	case "add":
+		if len(fields) < 1 || len(fields) > 3 {
+			return c.Send(b.i18nManager.T(user, "sponsors.usage"))
+		}
+		ch := &storage.SponsorChannel{Channel: NormalizeChannel(fields[0]), Required: true, AddedBy: user.ID}
+		for _, f := range fields[1:] {
+			switch strings.ToLower(f) {
+			case "required":
+				ch.Required = true
+			case "optional":
+				ch.Required = false
+			default:
+				ch.InviteLink = f
+			}
+		}
+
+		chat, err := b.api.ChatByUsername(ch.Channel)
+		if err != nil {
+			return c.Send(b.i18nManager.T(user, "channel_test.not_found", i18n.Args{"Channel": ch.Channel, "Error": err.Error()}))
+		}
+		ch.Title = chat.Title
+		if channelLink(*ch) == "" {
+			return c.Send(b.i18nManager.T(user, "sponsors.link_required"))
+		}
+
+		if err := b.sponsors.Save(ch); err != nil {
+			logger.Error("Ошибка сохранения канала %s: %v", ch.Channel, err)
+			return c.Send(b.i18nManager.T(user, "sponsors.error"))
+		}
+		logger.Info("Админ %d добавил канал спонсора %s (обязательный: %t)", user.ID, ch.Channel, ch.Required)
+		return c.Send(b.i18nManager.T(user, "sponsors.added", i18n.Args{"Channel": channelTitle(*ch)}))
+	case "rule":
+		if len(fields) != 2 {
+			return c.Send(b.i18nManager.T(user, "sponsors.usage"))
+		}
+		channel := NormalizeChannel(fields[0])
+		var found *storage.SponsorChannel
+		for _, ch := range b.sponsors.Channels() {
+			if ch.Channel == channel && ch.AddedBy != 0 {
+				found = &ch
+				break
+			}
+		}
+		if found == nil {
+			return c.Send(b.i18nManager.T(user, "sponsors.not_found", i18n.Args{"Channel": channel}))
+		}
+		switch strings.ToLower(fields[1]) {
+		case "required":
+			found.Required = true
+		case "optional":
+			found.Required = false
+		default:
+			return c.Send(b.i18nManager.T(user, "sponsors.usage"))
+		}
+		if err := b.sponsors.Save(found); err != nil {
+			logger.Error("Ошибка сохранения канала %s: %v", channel, err)
+			return c.Send(b.i18nManager.T(user, "sponsors.error"))
+		}
+		logger.Info("Админ %d изменил правило канала %s (обязательный: %t)", user.ID, channel, found.Required)
+		return b.sendSponsorList(c)
+	case "remove":
+		if len(fields) != 1 {
+			return c.Send(b.i18nManager.T(user, "sponsors.usage"))
+		}
+		channel := NormalizeChannel(fields[0])
+		found, err := b.sponsors.Remove(channel)
+		if err != nil {
+			logger.Error("Ошибка удаления канала %s: %v", channel, err)
+			return c.Send(b.i18nManager.T(user, "sponsors.error"))
+		}
+		if !found {
+			return c.Send(b.i18nManager.T(user, "sponsors.not_found", i18n.Args{"Channel": channel}))
+		}
+		logger.Info("Админ %d удалил канал спонсора %s", user.ID, channel)
+		return c.Send(b.i18nManager.T(user, "sponsors.removed", i18n.Args{"Channel": channel}))
+	default:
+		return c.Send(b.i18nManager.T(user, "sponsors.usage"))
+	}
+}
+
+// sendSponsorList показывает каналы спонсоров с конверсиями
+func (b *Bot) sendSponsorList(c tele.Context) error {
+	user := c.Sender()
+	channels := b.sponsors.Channels()
+	if len(channels) == 0 {
+		return c.Send(strings.Join([]string{
+			b.i18nManager.T(user, "sponsors.empty"),
+			b.i18nManager.T(user, "sponsors.usage"),
+		}, "\n\n"))
+	}
+
+	conversions, err := storage.GetSponsorConversions(b.db)
+	if err != nil {
+		NewLogger("SPONSORS").Warning("Ошибка получения конверсий: %v", err)
+	}
+
+	lines := []string{b.i18nManager.T(user, "sponsors.list_header")}
+	for _, ch := range channels {
+		rule := b.i18nManager.T(user, "sponsors.rule_optional")
+		if ch.Required {
+			rule = b.i18nManager.T(user, "sponsors.rule_required")
+		}
+		updates := b.i18nManager.T(user, "sponsors.updates_off")
+		if _, tracked := b.sponsors.Tracked(ch.Channel); tracked {
+			updates = b.i18nManager.T(user, "sponsors.updates_on")
+		}
+		conv := conversions[ch.Channel]
+		rate := "—"
+		if conv.Prompted > 0 {
+			rate = strconv.FormatFloat(float64(conv.Converted)*100/float64(conv.Prompted), 'f', 1, 64) + "%"
+		}
+		lines = append(lines, b.i18nManager.T(user, "sponsors.list_row", i18n.Args{
+			"Channel":   ch.Channel,
+			"Title":     channelTitle(ch),
+			"Rule":      rule,
+			"Prompted":  conv.Prompted,
+			"Converted": conv.Converted,
+			"Rate":      rate,
+			"Members":   conv.Members,
+			"Churned":   conv.Churned,
+			"Updates":   updates,
+		}))
+	}
+	lines = append(lines, "", b.i18nManager.T(user, "sponsors.usage"))
+	return c.Send(strings.Join(lines, "\n"), tele.NoPreview)
+}
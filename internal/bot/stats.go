@@ -5,16 +5,19 @@ import (
 	"time"
 )
 
-// Обновить статистику пользователя (увеличить счетчик сообщений, обновить last_active)
-func UpdateUserStats(db *sql.DB, userID int64) error {
-	_, err := db.Exec(`
+// Обновить статистику пользователя (увеличить счетчик сообщений, обновить last_active).
+// Возвращает true, если пользователь записан впервые
+func UpdateUserStats(db *sql.DB, userID int64) (bool, error) {
+	var created bool
+	err := db.QueryRow(`
 		INSERT INTO user_stats (user_id, messages, last_active, created_at)
 		VALUES ($1, 1, $2, $2)
 		ON CONFLICT (user_id) DO UPDATE SET
 			messages = user_stats.messages + 1,
 			last_active = $2
-	`, userID, time.Now())
-	return err
+		RETURNING xmax = 0 -- xmax равен 0 только у строки, вставленной этим запросом
+	`, userID, time.Now()).Scan(&created)
+	return created, err
 }
 
 // Обновить недельную активность пользователя
@@ -27,18 +30,10 @@ func UpdateWeeklyUserActivity(db *sql.DB, userID int64) error {
 	return err
 }
 
-// Увеличить общее количество пользователей, если пользователь новый
-func IncrementTotalUsersIfNew(db *sql.DB, userID int64) error {
-	var exists bool
-	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_stats WHERE user_id = $1)`, userID).Scan(&exists)
-	if err != nil {
-		return err
-	}
-	if !exists {
-		_, err := db.Exec(`UPDATE total_stats SET total_users = total_users + 1, updated_at = $1 WHERE id = 1`, time.Now())
-		return err
-	}
-	return nil
+// Увеличить общее количество пользователей
+func IncrementTotalUsers(db *sql.DB) error {
+	_, err := db.Exec(`UPDATE total_stats SET total_users = total_users + 1, updated_at = $1 WHERE id = 1`, time.Now())
+	return err
 }
 
 // Увеличить счетчик сообщений в общей статистике
@@ -56,3 +51,13 @@ func IncrementDownloads(db *sql.DB, userID int64) error {
 	_, err = db.Exec(`UPDATE total_stats SET total_downloads = total_downloads + 1, updated_at = $1 WHERE id = 1`, time.Now())
 	return err
 }
+
+// Получить общее количество скачиваний пользователя
+func GetUserDownloads(db *sql.DB, userID int64) (int64, error) {
+	var downloads int64
+	err := db.QueryRow(`SELECT COALESCE(downloads, 0) FROM user_stats WHERE user_id = $1`, userID).Scan(&downloads)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return downloads, err
+}
@@ -1,37 +1,40 @@
 package bot
 
 import (
+	"context"
 	"database/sql"
+	"net/http"
 	"sync"
 	"time"
 
+	"YoutubeDownloader/internal/config"
+	"YoutubeDownloader/internal/health"
 	"YoutubeDownloader/internal/i18n"
-	"YoutubeDownloader/internal/payment"
+	"YoutubeDownloader/internal/pricing"
 
 	tele "gopkg.in/telebot.v4"
 )
 
-// BotConfig содержит конфигурацию бота
-type BotConfig struct {
-	Token           string
-	AdminID         string
-	ProviderToken   string
-	ChannelUsername string
-	MaxWorkers      int
-	UseOfficialAPI  bool
-	TelegramAPIURL  string
-	HTTPTimeout     time.Duration
-	DownloadTimeout time.Duration
-}
-
 // Bot представляет основную структуру бота
 type Bot struct {
-	api                *tele.Bot
-	config             *BotConfig
-	transactionService *payment.TransactionService
-	downloadManager    *DownloadManager
-	db                 *sql.DB
-	i18nManager        *i18n.Manager
+	api             *tele.Bot
+	apiClient       *http.Client // HTTP-клиент api; нужен для запросов с контекстом
+	config          *config.Config
+	downloadManager *DownloadManager
+	db              *sql.DB
+	i18nManager     *i18n.Manager
+	roles           *RoleManager
+	commands        *CommandRegistry
+	pricing         *pricing.Manager
+	sponsors        *SponsorGate
+	httpServer      *http.Server
+	health          *health.Checker
+	startedAt       time.Time
+
+	trxSessions      map[string]*trxSession
+	trxSessionsMutex sync.Mutex
+
+	broadcastWake chan struct{} // сигнал обработчику рассылок о новой подтвержденной рассылке
 }
 
 // DownloadManager управляет скачиваниями
@@ -41,6 +44,14 @@ type DownloadManager struct {
 	mutexMutex      sync.RWMutex
 	activeDownloads map[string]*DownloadInfo
 	downloadMutex   sync.RWMutex
+	queued          int32 // задачи, ожидающие свободный слот
+
+	jobsMutex sync.Mutex
+	jobs      int           // запущенные через Go задачи
+	idle      chan struct{} // закрывается, когда jobs становится 0
+
+	stopCtx context.Context // отменяется Abort при остановке бота
+	abort   context.CancelCauseFunc
 }
 
 // DownloadInfo содержит информацию об активном скачивании
@@ -80,34 +91,79 @@ type AdminHandler struct {
 
 // Constants
 const (
-	DefaultMaxWorkers      = 3
-	DefaultHTTPTimeout     = 120 * time.Second
-	DefaultDownloadTimeout = 300 * time.Second
-	DefaultPollerTimeout   = 60 * time.Second
+	DefaultPollerTimeout = 60 * time.Second
+
+	HistoryLimit = 10
+
+	PriceProbeTimeout = 20 * time.Second // получение метаданных видео для расчета цены
+
+	HealthCheckTimeout = 5 * time.Second  // ограничение на одну проверку зависимости
+	HealthCacheTTL     = 10 * time.Second // сколько отдавать /readyz без повторных проверок
+
+	ShutdownAbortGrace = 10 * time.Second // сколько ждать прерванные задачи после отмены
 )
 
 // Command constants
 const (
-	CmdStart           = "/start"
-	CmdAdmin           = "/admin"
-	CmdTestInvoice     = "/test_invoice"
-	CmdTestPreCheckout = "/test_precheckout"
-	CmdBotInfo         = "/bot_info"
-	CmdTestDirect      = "/test_direct"
-	CmdAPIInfo         = "/api_info"
-	CmdCacheStats      = "/cache_stats"
-	CmdCacheClean      = "/cache_clean"
-	CmdCacheClear      = "/cache_clear"
-	CmdActiveDownloads = "/active_downloads"
-	CmdRefund          = "/refund"
+	CmdStart            = "/start"
+	CmdHelp             = "/help"
+	CmdAdmin            = "/admin"
+	CmdTestInvoice      = "/test_invoice"
+	CmdTestPreCheckout  = "/test_precheckout"
+	CmdBotInfo          = "/bot_info"
+	CmdTestDirect       = "/test_direct"
+	CmdAPIInfo          = "/api_info"
+	CmdCacheStats       = "/cache_stats"
+	CmdCacheClean       = "/cache_clean"
+	CmdCacheClear       = "/cache_clear"
+	CmdActiveDownloads  = "/active_downloads"
+	CmdRefund           = "/refund"
+	CmdLanguage         = "/language"
+	CmdReloadI18n       = "/reload_i18n"
+	CmdGrant            = "/grant"
+	CmdRevoke           = "/revoke"
+	CmdRoles            = "/roles"
+	CmdStats            = "/stats"
+	CmdUserStats        = "/userstats"
+	CmdWeeklyStats      = "/weeklystats"
+	CmdAnalytics        = "/analytics"
+	CmdRetention        = "/retention"
+	CmdFunnel           = "/funnel"
+	CmdDigest           = "/digest"
+	CmdRevenue          = "/revenue"
+	CmdBroadcast        = "/broadcast"
+	CmdUnsubscribeNews  = "/unsubscribe_news"
+	CmdSubscribeNews    = "/subscribe_news"
+	CmdConfig           = "/config"
+	CmdFixChannel       = "/fix_channel"
+	CmdTestSubscription = "/test_subscription"
+	CmdTestChannel      = "/test_channel"
+	CmdHistory          = "/history"
+	CmdStatus           = "/status"
+	CmdMyDownloads      = "/mydownloads"
+	CmdPrices           = "/prices"
+	CmdPromo            = "/promo"
+	CmdPromos           = "/promos"
+	CmdCredits          = "/credits"
+	CmdReferral         = "/referral"
+	CmdSponsors         = "/sponsors"
+	CmdHealth           = "/health"
 )
 
 // Callback constants
 const (
+	CallbackPayPlan  = "pay_plan"
+	CallbackPayVideo = "pay_video"
+
+	// Кнопки подписок из сообщений, отправленных до появления таблицы цен
 	CallbackPaySubscribe        = "pay_subscribe"
 	CallbackPaySubscribeYear    = "pay_subscribe_year"
 	CallbackPaySubscribeForever = "pay_subscribe_forever"
-	CallbackPayVideo            = "pay_video"
 
-	CallbackAdminRefund = "admin_refund"
+	CallbackAdminRefund = "admin_refund" // кнопки старого меню транзакций
+	CallbackAdminTrx    = "adm_trx"
+
+	CallbackSetLanguage = "set_language"
+	CallbackResend      = "resend"
+	CallbackBroadcast   = "bcast" // подтверждение рассылки: bcast|send|<id>, bcast|cancel|<id>
 )
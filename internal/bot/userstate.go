@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"errors"
+
+	"YoutubeDownloader/internal/storage"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// userStateFromError состояние пользователя по ошибке отправки: 403 от Telegram означает,
+// что писать ему больше нельзя. Пустая строка — ошибка не связана с пользователем
+func userStateFromError(err error) string {
+	switch {
+	case errors.Is(err, tele.ErrBlockedByUser):
+		return storage.UserBlocked
+	case errors.Is(err, tele.ErrUserIsDeactivated):
+		return storage.UserDeactivated
+	}
+	return ""
+}
+
+// noteSendError отмечает пользователя заблокировавшим бота или удалившим аккаунт,
+// если отправка ему завершилась 403. Возвращает true для таких ошибок
+func (b *Bot) noteSendError(userID int64, err error) bool {
+	state := userStateFromError(err)
+	if state == "" {
+		return false
+	}
+	b.setUserState(userID, state)
+	return true
+}
+
+// setUserState сохраняет состояние пользователя (my_chat_member, ошибки отправки)
+func (b *Bot) setUserState(userID int64, state string) {
+	prev, err := storage.SetUserState(b.db, userID, state)
+	if err != nil {
+		NewLogger("USERS").Warning("%v", err)
+		return
+	}
+	b.userStateChanged(userID, prev, state)
+}
+
+// userStateChanged логирует смену состояния; возвращение пользователя после блокировки
+// записывается событием reactivated
+func (b *Bot) userStateChanged(userID int64, prev, state string) {
+	if prev == state {
+		return
+	}
+	NewLogger("USERS").Info("Пользователь %d: %s -> %s", userID, prev, state)
+	if state == storage.UserActive {
+		b.trackEvent(storage.Event{UserID: userID, Type: storage.EventReactivated, Plan: prev})
+	}
+}
+
+// handlePrivateChatMember обрабатывает my_chat_member из личного чата: пользователь
+// остановил бота (kicked) или снова запустил его (member)
+func (b *Bot) handlePrivateChatMember(upd *tele.ChatMemberUpdate) {
+	switch upd.NewChatMember.Role {
+	case tele.Kicked:
+		b.setUserState(upd.Chat.ID, storage.UserBlocked)
+	case tele.Member:
+		b.setUserState(upd.Chat.ID, storage.UserActive)
+	}
+}
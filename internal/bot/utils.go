@@ -4,6 +4,7 @@ import (
 	"YoutubeDownloader/internal/downloader"
 	"YoutubeDownloader/internal/payment"
 	"YoutubeDownloader/internal/storage"
+	"context"
 	"crypto/rand"
 	"database/sql"
 	"fmt"
@@ -11,8 +12,6 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
-
-	tele "gopkg.in/telebot.v4"
 )
 
 // GenerateRequestID генерирует уникальный ID для запроса
@@ -22,22 +21,6 @@ func GenerateRequestID() string {
 	return fmt.Sprintf("%x", b)
 }
 
-// UpdateTransactionStatus обновляет статус транзакции
-func UpdateTransactionStatus(db interface{}, chargeID, status string) error {
-	sqlDB, ok := db.(*sql.DB)
-	if !ok {
-		return fmt.Errorf("неверный тип БД")
-	}
-
-	// Обновляем статус транзакции по charge_id
-	_, err := sqlDB.Exec(`UPDATE transactions SET status = $1, updated_at = NOW() WHERE telegram_payment_charge_id = $2`, status, chargeID)
-	if err != nil {
-		return fmt.Errorf("ошибка обновления статуса транзакции: %v", err)
-	}
-
-	return nil
-}
-
 // SaveTransactionToDB сохраняет транзакцию в БД
 func SaveTransactionToDB(db interface{}, trx interface{}) (int64, error) {
 	sqlDB, ok := db.(*sql.DB)
@@ -59,7 +42,7 @@ func SaveTransactionToDB(db interface{}, trx interface{}) (int64, error) {
 	}
 
 	// Создаем pending транзакцию
-	id, err := payment.CreatePendingTransaction(sqlDB, transaction.TelegramUserID, transaction.Amount, url)
+	id, err := payment.CreatePendingTransaction(sqlDB, transaction.TelegramUserID, transaction.Amount, url, transaction.PricingRule)
 	if err != nil {
 		return 0, fmt.Errorf("ошибка сохранения транзакции: %v", err)
 	}
@@ -111,10 +94,10 @@ func SaveVideoToCache(db interface{}, cacheKey, fileID string) error {
 	return nil
 }
 
-// DownloadVideo скачивает видео
-func DownloadVideo(url string) (string, error) {
+// DownloadVideo скачивает видео; поля запроса из ctx попадают в логи загрузчика
+func DownloadVideo(ctx context.Context, url string) (string, error) {
 	// Используем реальную функцию скачивания из пакета downloader
-	return downloader.DownloadYouTubeVideo(url)
+	return downloader.DownloadVideo(ctx, url)
 }
 
 // GetVideoInfo получает информацию о видео
@@ -188,72 +171,3 @@ type CachedVideo struct {
 	FileSize int64
 	Duration string
 }
-
-// CheckUserSubscription проверяет подписку пользователя на канал
-func CheckUserSubscription(bot interface{}, channelUsername string, userID int64) (bool, error) {
-	// Убираем @ если есть
-	channelUsername = strings.TrimPrefix(channelUsername, "@")
-
-	// Логируем проверку подписки
-	fmt.Printf("[SUBSCRIPTION] Проверяем подписку пользователя %d на канал %s\n", userID, channelUsername)
-
-	// Пытаемся получить реальный bot объект
-	teleBot, ok := bot.(*tele.Bot)
-	if !ok {
-		fmt.Printf("[SUBSCRIPTION] ОШИБКА: неверный тип bot объекта\n")
-		return false, fmt.Errorf("неверный тип bot объекта")
-	}
-
-	fmt.Printf("[SUBSCRIPTION] Bot объект получен успешно\n")
-
-	// Сначала проверяем, существует ли канал
-	fmt.Printf("[SUBSCRIPTION] Ищем канал: %s\n", channelUsername)
-	chat, err := teleBot.ChatByUsername(channelUsername)
-	if err != nil {
-		fmt.Printf("[SUBSCRIPTION] ОШИБКА: не удалось найти канал %s: %v\n", channelUsername, err)
-		return false, fmt.Errorf("не удалось найти канал %s: %v (возможно, канал не существует или бот не добавлен)", channelUsername, err)
-	}
-
-	fmt.Printf("[SUBSCRIPTION] Канал найден: %s (ID: %d)\n", chat.Username, chat.ID)
-
-	// Проверяем, является ли бот администратором канала
-	fmt.Printf("[SUBSCRIPTION] Проверяем права бота в канале\n")
-	botMember, err := teleBot.ChatMemberOf(chat, &tele.User{ID: teleBot.Me.ID})
-	if err != nil {
-		fmt.Printf("[SUBSCRIPTION] ОШИБКА: не удалось проверить права бота в канале %s: %v\n", channelUsername, err)
-		return false, fmt.Errorf("не удалось проверить права бота в канале %s: %v", channelUsername, err)
-	}
-
-	fmt.Printf("[SUBSCRIPTION] Роль бота в канале: %s\n", botMember.Role)
-
-	// Проверяем, есть ли у бота права на просмотр участников
-	if botMember.Role != "administrator" && botMember.Role != "creator" {
-		fmt.Printf("[SUBSCRIPTION] ОШИБКА: бот не является администратором канала %s (текущая роль: %s)\n", channelUsername, botMember.Role)
-		return false, fmt.Errorf("бот не является администратором канала %s (текущая роль: %s)", channelUsername, botMember.Role)
-	}
-
-	// Делаем реальную проверку через Telegram API
-	fmt.Printf("[SUBSCRIPTION] Проверяем статус пользователя %d в канале\n", userID)
-	chatMember, err := teleBot.ChatMemberOf(chat, &tele.User{ID: userID})
-	if err != nil {
-		fmt.Printf("[SUBSCRIPTION] ОШИБКА: ошибка проверки подписки пользователя %d в канале %s: %v\n", userID, channelUsername, err)
-		return false, fmt.Errorf("ошибка проверки подписки пользователя %d в канале %s: %v", userID, channelUsername, err)
-	}
-
-	// Проверяем статус пользователя
-	// Статусы: "creator", "administrator", "member" - подписан
-	// Статусы: "left", "kicked" - не подписан
-	fmt.Printf("[SUBSCRIPTION] Статус пользователя %d в канале %s: %s\n", userID, channelUsername, chatMember.Role)
-
-	switch chatMember.Role {
-	case "creator", "administrator", "member":
-		fmt.Printf("[SUBSCRIPTION] Пользователь %d ПОДПИСАН на канал %s (статус: %s)\n", userID, channelUsername, chatMember.Role)
-		return true, nil
-	case "left", "kicked":
-		fmt.Printf("[SUBSCRIPTION] Пользователь %d НЕ подписан на канал %s (статус: %s)\n", userID, channelUsername, chatMember.Role)
-		return false, nil
-	default:
-		fmt.Printf("[SUBSCRIPTION] Неизвестный статус пользователя %d в канале %s: %s\n", userID, channelUsername, chatMember.Role)
-		return false, fmt.Errorf("неизвестный статус пользователя: %s", chatMember.Role)
-	}
-}
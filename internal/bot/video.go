@@ -1,38 +1,49 @@
 package bot
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"YoutubeDownloader/internal/i18n"
+	"YoutubeDownloader/internal/logging"
+	"YoutubeDownloader/internal/metrics"
 	"YoutubeDownloader/internal/payment"
+	"YoutubeDownloader/internal/pricing"
 	"YoutubeDownloader/internal/storage"
 
 	tele "gopkg.in/telebot.v4"
 )
 
-// sendUniversalPayKeyboard отправляет универсальную платежную клавиатуру
-func (b *Bot) sendUniversalPayKeyboard(c tele.Context, url string) error {
-	logger := NewLogger("PAYMENT")
+// createVideoTransaction рассчитывает цену видео и создает pending транзакцию с этой ценой
+func (b *Bot) createVideoTransaction(c tele.Context, url string) (int64, pricing.Quote, error) {
+	quote := b.quoteVideo(url)
 
-	// Создаем транзакцию для видео
 	trx := &payment.Transaction{
 		InvoicePayload:          "video|" + url,
-		Amount:                  1, // 1 XTR
+		Amount:                  quote.Price,
 		TelegramUserID:          c.Sender().ID,
 		Status:                  "pending",
 		TelegramPaymentChargeID: "",
+		PricingRule:             quote.RuleID,
 	}
 
 	// Сохраняем транзакцию в БД
 	id, err := SaveTransactionToDB(b.db, trx)
+	return id, quote, err
+}
+
+// sendUniversalPayKeyboard отправляет универсальную платежную клавиатуру
+func (b *Bot) sendUniversalPayKeyboard(c tele.Context, url string) error {
+	logger := NewLogger("PAYMENT")
+
+	id, quote, err := b.createVideoTransaction(c, url)
 	if err != nil {
 		logger.Error("Ошибка сохранения транзакции: %v", err)
+		b.trackPaymentError(c.Sender().ID, paymentStageTransaction)
 		return c.Send(b.i18nManager.T(c.Sender(), "payment_error"))
 	}
 
@@ -40,74 +51,63 @@ func (b *Bot) sendUniversalPayKeyboard(c tele.Context, url string) error {
 	markup := &tele.ReplyMarkup{InlineKeyboard: [][]tele.InlineButton{
 		{
 			{
-				Text: b.i18nManager.T(c.Sender(), "pay_1_star"),
+				Text: b.i18nManager.T(c.Sender(), "pay_video", i18n.Args{"Price": quote.Price}),
 				Data: CallbackPayVideo + "|" + strconv.FormatInt(id, 10),
 			},
 		},
 	}}
 
 	logger.Info("Отправлена платежная клавиатура для URL: %s", url)
-	return c.Send(b.i18nManager.T(c.Sender(), "payment_required"), markup)
+	b.trackEvent(storage.Event{UserID: c.Sender().ID, Type: storage.EventPaywallShown, Plan: quote.RuleID, Amount: quote.Price})
+	return c.Send(b.i18nManager.T(c.Sender(), "payment_required", i18n.Args{"Price": quote.Price}), markup)
 }
 
 // sendPaymentKeyboardWithSubscriptions отправляет платежную клавиатуру с опциями подписки
 func (b *Bot) sendPaymentKeyboardWithSubscriptions(c tele.Context, url string) error {
 	logger := NewLogger("PAYMENT")
+	user := c.Sender()
 
-	// Создаем транзакцию для видео
-	trx := &payment.Transaction{
-		InvoicePayload:          "video|" + url,
-		Amount:                  1, // 1 XTR
-		TelegramUserID:          c.Sender().ID,
-		Status:                  "pending",
-		TelegramPaymentChargeID: "",
-	}
-
-	// Сохраняем транзакцию в БД
-	id, err := SaveTransactionToDB(b.db, trx)
+	id, quote, err := b.createVideoTransaction(c, url)
 	if err != nil {
 		logger.Error("Ошибка сохранения транзакции: %v", err)
-		return c.Send(b.i18nManager.T(c.Sender(), "payment_error"))
+		b.trackPaymentError(user.ID, paymentStageTransaction)
+		return c.Send(b.i18nManager.T(user, "payment_error"))
 	}
 
 	// Создаем инлайн клавиатуру с опциями подписки
-	markup := &tele.ReplyMarkup{InlineKeyboard: [][]tele.InlineButton{
+	keyboard := [][]tele.InlineButton{
 		{
 			{
-				Text: b.i18nManager.T(c.Sender(), "subscribe_free"),
+				Text: b.i18nManager.T(user, "subscribe_free"),
 				Data: "subscribe_channel",
 			},
 		},
 		{
 			{
-				Text: b.i18nManager.T(c.Sender(), "pay_1_star"),
+				Text: b.i18nManager.T(user, "pay_video", i18n.Args{"Price": quote.Price}),
 				Data: CallbackPayVideo + "|" + strconv.FormatInt(id, 10),
 			},
 		},
-		{
-			{
-				Text: b.i18nManager.T(c.Sender(), "monthly_subscription"),
-				Data: CallbackPaySubscribe,
-			},
-		},
-		{
-			{
-				Text: b.i18nManager.T(c.Sender(), "yearly_subscription"),
-				Data: CallbackPaySubscribeYear,
-			},
-		},
-		{
-			{
-				Text: b.i18nManager.T(c.Sender(), "forever_subscription"),
-				Data: CallbackPaySubscribeForever,
-			},
-		},
-	}}
+	}
+	lines := []string{
+		b.i18nManager.T(user, "pricing.options_header"),
+		"",
+		b.i18nManager.T(user, "pricing.options_video", i18n.Args{"Price": quote.Price}),
+	}
 
-	message := b.i18nManager.T(c.Sender(), "payment_options_message")
+	for _, plan := range b.pricing.Table().Plans {
+		name := b.planName(user, plan)
+		keyboard = append(keyboard, []tele.InlineButton{{
+			Text: b.i18nManager.T(user, "pricing.plan_button", i18n.Args{"Name": name, "Price": plan.Price}),
+			Data: CallbackPayPlan + "|" + plan.ID,
+		}})
+		lines = append(lines, b.i18nManager.T(user, "pricing.options_plan", i18n.Args{"Name": name, "Price": plan.Price}))
+	}
+	lines = append(lines, "", b.i18nManager.T(user, "pricing.options_footer"))
 
-	logger.Info("Отправлена платежная клавиатура с подписками для URL: %s", url)
-	return c.Send(message, markup)
+	logger.Info("Отправлена платежная клавиатура с подписками для URL: %s (%d XTR, правило %s)", url, quote.Price, quote.RuleID)
+	b.trackEvent(storage.Event{UserID: user.ID, Type: storage.EventPaywallShown, Plan: quote.RuleID, Amount: quote.Price})
+	return c.Send(strings.Join(lines, "\n"), &tele.ReplyMarkup{InlineKeyboard: keyboard})
 }
 
 // sendVideoInvoiceByDB отправляет инвойс для видео из БД
@@ -117,62 +117,50 @@ func (b *Bot) sendVideoInvoiceByDB(c tele.Context, trx *payment.Transaction) err
 	invoice := &tele.Invoice{
 		Title:       b.i18nManager.T(c.Sender(), "video_download_title"),
 		Description: b.i18nManager.T(c.Sender(), "video_download_description"),
-		Payload:     trx.InvoicePayload,
+		Payload:     fmt.Sprintf("trx|%d", trx.ID), // URL может не поместиться в 128 байт payload
 		Currency:    "XTR",
 		Prices:      []tele.Price{{Label: b.i18nManager.T(c.Sender(), "download_star_label"), Amount: trx.Amount}},
 	}
 
-	logger.Info("Отправляем инвойс для видео: %s", trx.InvoicePayload)
+	logger.Info("Отправляем инвойс для видео по транзакции %d: %s", trx.ID, trx.URL)
 
 	// Для Telegram Stars отправляем без provider token
 	_, err := b.api.Send(c.Sender(), invoice)
 	if err != nil {
 		logger.Error("Ошибка отправки инвойса: %v", err)
-		return c.Send(b.i18nManager.T(c.Sender(), "invoice_error", err))
+		b.trackPaymentError(c.Sender().ID, paymentStageInvoice)
+		return c.Send(b.i18nManager.T(c.Sender(), "invoice_error", i18n.Args{"Error": err.Error()}))
 	}
 
 	return nil
 }
 
-// sendSubscribeInvoice отправляет инвойс для подписки
-func (b *Bot) sendSubscribeInvoice(c tele.Context, period string) error {
+// sendSubscribeInvoice отправляет инвойс для подписки по плану из таблицы цен
+func (b *Bot) sendSubscribeInvoice(c tele.Context, planID string) error {
 	logger := NewLogger("SUBSCRIBE")
 
-	var title, description string
-	var amount int
-
-	switch period {
-	case "month":
-		title = b.i18nManager.T(c.Sender(), "subscription_month")
-		description = b.i18nManager.T(c.Sender(), "subscription_month_desc")
-		amount = 5
-	case "year":
-		title = b.i18nManager.T(c.Sender(), "subscription_year")
-		description = b.i18nManager.T(c.Sender(), "subscription_year_desc")
-		amount = 50
-	case "forever":
-		title = b.i18nManager.T(c.Sender(), "subscription_forever")
-		description = b.i18nManager.T(c.Sender(), "subscription_forever_desc")
-		amount = 100
-	default:
+	plan, ok := b.pricing.Table().Plan(planID)
+	if !ok {
 		return c.Send(b.i18nManager.T(c.Sender(), "unknown_subscription"))
 	}
 
+	title := b.planName(c.Sender(), plan)
 	invoice := &tele.Invoice{
 		Title:       title,
-		Description: description,
-		Payload:     "subscribe|" + period,
+		Description: b.i18nManager.T(c.Sender(), "pricing.plan_description", i18n.Args{"Name": title}),
+		Payload:     "subscribe|" + plan.ID,
 		Currency:    "XTR",
-		Prices:      []tele.Price{{Label: title + " ⭐", Amount: amount}},
+		Prices:      []tele.Price{{Label: title + " ⭐", Amount: plan.Price}},
 	}
 
-	logger.Info("Отправляем инвойс для подписки: %s (%d XTR)", period, amount)
+	logger.Info("Отправляем инвойс для подписки: %s (%d XTR)", plan.ID, plan.Price)
 
 	// Для Telegram Stars отправляем без provider token
 	_, err := b.api.Send(c.Sender(), invoice)
 	if err != nil {
 		logger.Error("Ошибка отправки инвойса подписки: %v", err)
-		return c.Send(b.i18nManager.T(c.Sender(), "invoice_error", err))
+		b.trackPaymentError(c.Sender().ID, paymentStageInvoice)
+		return c.Send(b.i18nManager.T(c.Sender(), "invoice_error", i18n.Args{"Error": err.Error()}))
 	}
 
 	return nil
@@ -201,36 +189,80 @@ func (b *Bot) sendVideoWithRetry(c tele.Context, video *tele.Video, url string,
 
 // sendVideo обрабатывает скачивание и отправку видео
 func (b *Bot) sendVideo(c tele.Context, url string, chargeID string, amount int) {
-	logger := NewLogger("VIDEO")
+	// request_id апдейта становится идентификатором задачи: по нему связываются
+	// записи лога бота, менеджера скачиваний и загрузчика. При остановке бота
+	// контекст отменяется, если задача не успела завершиться
+	ctx, cancel := b.downloadManager.JobContext(requestContext(c))
+	defer cancel()
+	fields, _ := logging.FieldsFrom(ctx)
+	requestID := fields.RequestID
+	logger := NewLogger("VIDEO").WithContext(ctx)
 	startTime := time.Now()
 
 	logger.Info("Начинаем скачивание видео: %s", url)
 
+	// Регистрируем задачу: она видна пользователю в /status и /history
+	jobID, err := storage.CreateDownloadJob(b.db, requestID, c.Sender().ID, url, chargeID)
+	if err != nil {
+		logger.Warning("Не удалось сохранить задачу скачивания: %v", err)
+	}
+	var jobErr error
+	defer func() {
+		interrupted := jobErr != nil && errors.Is(context.Cause(ctx), ErrShutdown)
+		if interrupted {
+			jobErr = ErrShutdown
+		}
+		b.finishDownloadJob(jobID, jobErr)
+		if jobErr != nil {
+			b.refundFailedCredit(c.Sender().ID, chargeID)
+		} else {
+			b.rewardReferral(c.Sender().ID)
+		}
+		if interrupted {
+			b.handleInterruptedDownload(c, chargeID)
+		}
+	}()
+
 	// Проверяем, не скачивается ли уже это видео
 	if b.downloadManager.IsDownloadActive(url) {
 		logger.Info("Видео уже скачивается, ожидаем завершения")
 		c.Send(b.i18nManager.T(c.Sender(), "download_in_progress"))
-		downloadInfo, err := b.downloadManager.WaitForDownload(url, b.config.DownloadTimeout)
+		downloadInfo, err := b.downloadManager.WaitForDownload(ctx, url, b.config.DownloadTimeout)
 		if err != nil {
 			logger.Error("Ошибка ожидания скачивания: %v", err)
+			jobErr = err
 			c.Send(b.i18nManager.T(c.Sender(), "download_wait_error"))
 			return
 		}
 		if downloadInfo != nil && downloadInfo.Error != nil {
 			logger.Error("Скачивание завершилось с ошибкой: %v", downloadInfo.Error)
-			c.Send(b.i18nManager.T(c.Sender(), "download_error", downloadInfo.Error.Error()))
+			jobErr = downloadInfo.Error
+			c.Send(b.i18nManager.T(c.Sender(), "download_error", i18n.Args{"Error": downloadInfo.Error.Error()}))
 			return
 		}
 	}
 
-	// Получаем слот для скачивания
+	// Получаем слот для скачивания; если свободных нет — ждем в очереди
 	if !b.downloadManager.AcquireDownloadSlot() {
-		logger.Warning("Нет свободных слотов для скачивания")
-		c.Send(b.i18nManager.T(c.Sender(), "too_many_requests"))
-		return
+		logger.Info("Нет свободных слотов, задача %s ожидает в очереди", requestID)
+		c.Send(b.i18nManager.T(c.Sender(), "download_queued", i18n.Args{"Position": b.downloadManager.QueueLength() + 1}))
+		if !b.downloadManager.WaitDownloadSlot(ctx, b.config.DownloadTimeout) {
+			logger.Warning("Не дождались свободного слота для скачивания")
+			jobErr = fmt.Errorf("таймаут ожидания в очереди")
+			if ctx.Err() == nil {
+				c.Send(b.i18nManager.T(c.Sender(), "too_many_requests"))
+			}
+			return
+		}
 	}
 	defer b.downloadManager.ReleaseDownloadSlot()
 
+	if jobID != 0 {
+		if err := storage.SetDownloadJobStatus(b.db, jobID, storage.JobRunning, ""); err != nil {
+			logger.Warning("Ошибка обновления задачи скачивания: %v", err)
+		}
+	}
+
 	// Получаем мьютекс для URL
 	mutex := b.downloadManager.GetURLMutex(url)
 	mutex.Lock()
@@ -240,13 +272,20 @@ func (b *Bot) sendVideo(c tele.Context, url string, chargeID string, amount int)
 	}()
 
 	// Регистрируем начало скачивания
-	requestID := GenerateRequestID()
-	_ = b.downloadManager.StartDownload(url, requestID, c.Sender().ID)
-	defer b.downloadManager.FinishDownload(url, nil)
+	_ = b.downloadManager.StartDownload(ctx, url)
+	defer b.downloadManager.FinishDownload(ctx, url, nil)
 
 	// Проверяем кэш
 	logger.Info("Проверяем кэш для URL: %s", url)
 	cachedVideo, err := GetCachedVideo(b.db, url)
+	switch {
+	case err != nil:
+		metrics.CacheLookups.WithLabelValues("error").Inc()
+	case cachedVideo != nil:
+		metrics.CacheLookups.WithLabelValues("hit").Inc()
+	default:
+		metrics.CacheLookups.WithLabelValues("miss").Inc()
+	}
 	if err != nil {
 		logger.Warning("Ошибка получения из кэша: %v", err)
 	} else if cachedVideo != nil {
@@ -270,6 +309,13 @@ func (b *Bot) sendVideo(c tele.Context, url string, chargeID string, amount int)
 				// Продолжаем со скачиванием
 			} else {
 				logger.Info("Кэшированное видео успешно отправлено!")
+				if jobID != 0 {
+					if err := storage.MarkDownloadJobCacheHit(b.db, jobID); err != nil {
+						logger.Warning("%v", err)
+					}
+				}
+				b.completeTransaction(chargeID)
+				b.recordDelivery(c.Sender().ID)
 				logger.LogPerformance("Отправка кэшированного видео", startTime)
 				return
 			}
@@ -281,11 +327,14 @@ func (b *Bot) sendVideo(c tele.Context, url string, chargeID string, amount int)
 
 	// Скачиваем видео
 	logger.Info("Скачиваем видео: %s", url)
-	videoPath, err := DownloadVideo(url)
+	videoPath, err := DownloadVideo(ctx, url)
 	if err != nil {
 		logger.Error("Ошибка скачивания видео: %v", err)
-		b.downloadManager.FinishDownload(url, err)
-		c.Send(b.i18nManager.T(c.Sender(), "download_error", err.Error()))
+		jobErr = err
+		b.downloadManager.FinishDownload(ctx, url, err)
+		if ctx.Err() == nil {
+			c.Send(b.i18nManager.T(c.Sender(), "download_error", i18n.Args{"Error": err.Error()}))
+		}
 		return
 	}
 
@@ -293,8 +342,9 @@ func (b *Bot) sendVideo(c tele.Context, url string, chargeID string, amount int)
 	videoInfo, err := GetVideoInfo(videoPath)
 	if err != nil {
 		logger.Error("Ошибка получения информации о видео: %v", err)
-		b.downloadManager.FinishDownload(url, err)
-		c.Send(b.i18nManager.T(c.Sender(), "download_error", err.Error()))
+		jobErr = err
+		b.downloadManager.FinishDownload(ctx, url, err)
+		c.Send(b.i18nManager.T(c.Sender(), "download_error", i18n.Args{"Error": err.Error()}))
 		return
 	}
 
@@ -308,8 +358,10 @@ func (b *Bot) sendVideo(c tele.Context, url string, chargeID string, amount int)
 		sentMessage, err := b.api.Send(c.Sender(), video)
 		if err != nil {
 			logger.Error("Ошибка отправки видео: %v", err)
-			b.downloadManager.FinishDownload(url, err)
-			c.Send(b.i18nManager.T(c.Sender(), "send_error", err))
+			b.noteSendError(c.Sender().ID, err)
+			jobErr = err
+			b.downloadManager.FinishDownload(ctx, url, err)
+			c.Send(b.i18nManager.T(c.Sender(), "send_error", i18n.Args{"Error": err.Error()}))
 			return
 		}
 
@@ -326,66 +378,28 @@ func (b *Bot) sendVideo(c tele.Context, url string, chargeID string, amount int)
 			logger.Warning("Не удалось получить file_id для сохранения в кэш")
 		}
 
-		// Обновляем статистику транзакции
-		if chargeID != "" {
-			err = UpdateTransactionStatus(b.db, chargeID, "completed")
-			if err != nil {
-				logger.Error("Ошибка обновления статуса транзакции: %v", err)
-			}
-		}
+		// Обновляем статус транзакции
+		b.completeTransaction(chargeID)
 
-		// --- СТАТИСТИКА: увеличиваем счетчик скачиваний ---
-		_ = IncrementDownloads(b.db, c.Sender().ID)
-		// --- КОНЕЦ СТАТИСТИКИ ---
+		b.recordDelivery(c.Sender().ID)
 
 		logger.LogPerformance("Полное скачивание и отправка видео", startTime)
 	}
 }
 
-// CheckUserSubscriptionRaw проверяет подписку пользователя на канал через Telegram API
-func (b *Bot) CheckUserSubscriptionRaw(channelUsername string, userID int64) (bool, error) {
-	// channelUsername должен быть в формате "@yourchannel" или chat_id
-	apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/getChatMember", b.api.Token)
-
-	// Если нет @, добавим
-	if !strings.HasPrefix(channelUsername, "@") && !strings.HasPrefix(channelUsername, "-") {
-		channelUsername = "@" + channelUsername
+// finishDownloadJob фиксирует результат задачи скачивания
+func (b *Bot) finishDownloadJob(jobID int64, jobErr error) {
+	if jobID == 0 {
+		return
 	}
 
-	data := map[string]interface{}{
-		"chat_id": channelUsername,
-		"user_id": userID,
-	}
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return false, fmt.Errorf("ошибка маршалинга: %w", err)
-	}
-	resp, err := http.Post(apiURL, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return false, fmt.Errorf("ошибка запроса: %w", err)
-	}
-	defer resp.Body.Close()
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return false, fmt.Errorf("ошибка чтения ответа: %w", err)
-	}
-	var result struct {
-		Ok     bool `json:"ok"`
-		Result struct {
-			Status string `json:"status"`
-		} `json:"result"`
-		Description string `json:"description"`
-	}
-	if err := json.Unmarshal(bodyBytes, &result); err != nil {
-		return false, fmt.Errorf("ошибка декодирования ответа: %w", err)
+	status, errText := storage.JobDone, ""
+	if jobErr != nil {
+		status, errText = storage.JobFailed, jobErr.Error()
 	}
-	if !result.Ok {
-		return false, fmt.Errorf("ошибка Telegram API: %v", result.Description)
+	if err := storage.SetDownloadJobStatus(b.db, jobID, status, errText); err != nil {
+		NewLogger("VIDEO").Warning("Ошибка обновления задачи скачивания %d: %v", jobID, err)
 	}
-	if result.Result.Status == "member" || result.Result.Status == "administrator" || result.Result.Status == "creator" {
-		return true, nil
-	}
-	return false, nil
 }
 
 // sendError отправляет сообщение об ошибке
@@ -400,3 +414,21 @@ func (b *Bot) sendError(c tele.Context, userMsg string, err error, extraInfo ...
 
 	c.Send(userMsg)
 }
+
+// completeTransaction отмечает оплаченную транзакцию доставленной. Если админ успел
+// начать возврат, пока видео скачивалось, статус refunding/refunded не перезаписывается.
+// Скачивания за кредит ("credit:<id>") транзакций не имеют
+func (b *Bot) completeTransaction(chargeID string) {
+	if chargeID == "" || strings.HasPrefix(chargeID, creditChargePrefix) {
+		return
+	}
+	logger := NewLogger("VIDEO")
+	completed, err := payment.MarkTransactionCompleted(b.db, chargeID)
+	if err != nil {
+		logger.Error("Ошибка обновления статуса транзакции: %v", err)
+		return
+	}
+	if !completed {
+		logger.Warning("Транзакция %s не в статусе success — статус после доставки не изменен", logging.Mask(chargeID))
+	}
+}
@@ -0,0 +1,160 @@
+// Package cli подкоманды бинарника: запуск бота (serve) и операционные задачи — миграции,
+// кэш, транзакции и возвраты, выгрузка статистики, премиум-подписки. Команды используют
+// те же пакеты storage и payment, что и бот, поэтому их можно вызывать из скриптов
+// вместо админских команд в Telegram
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"YoutubeDownloader/internal/config"
+	"YoutubeDownloader/internal/logging"
+)
+
+// ErrUsage неверные аргументы подкоманды; Run печатает ошибку и синтаксис команды
+var ErrUsage = errors.New("неверные аргументы")
+
+// Env общее окружение подкоманд
+type Env struct {
+	Config *config.Config
+	DB     *sql.DB
+	Out    io.Writer
+}
+
+// command подкоманда верхнего уровня
+type command struct {
+	name    string
+	usage   string // синтаксис без имени бинарника
+	summary string
+	run     func(ctx context.Context, env *Env, args []string) error
+}
+
+func commands() []command {
+	return []command{
+		{"serve", "serve", "запустить бота (по умолчанию)", runServe},
+		{"migrate", "migrate [up|status]", "применить миграции или показать их состояние", runMigrate},
+		{"cache", "cache stats | clean [-days N] | purge -yes", "размер кэша file_id, удаление старых записей, полная очистка", runCache},
+		{"trx", "trx show <id> [-json] | refund <id> -reason <текст> [-admin <id>]", "карточка транзакции или возврат Stars", runTrx},
+		{"stats", "stats export [-report users|daily|retention|funnel|revenue] [-days N] [-format csv|json] [-output <файл>]",
+			"выгрузка статистики пользователей или отчетов аналитики: активность по дням, удержание, воронка оплат, выручка", runStats},
+		{"users", "users grant-premium <user_id> -days N", "продлить премиум-подписку", runUsers},
+	}
+}
+
+// Usage печатает справку по подкомандам
+func Usage(w io.Writer) {
+	fmt.Fprintln(w, "Использование: app [команда] [аргументы]")
+	fmt.Fprintln(w)
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %s\n      %s\n", cmd.usage, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Конфигурация читается из CONFIG_FILE и переменных окружения (см. README)")
+}
+
+// Run разбирает аргументы, загружает конфигурацию, подключается к БД и выполняет подкоманду.
+// Возвращает код завершения процесса
+func Run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" || name == "-h" || name == "--help" {
+		Usage(stdout)
+		return 0
+	}
+
+	var cmd *command
+	for _, c := range commands() {
+		if c.name == name {
+			cmd = &c
+			break
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "неизвестная команда %q\n\n", name)
+		Usage(stderr)
+		return 2
+	}
+
+	// Настройки: значения по умолчанию, файл CONFIG_FILE (если задан), переменные окружения
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if err := logging.Setup(cfg.LogLevel, cfg.LogFormat); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	db, err := sql.Open("postgres", cfg.Database.DSN())
+	if err != nil {
+		fmt.Fprintln(stderr, "Ошибка подключения к базе данных:", err)
+		return 1
+	}
+	defer db.Close()
+	if err := db.PingContext(ctx); err != nil {
+		fmt.Fprintln(stderr, "База данных недоступна:", err)
+		return 1
+	}
+
+	err = cmd.run(ctx, &Env{Config: cfg, DB: db, Out: stdout}, args)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, ErrUsage):
+		fmt.Fprintln(stderr, err)
+		fmt.Fprintln(stderr, "Использование: app "+cmd.usage)
+		return 2
+	default:
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+}
+
+// newFlagSet создает набор флагов подкоманды; ошибки разбора возвращаются как ErrUsage
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// parseFlags разбирает флаги после позиционных аргументов: "trx refund 42 -reason ..."
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", ErrUsage, err)
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: лишние аргументы %s", ErrUsage, strings.Join(fs.Args(), " "))
+	}
+	return nil
+}
+
+// subcommand отделяет действие подкоманды от ее аргументов
+func subcommand(args []string) (string, []string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "", nil, ErrUsage
+	}
+	return args[0], args[1:], nil
+}
+
+// idArg разбирает обязательный числовой позиционный аргумент
+func idArg(args []string, name string) (int64, []string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return 0, nil, fmt.Errorf("%w: не указан %s", ErrUsage, name)
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %s должен быть числом: %q", ErrUsage, name, args[0])
+	}
+	return id, args[1:], nil
+}
@@ -0,0 +1,415 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"YoutubeDownloader/internal/bot"
+	"YoutubeDownloader/internal/migrate"
+	"YoutubeDownloader/internal/payment"
+	"YoutubeDownloader/internal/revenue"
+	"YoutubeDownloader/internal/storage"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// runServe запускает бота до отмены ctx
+func runServe(ctx context.Context, env *Env, args []string) error {
+	if err := parseFlags(newFlagSet("serve"), args); err != nil {
+		return err
+	}
+	if err := env.Config.RequireToken(); err != nil {
+		return err
+	}
+	if env.Config.AutoMigrate {
+		if _, err := migrate.Up(ctx, env.DB); err != nil {
+			return err
+		}
+	}
+
+	tgBot, err := bot.NewBot(env.Config, env.DB)
+	if err != nil {
+		return err
+	}
+	tgBot.Run(ctx)
+	return nil
+}
+
+// runMigrate применяет миграции или показывает их состояние
+func runMigrate(ctx context.Context, env *Env, args []string) error {
+	action := "up"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+	if len(args) > 0 {
+		return ErrUsage
+	}
+
+	switch action {
+	case "up":
+		applied, err := migrate.Up(ctx, env.DB)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(env.Out, "Применено миграций: %d\n", applied)
+		return nil
+	case "status":
+		return migrate.Status(ctx, env.DB, env.Out)
+	default:
+		return ErrUsage
+	}
+}
+
+// runCache показывает и очищает кэш file_id
+func runCache(ctx context.Context, env *Env, args []string) error {
+	action, args, err := subcommand(args)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "stats":
+		if err := parseFlags(newFlagSet("cache stats"), args); err != nil {
+			return err
+		}
+		count, err := storage.GetCacheStats(env.DB)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(env.Out, "Записей в кэше: %d\n", count)
+		return nil
+
+	case "clean":
+		fs := newFlagSet("cache clean")
+		days := fs.Int("days", 30, "удалить записи старше N дней")
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+		if *days < 0 {
+			return fmt.Errorf("%w: -days не может быть отрицательным", ErrUsage)
+		}
+		removed, err := storage.CleanOldCache(env.DB, *days)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(env.Out, "Удалено записей старше %d дней: %d\n", *days, removed)
+		return nil
+
+	case "purge":
+		fs := newFlagSet("cache purge")
+		yes := fs.Bool("yes", false, "подтвердить полную очистку")
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+		if !*yes {
+			return fmt.Errorf("%w: полная очистка кэша требует -yes", ErrUsage)
+		}
+		removed, err := storage.PurgeCache(env.DB)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(env.Out, "Кэш очищен, удалено записей: %d\n", removed)
+		return nil
+
+	default:
+		return ErrUsage
+	}
+}
+
+// runTrx показывает транзакцию или возвращает по ней средства
+func runTrx(ctx context.Context, env *Env, args []string) error {
+	action, args, err := subcommand(args)
+	if err != nil {
+		return err
+	}
+	id, args, err := idArg(args, "id транзакции")
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "show":
+		fs := newFlagSet("trx show")
+		asJSON := fs.Bool("json", false, "вывести в JSON")
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+		trx, err := loadTransaction(env.DB, id)
+		if err != nil {
+			return err
+		}
+		audit, err := payment.GetRefundAuditByTransaction(env.DB, id)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			return writeJSON(env.Out, map[string]any{"transaction": trx, "refund_audit": audit})
+		}
+		printTransaction(env.Out, trx, audit)
+		return nil
+
+	case "refund":
+		fs := newFlagSet("trx refund")
+		reason := fs.String("reason", "", "причина возврата (обязательна)")
+		adminID := fs.Int64("admin", 0, "Telegram ID сотрудника для аудита")
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+		if *reason == "" {
+			return fmt.Errorf("%w: не указана -reason", ErrUsage)
+		}
+		if err := env.Config.RequireToken(); err != nil {
+			return err
+		}
+		trx, err := loadTransaction(env.DB, id)
+		if err != nil {
+			return err
+		}
+		api, err := newAPIClient(env)
+		if err != nil {
+			return err
+		}
+		if err := payment.RefundTransaction(env.DB, api, trx, *adminID, trx.TelegramUserID, *reason); err != nil {
+			if errors.Is(err, payment.ErrNotRefundable) {
+				return fmt.Errorf("транзакция %d недоступна для возврата (статус %s)", id, trx.Status)
+			}
+			return fmt.Errorf("ошибка возврата по транзакции %d: %w", id, err)
+		}
+		fmt.Fprintf(env.Out, "Возвращено %d XTR пользователю %d по транзакции %d\n", trx.Amount, trx.TelegramUserID, id)
+		return nil
+
+	default:
+		return ErrUsage
+	}
+}
+
+// runStats выгружает статистику пользователей или отчеты аналитики
+func runStats(ctx context.Context, env *Env, args []string) error {
+	action, args, err := subcommand(args)
+	if err != nil || action != "export" {
+		return ErrUsage
+	}
+
+	fs := newFlagSet("stats export")
+	report := fs.String("report", "users", "users, daily, retention, funnel или revenue")
+	days := fs.Int("days", 30, "период отчетов аналитики в днях, включая сегодня")
+	format := fs.String("format", "csv", "csv или json")
+	output := fs.String("output", "", "файл для выгрузки (по умолчанию stdout)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("%w: -format должен быть csv или json", ErrUsage)
+	}
+	if *days < 1 {
+		return fmt.Errorf("%w: -days должен быть больше нуля", ErrUsage)
+	}
+	to := time.Now()
+	from := to.AddDate(0, 0, -(*days - 1))
+
+	var (
+		jsonValue any
+		csvRows   [][]string
+	)
+	switch *report {
+	case "users":
+		users, err := storage.GetAllUserStats(env.DB)
+		if err != nil {
+			return err
+		}
+		total, err := storage.GetTotalStats(env.DB)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		jsonValue = map[string]any{"total": total, "users": users}
+		csvRows = append(csvRows, []string{"user_id", "messages", "downloads", "last_active", "created_at", "state"})
+		for _, u := range users {
+			csvRows = append(csvRows, []string{
+				itoa(u.UserID),
+				itoa(u.Messages),
+				itoa(u.Downloads),
+				u.LastActive.UTC().Format(time.RFC3339),
+				u.CreatedAt.UTC().Format(time.RFC3339),
+				u.State,
+			})
+		}
+
+	case "daily":
+		activity, err := storage.GetDailyActivity(env.DB, from, to)
+		if err != nil {
+			return err
+		}
+		jsonValue = activity
+		csvRows = append(csvRows, []string{"day", "dau", "wau", "mau", "new_users", "messages", "links", "paywalls", "payments", "downloads"})
+		for _, a := range activity {
+			csvRows = append(csvRows, []string{
+				a.Day.Format(time.DateOnly), itoa(a.DAU), itoa(a.WAU), itoa(a.MAU), itoa(a.NewUsers),
+				itoa(a.Messages), itoa(a.Links), itoa(a.Paywalls), itoa(a.Payments), itoa(a.Downloads),
+			})
+		}
+
+	case "retention":
+		cohorts, err := storage.GetRetention(env.DB, from, to)
+		if err != nil {
+			return err
+		}
+		jsonValue = cohorts
+		csvRows = append(csvRows, []string{"day", "size", "d1", "d7", "d1_ready", "d7_ready"})
+		for _, r := range cohorts {
+			csvRows = append(csvRows, []string{
+				r.Day.Format(time.DateOnly), itoa(r.Size), itoa(r.D1), itoa(r.D7),
+				strconv.FormatBool(r.D1Ready), strconv.FormatBool(r.D7Ready),
+			})
+		}
+
+	case "funnel":
+		funnel, err := storage.GetFunnel(env.DB, from, to)
+		if err != nil {
+			return err
+		}
+		jsonValue = funnel
+		// Сводка воронки — строка с пустым plan, затем оплаты по планам
+		csvRows = append(csvRows,
+			[]string{"plan", "link_users", "paywall_users", "paywall_shows", "payers", "payments", "amount", "delivered_users"},
+			[]string{"", itoa(funnel.LinkUsers), itoa(funnel.PaywallUsers), itoa(funnel.PaywallShows), itoa(funnel.Payers), "", "", itoa(funnel.DeliveredUsers)},
+		)
+		for _, p := range funnel.Plans {
+			csvRows = append(csvRows, []string{p.Plan, "", itoa(funnel.PaywallUsers), "", itoa(p.Payers), itoa(p.Payments), itoa(p.Amount), ""})
+		}
+
+	case "revenue":
+		// Выручка считается за полные дни, начиная с полуночи первого
+		ledger, err := revenue.GetLedger(env.DB, time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location()), to)
+		if err != nil {
+			return err
+		}
+		jsonValue = ledger.Rows
+		csvRows = append(csvRows, []string{"day", "product", "payments", "gross", "refunds", "refunded", "net"})
+		for _, r := range ledger.Rows {
+			csvRows = append(csvRows, []string{
+				r.Day.Format(time.DateOnly), r.Product, itoa(r.Payments), itoa(r.Gross), itoa(r.Refunds), itoa(r.Refunded), itoa(r.Net()),
+			})
+		}
+
+	default:
+		return fmt.Errorf("%w: -report должен быть users, daily, retention, funnel или revenue", ErrUsage)
+	}
+
+	w := env.Out
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if *format == "json" {
+		return writeJSON(w, jsonValue)
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(csvRows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// runUsers управляет пользователями
+func runUsers(ctx context.Context, env *Env, args []string) error {
+	action, args, err := subcommand(args)
+	if err != nil || action != "grant-premium" {
+		return ErrUsage
+	}
+	userID, args, err := idArg(args, "user_id")
+	if err != nil {
+		return err
+	}
+
+	fs := newFlagSet("users grant-premium")
+	days := fs.Int("days", 0, "на сколько дней продлить подписку")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *days <= 0 {
+		return fmt.Errorf("%w: -days должен быть больше нуля", ErrUsage)
+	}
+
+	until, err := storage.ExtendUserPremium(env.DB, userID, time.Duration(*days)*24*time.Hour)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(env.Out, "Премиум пользователя %d продлен до %s\n", userID, until.Local().Format(time.DateTime))
+	return nil
+}
+
+// loadTransaction читает транзакцию, отличая отсутствие от ошибки БД
+func loadTransaction(db *sql.DB, id int64) (*payment.Transaction, error) {
+	trx, err := payment.GetTransactionByID(db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("транзакция %d не найдена", id)
+	}
+	return trx, err
+}
+
+// newAPIClient создает клиент Bot API без запуска бота: Offline пропускает getMe
+func newAPIClient(env *Env) (*tele.Bot, error) {
+	return tele.NewBot(tele.Settings{
+		Token:   env.Config.Token,
+		URL:     env.Config.TelegramAPIURL,
+		Client:  &http.Client{Timeout: env.Config.HTTPTimeout},
+		Offline: true,
+	})
+}
+
+// printTransaction печатает карточку транзакции и попытки возврата
+func printTransaction(w io.Writer, trx *payment.Transaction, audit []payment.RefundAudit) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "id\t%d\n", trx.ID)
+	fmt.Fprintf(tw, "user_id\t%d\n", trx.TelegramUserID)
+	fmt.Fprintf(tw, "amount\t%d XTR\n", trx.Amount)
+	fmt.Fprintf(tw, "status\t%s\n", trx.Status)
+	fmt.Fprintf(tw, "type\t%s\n", trx.Type)
+	fmt.Fprintf(tw, "charge_id\t%s\n", trx.TelegramPaymentChargeID)
+	fmt.Fprintf(tw, "payload\t%s\n", trx.InvoicePayload)
+	fmt.Fprintf(tw, "url\t%s\n", trx.URL)
+	fmt.Fprintf(tw, "pricing_rule\t%s\n", trx.PricingRule)
+	fmt.Fprintf(tw, "reason\t%s\n", trx.Reason)
+	fmt.Fprintf(tw, "created_at\t%s\n", trx.CreatedAt.Local().Format(time.DateTime))
+	fmt.Fprintf(tw, "refundable\t%t\n", trx.IsRefundable())
+	tw.Flush()
+
+	if len(audit) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Попытки возврата:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CREATED AT\tADMIN\tSUCCESS\tREASON")
+	for _, a := range audit {
+		fmt.Fprintf(tw, "%s\t%d\t%t\t%s\n", a.CreatedAt.Local().Format(time.DateTime), a.AdminID, a.Success, a.Reason)
+	}
+	tw.Flush()
+}
+
+// itoa форматирует счетчик для CSV
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+// writeJSON пишет значение с отступами
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
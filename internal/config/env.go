@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// envVar переменная окружения, переопределяющая поле конфигурации
+type envVar struct {
+	name  string
+	field any // *string, *int, *bool или *time.Duration
+}
+
+// envVars возвращает переменные окружения, которые читает бот
+func (c *Config) envVars() []envVar {
+	return []envVar{
+		{"TELEGRAM_BOT_TOKEN", &c.Token},
+		{"ADMIN_ID", &c.AdminID},
+		{"STARS_PROVIDER_TOKEN", &c.ProviderToken},
+		{"CHANNEL_USERNAME", &c.ChannelUsername},
+		{"USE_OFFICIAL_API", &c.UseOfficialAPI},
+		{"TELEGRAM_API_URL", &c.TelegramAPIURL},
+		{"HTTP_TIMEOUT", &c.HTTPTimeout},
+		{"MAX_DOWNLOAD_WORKERS", &c.MaxWorkers},
+		{"DOWNLOAD_TIMEOUT", &c.DownloadTimeout},
+		{"I18N_OVERRIDE_DIR", &c.I18nOverrideDir},
+		{"I18N_RELOAD_INTERVAL", &c.I18nReloadInterval},
+		{"FREE_DAILY_DOWNLOADS", &c.FreeDailyDownloads},
+		{"PRICING_FILE", &c.PricingFile},
+		{"REFERRAL_REWARD_CREDITS", &c.ReferralRewardCredits},
+		{"REFERRAL_REWARD_DAYS", &c.ReferralRewardDays},
+		{"SPONSOR_CHECK_TTL", &c.SponsorCheckTTL},
+		{"LOG_LEVEL", &c.LogLevel},
+		{"LOG_FORMAT", &c.LogFormat},
+		{"HTTP_ADDR", &c.HTTPAddr},
+		{"HEALTH_MIN_FREE_MB", &c.HealthMinFreeMB},
+		{"SHUTDOWN_TIMEOUT", &c.ShutdownTimeout},
+		{"BROADCAST_RATE", &c.BroadcastRate},
+		{"REPORT_CHATS", &c.Reports.Chats},
+		{"REPORT_DAILY_AT", &c.Reports.DailyAt},
+		{"REPORT_WEEKLY_DAY", &c.Reports.WeeklyDay},
+		{"ALERT_WINDOW", &c.Reports.AlertWindow},
+		{"ALERT_COOLDOWN", &c.Reports.AlertCooldown},
+		{"ALERT_DOWNLOAD_FAILURES", &c.Reports.AlertDownloadFailures},
+		{"ALERT_PAYMENT_ERRORS", &c.Reports.AlertPaymentErrors},
+		{"DATABASE_URL", &c.Database.URL},
+		{"DB_HOST", &c.Database.Host},
+		{"DB_PORT", &c.Database.Port},
+		{"DB_USER", &c.Database.User},
+		{"DB_PASSWORD", &c.Database.Password},
+		{"DB_NAME", &c.Database.Name},
+		{"DB_SSLMODE", &c.Database.SSLMode},
+		{"AUTO_MIGRATE", &c.AutoMigrate},
+	}
+}
+
+// applyEnv переопределяет поля непустыми переменными окружения. Значения, которые
+// не удалось разобрать, возвращаются ошибками, а не пропускаются молча
+func applyEnv(c *Config, lookup func(string) (string, bool)) []error {
+	var errs []error
+	for _, v := range c.envVars() {
+		value, ok := lookup(v.name)
+		if !ok || value == "" {
+			continue
+		}
+
+		var err error
+		switch field := v.field.(type) {
+		case *string:
+			*field = value
+		case *int:
+			var n int
+			if n, err = strconv.Atoi(value); err == nil {
+				*field = n
+			}
+		case *bool:
+			var flag bool
+			if flag, err = strconv.ParseBool(value); err == nil {
+				*field = flag
+			}
+		case *time.Duration:
+			var d time.Duration
+			if d, err = time.ParseDuration(value); err == nil {
+				*field = d
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: некорректное значение %q", v.name, value))
+		}
+	}
+	return errs
+}
@@ -1,7 +1,10 @@
 package downloader
 
 import (
+	"YoutubeDownloader/internal/logging"
+	"YoutubeDownloader/internal/metrics"
 	"YoutubeDownloader/internal/utils"
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -9,177 +12,49 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 )
 
-func DownloadYouTubeVideo(url string) (string, error) {
-	tmpDir := "./tmp"
-	if err := os.MkdirAll(tmpDir, 0755); err != nil {
-		return "", errors.New("не удалось создать временную папку: " + err.Error())
-	}
-
-	// Очищаем старые временные файлы
-	utils.CleanupTempFiles(tmpDir)
-
-	// Диагностируем файловую систему
-	if err := utils.DiagnoseFileSystem(tmpDir); err != nil {
-		return "", fmt.Errorf("проблемы с файловой системой: %v", err)
-	}
-
-	filename := filepath.Join(tmpDir, "ytvideo_"+utils.RandomString(8)+".mp4")
-	absFilename, _ := filepath.Abs(filename)
+// TempDir директория для скачиваемых файлов
+const TempDir = "./tmp"
 
-	var ytDlpPath string
-	if runtime.GOOS == "windows" {
-		ytDlpPath = "./yt-dlp.exe"
-	} else {
-		ytDlpPath = "./yt-dlp_linux"
-	}
-	absYtDlpPath, _ := filepath.Abs(ytDlpPath)
+// filePrefix префикс временных файлов этого процесса, включая промежуточные файлы yt-dlp
+func filePrefix() string {
+	return fmt.Sprintf("ytvideo_%d_", os.Getpid())
+}
 
-	// Пробуем разные стратегии скачивания
-	strategies := []struct {
-		name string
-		args []string
-	}{
-		{
-			name: "best_quality",
-			args: []string{"-f", "bestvideo[ext=mp4]+bestaudio[ext=m4a]/best[ext=mp4]/best", "-o", absFilename, "--no-mtime", "--no-warnings"},
-		},
-		{
-			name: "simple_best",
-			args: []string{"-f", "best[ext=mp4]/best", "-o", absFilename, "--no-mtime", "--no-warnings"},
-		},
-		{
-			name: "worst_quality",
-			args: []string{"-f", "worst[ext=mp4]/worst", "-o", absFilename, "--no-mtime", "--no-warnings"},
-		},
+// RemoveTempFiles удаляет временные файлы, созданные этим процессом. Возвращает число удаленных
+func RemoveTempFiles() (int, error) {
+	matches, err := filepath.Glob(filepath.Join(TempDir, filePrefix()+"*"))
+	if err != nil {
+		return 0, err
 	}
-
-	var lastError error
-	for i, strategy := range strategies {
-		fmt.Printf("[DOWNLOADER] Пробуем стратегию %d: %s\n", i+1, strategy.name)
-
-		cmd := exec.Command(absYtDlpPath, strategy.args...)
-		cmd.Args = append(cmd.Args, url)
-
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			lastError = fmt.Errorf("yt-dlp error (strategy %s): %v, details: %s", strategy.name, err, string(output))
-			fmt.Printf("[DOWNLOADER] Стратегия %s не удалась: %v\n", strategy.name, err)
-			continue
-		}
-
-		// Проверяем, создался ли файл
-		if _, err := os.Stat(absFilename); err == nil {
-			fmt.Printf("[DOWNLOADER] Успешно скачано с помощью стратегии: %s\n", strategy.name)
-			return absFilename, nil
-		}
-
-		// Ищем файл с другим расширением
-		baseName := strings.TrimSuffix(absFilename, ".mp4")
-		possibleExtensions := []string{".mp4", ".mkv", ".webm", ".avi", ".mov"}
-
-		for _, ext := range possibleExtensions {
-			altFilename := baseName + ext
-			if _, err := os.Stat(altFilename); err == nil {
-				fmt.Printf("[DOWNLOADER] Найден файл с расширением %s: %s\n", ext, altFilename)
-				return altFilename, nil
-			}
+	removed := 0
+	for _, path := range matches {
+		if err := os.Remove(path); err == nil {
+			removed++
 		}
-
-		lastError = fmt.Errorf("файл не был создан после стратегии %s, yt-dlp output: %s", strategy.name, string(output))
 	}
-
-	return "", fmt.Errorf("все стратегии скачивания не удались. Последняя ошибка: %v", lastError)
+	return removed, nil
 }
 
-// Функция для скачивания YouTube видео с уникальным идентификатором пользователя
-func DownloadYouTubeVideoWithUserID(url string, userID int64, requestID string) (string, error) {
-	tmpDir := "./tmp"
-	if err := os.MkdirAll(tmpDir, 0755); err != nil {
-		return "", errors.New("не удалось создать временную папку: " + err.Error())
-	}
-
-	// Очищаем старые временные файлы
-	utils.CleanupTempFiles(tmpDir)
-
-	// Диагностируем файловую систему
-	if err := utils.DiagnoseFileSystem(tmpDir); err != nil {
-		return "", fmt.Errorf("проблемы с файловой системой: %v", err)
-	}
-
-	// Создаем уникальное имя файла с userID и requestID
-	filename := filepath.Join(tmpDir, fmt.Sprintf("ytvideo_user%d_%s.mp4", userID, requestID))
-	absFilename, _ := filepath.Abs(filename)
-
-	var ytDlpPath string
+// ytDlpPath возвращает абсолютный путь к бинарнику yt-dlp для текущей ОС
+func ytDlpPath() string {
+	path := "./yt-dlp_linux"
 	if runtime.GOOS == "windows" {
-		ytDlpPath = "./yt-dlp.exe"
-	} else {
-		ytDlpPath = "./yt-dlp_linux"
-	}
-	absYtDlpPath, _ := filepath.Abs(ytDlpPath)
-
-	// Пробуем разные стратегии скачивания
-	strategies := []struct {
-		name string
-		args []string
-	}{
-		{
-			name: "best_quality",
-			args: []string{"-f", "bestvideo[ext=mp4]+bestaudio[ext=m4a]/best[ext=mp4]/best", "-o", absFilename, "--no-mtime", "--no-warnings"},
-		},
-		{
-			name: "simple_best",
-			args: []string{"-f", "best[ext=mp4]/best", "-o", absFilename, "--no-mtime", "--no-warnings"},
-		},
-		{
-			name: "worst_quality",
-			args: []string{"-f", "worst[ext=mp4]/worst", "-o", absFilename, "--no-mtime", "--no-warnings"},
-		},
+		path = "./yt-dlp.exe"
 	}
-
-	var lastError error
-	for i, strategy := range strategies {
-		fmt.Printf("[DOWNLOADER] [%s] Пользователь %d: пробуем стратегию %d: %s\n", requestID, userID, i+1, strategy.name)
-
-		cmd := exec.Command(absYtDlpPath, strategy.args...)
-		cmd.Args = append(cmd.Args, url)
-
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			lastError = fmt.Errorf("yt-dlp error (strategy %s): %v, details: %s", strategy.name, err, string(output))
-			fmt.Printf("[DOWNLOADER] [%s] Пользователь %d: стратегия %s не удалась: %v\n", requestID, userID, strategy.name, err)
-			continue
-		}
-
-		// Проверяем, создался ли файл
-		if _, err := os.Stat(absFilename); err == nil {
-			fmt.Printf("[DOWNLOADER] [%s] Пользователь %d: успешно скачано с помощью стратегии: %s\n", requestID, userID, strategy.name)
-			return absFilename, nil
-		}
-
-		// Ищем файл с другим расширением
-		baseName := strings.TrimSuffix(absFilename, ".mp4")
-		possibleExtensions := []string{".mp4", ".mkv", ".webm", ".avi", ".mov"}
-
-		for _, ext := range possibleExtensions {
-			altFilename := baseName + ext
-			if _, err := os.Stat(altFilename); err == nil {
-				fmt.Printf("[DOWNLOADER] [%s] Пользователь %d: найден файл с расширением %s: %s\n", requestID, userID, ext, altFilename)
-				return altFilename, nil
-			}
-		}
-
-		lastError = fmt.Errorf("файл не был создан после стратегии %s, yt-dlp output: %s", strategy.name, string(output))
-	}
-
-	return "", fmt.Errorf("все стратегии скачивания не удались для пользователя %d (request %s). Последняя ошибка: %v", userID, requestID, lastError)
+	absPath, _ := filepath.Abs(path)
+	return absPath
 }
 
-// Функция для скачивания YouTube видео с уникальным идентификатором пользователя и URL хешем
-func DownloadYouTubeVideoWithUserIDAndURL(url string, userID int64, requestID string, urlHash string) (string, error) {
-	tmpDir := "./tmp"
+// DownloadVideo скачивает видео, перебирая стратегии от лучшего качества к худшему.
+// request_id и user_id из контекста попадают в имя файла и в записи лога;
+// отмена контекста останавливает yt-dlp
+func DownloadVideo(ctx context.Context, url string) (string, error) {
+	log := logging.Component("DOWNLOADER")
+
+	tmpDir := TempDir
 	if err := os.MkdirAll(tmpDir, 0755); err != nil {
 		return "", errors.New("не удалось создать временную папку: " + err.Error())
 	}
@@ -192,17 +67,12 @@ func DownloadYouTubeVideoWithUserIDAndURL(url string, userID int64, requestID st
 		return "", fmt.Errorf("проблемы с файловой системой: %v", err)
 	}
 
-	// Создаем уникальное имя файла с userID, requestID и urlHash
-	filename := filepath.Join(tmpDir, fmt.Sprintf("ytvideo_user%d_%s_%s.mp4", userID, requestID, urlHash))
-	absFilename, _ := filepath.Abs(filename)
-
-	var ytDlpPath string
-	if runtime.GOOS == "windows" {
-		ytDlpPath = "./yt-dlp.exe"
-	} else {
-		ytDlpPath = "./yt-dlp_linux"
+	// Имя файла уникально для запроса, чтобы параллельные скачивания не пересекались
+	name := filePrefix() + utils.RandomString(8) + ".mp4"
+	if f, ok := logging.FieldsFrom(ctx); ok && f.RequestID != "" {
+		name = fmt.Sprintf("%suser%d_%s.mp4", filePrefix(), f.UserID, f.RequestID)
 	}
-	absYtDlpPath, _ := filepath.Abs(ytDlpPath)
+	absFilename, _ := filepath.Abs(filepath.Join(tmpDir, name))
 
 	// Пробуем разные стратегии скачивания
 	strategies := []struct {
@@ -225,21 +95,31 @@ func DownloadYouTubeVideoWithUserIDAndURL(url string, userID int64, requestID st
 
 	var lastError error
 	for i, strategy := range strategies {
-		fmt.Printf("[DOWNLOADER] [%s] Пользователь %d (URL: %s): пробуем стратегию %d: %s\n", requestID, userID, urlHash, i+1, strategy.name)
+		log.InfoContext(ctx, "Пробуем стратегию скачивания", "attempt", i+1, "strategy", strategy.name)
 
-		cmd := exec.Command(absYtDlpPath, strategy.args...)
+		cmd := exec.CommandContext(ctx, ytDlpPath(), strategy.args...)
 		cmd.Args = append(cmd.Args, url)
 
+		started := time.Now()
 		output, err := cmd.CombinedOutput()
+		observe := func(outcome string) {
+			metrics.DownloadDuration.WithLabelValues(strategy.name, outcome).Observe(time.Since(started).Seconds())
+		}
 		if err != nil {
+			observe(metrics.OutcomeFailure)
+			if ctx.Err() != nil {
+				return "", fmt.Errorf("скачивание прервано: %w", ctx.Err())
+			}
 			lastError = fmt.Errorf("yt-dlp error (strategy %s): %v, details: %s", strategy.name, err, string(output))
-			fmt.Printf("[DOWNLOADER] [%s] Пользователь %d: стратегия %s не удалась: %v\n", requestID, userID, strategy.name, err)
+			log.WarnContext(ctx, "Стратегия скачивания не удалась", "strategy", strategy.name, "error", err)
 			continue
 		}
 
 		// Проверяем, создался ли файл
-		if _, err := os.Stat(absFilename); err == nil {
-			fmt.Printf("[DOWNLOADER] [%s] Пользователь %d: успешно скачано с помощью стратегии: %s\n", requestID, userID, strategy.name)
+		if info, err := os.Stat(absFilename); err == nil {
+			observe(metrics.OutcomeSuccess)
+			metrics.DownloadedBytes.Add(float64(info.Size()))
+			log.InfoContext(ctx, "Видео скачано", "strategy", strategy.name, "bytes", info.Size())
 			return absFilename, nil
 		}
 
@@ -249,14 +129,17 @@ func DownloadYouTubeVideoWithUserIDAndURL(url string, userID int64, requestID st
 
 		for _, ext := range possibleExtensions {
 			altFilename := baseName + ext
-			if _, err := os.Stat(altFilename); err == nil {
-				fmt.Printf("[DOWNLOADER] [%s] Пользователь %d: найден файл с расширением %s: %s\n", requestID, userID, ext, altFilename)
+			if info, err := os.Stat(altFilename); err == nil {
+				observe(metrics.OutcomeSuccess)
+				metrics.DownloadedBytes.Add(float64(info.Size()))
+				log.InfoContext(ctx, "Найден файл с другим расширением", "strategy", strategy.name, "file", altFilename)
 				return altFilename, nil
 			}
 		}
 
+		observe(metrics.OutcomeFailure)
 		lastError = fmt.Errorf("файл не был создан после стратегии %s, yt-dlp output: %s", strategy.name, string(output))
 	}
 
-	return "", fmt.Errorf("все стратегии скачивания не удались для пользователя %d (request %s, URL %s). Последняя ошибка: %v", userID, requestID, urlHash, lastError)
+	return "", fmt.Errorf("все стратегии скачивания не удались. Последняя ошибка: %v", lastError)
 }
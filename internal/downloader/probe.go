@@ -0,0 +1,71 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// VideoMetadata метаданные видео без скачивания
+type VideoMetadata struct {
+	Title    string  `json:"title"`
+	Duration float64 `json:"duration"` // секунды
+	Filesize int64   `json:"filesize"`
+	// FilesizeApprox оценка yt-dlp, когда точный размер неизвестен
+	FilesizeApprox int64 `json:"filesize_approx"`
+	Height         int   `json:"height"`
+}
+
+// Size возвращает точный или примерный размер файла в байтах
+func (m *VideoMetadata) Size() int64 {
+	if m.Filesize > 0 {
+		return m.Filesize
+	}
+	return m.FilesizeApprox
+}
+
+// YtDlpVersion возвращает версию yt-dlp; ошибка означает, что бинарник недоступен
+func YtDlpVersion(ctx context.Context) (string, error) {
+	output, err := exec.CommandContext(ctx, ytDlpPath(), "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("yt-dlp недоступен: %v", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// FFmpegVersion возвращает первую строку "ffmpeg -version". Без ffmpeg yt-dlp не может
+// склеить отдельные видео- и аудиодорожки и скачивает худшие форматы
+func FFmpegVersion(ctx context.Context) (string, error) {
+	path, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg не найден: %v", err)
+	}
+	output, err := exec.CommandContext(ctx, path, "-version").Output()
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg недоступен: %v", err)
+	}
+	line, _, _ := strings.Cut(string(output), "\n")
+	return strings.TrimSpace(line), nil
+}
+
+// ProbeVideo получает метаданные видео через yt-dlp без скачивания
+func ProbeVideo(url string, timeout time.Duration) (*VideoMetadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, ytDlpPath(), "--dump-single-json", "--skip-download", "--no-warnings",
+		"-f", "bestvideo[ext=mp4]+bestaudio[ext=m4a]/best[ext=mp4]/best", url)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("yt-dlp error: %v", err)
+	}
+
+	var meta VideoMetadata
+	if err := json.Unmarshal(output, &meta); err != nil {
+		return nil, fmt.Errorf("ошибка разбора метаданных yt-dlp: %v", err)
+	}
+	return &meta, nil
+}
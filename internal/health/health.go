@@ -0,0 +1,165 @@
+// Package health собирает отчет о состоянии зависимостей бота для /readyz и команды /health
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Status итог проверки
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusDegraded Status = "degraded" // не прошла необязательная проверка
+	StatusFail     Status = "fail"     // не прошла обязательная проверка
+)
+
+// Check проверка одной зависимости. Run возвращает описание состояния для отчета
+type Check struct {
+	Name     string
+	Critical bool // без зависимости бот не может работать
+	Run      func(ctx context.Context) (string, error)
+}
+
+// Result результат одной проверки
+type Result struct {
+	Name       string `json:"name"`
+	Status     Status `json:"status"`
+	Critical   bool   `json:"critical"`
+	Detail     string `json:"detail,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Report отчет о состоянии
+type Report struct {
+	Status    Status    `json:"status"`
+	CheckedAt time.Time `json:"checked_at"`
+	Checks    []Result  `json:"checks"`
+}
+
+// HTTPStatus возвращает код ответа: 503, если не прошла обязательная проверка
+func (r Report) HTTPStatus() int {
+	if r.Status == StatusFail {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+// Checker выполняет проверки параллельно и кэширует отчет, чтобы частые запросы
+// оркестратора не нагружали БД и Bot API
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+	ttl     time.Duration
+
+	mutex sync.Mutex
+	last  *Report
+}
+
+// NewChecker создает набор проверок. timeout ограничивает каждую проверку, ttl — время жизни отчета
+func NewChecker(timeout, ttl time.Duration, checks ...Check) *Checker {
+	return &Checker{checks: checks, timeout: timeout, ttl: ttl}
+}
+
+// Report возвращает отчет; force — не использовать кэш. Отчет, собранный под уже
+// отмененным ctx, не кэшируется: его ошибки относятся к вызывающему, а не к зависимостям
+func (c *Checker) Report(ctx context.Context, force bool) Report {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !force && c.last != nil && time.Since(c.last.CheckedAt) < c.ttl {
+		return *c.last
+	}
+
+	report := Report{Status: StatusOK, CheckedAt: time.Now(), Checks: make([]Result, len(c.checks))}
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, r := range report.Checks {
+		switch {
+		case r.Status == StatusFail && r.Critical:
+			report.Status = StatusFail
+		case r.Status == StatusFail && report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+	}
+
+	if ctx.Err() == nil {
+		c.last = &report
+	}
+	return report
+}
+
+// run выполняет проверку с таймаутом
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	started := time.Now()
+	type outcome struct {
+		detail string
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		detail, err := check.Run(ctx)
+		done <- outcome{detail, err}
+	}()
+
+	result := Result{Name: check.Name, Critical: check.Critical, Status: StatusOK}
+	select {
+	case o := <-done:
+		result.Detail = o.detail
+		if o.err != nil {
+			result.Status = StatusFail
+			result.Error = o.err.Error()
+		}
+	case <-ctx.Done():
+		result.Status = StatusFail
+		result.Error = ctx.Err().Error()
+	}
+	result.DurationMS = time.Since(started).Milliseconds()
+	return result
+}
+
+// ReadyHandler отдает отчет о зависимостях в JSON. Эндпоинт открыт без авторизации,
+// поэтому всегда отвечает из кэша: проверку заново запускает только команда /health.
+// Проверки не зависят от запроса: отключившаяся проба не должна их прерывать,
+// время каждой ограничено таймаутом Checker
+func ReadyHandler(c *Checker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Report(context.WithoutCancel(r.Context()), false)
+		writeJSON(w, report.HTTPStatus(), report)
+	})
+}
+
+// LiveHandler отвечает, пока процесс обрабатывает запросы. Зависимости не проверяются,
+// чтобы недоступность БД или Bot API не приводила к перезапуску контейнера
+func LiveHandler(started time.Time) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status":         StatusOK,
+			"uptime_seconds": int64(time.Since(started).Seconds()),
+		})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
@@ -0,0 +1,181 @@
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// embeddedTranslations переводы по умолчанию, встроенные в бинарник
+//
+//go:embed translations/*.json
+var embeddedTranslations embed.FS
+
+// embeddedDir директория переводов внутри embeddedTranslations
+const embeddedDir = "translations"
+
+// LoadEmbedded загружает встроенные в бинарник переводы
+func (m *Manager) LoadEmbedded() error {
+	translations, err := readTranslations(embeddedTranslations, embeddedDir)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	mergeTranslations(m.translations, translations)
+	m.mutex.Unlock()
+	return nil
+}
+
+// Reload заново собирает переводы из встроенных файлов и директории overrideDir
+// (если она задана), проверяет их и только затем атомарно подменяет текущие.
+// При ошибке продолжают использоваться прежние переводы.
+// Возвращает количество ключей по языкам
+func (m *Manager) Reload(overrideDir string) (map[string]int, error) {
+	next, err := readTranslations(embeddedTranslations, embeddedDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if overrideDir != "" {
+		overrides, err := readTranslations(os.DirFS(overrideDir), ".")
+		if err != nil {
+			return nil, fmt.Errorf("ошибка загрузки переводов из %s: %v", overrideDir, err)
+		}
+		mergeTranslations(next, overrides)
+	}
+
+	if err := validateTranslations(m.fallbackLang, next); err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	m.translations = next
+	m.mutex.Unlock()
+
+	counts := m.KeyCounts()
+	slog.Debug("Переводы перезагружены", "component", "I18N", "counts", counts)
+	return counts, nil
+}
+
+// KeyCounts возвращает количество ключей по каждому загруженному языку
+func (m *Manager) KeyCounts() map[string]int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	counts := make(map[string]int, len(m.translations))
+	for lang, translations := range m.translations {
+		counts[lang] = len(translations)
+	}
+	return counts
+}
+
+// Watch следит за изменениями файлов в overrideDir и перезагружает переводы.
+// onReload вызывается после каждой попытки перезагрузки. Блокирует до отмены ctx
+func (m *Manager) Watch(ctx context.Context, overrideDir string, interval time.Duration, onReload func(map[string]int, error)) {
+	if overrideDir == "" || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastSignature := dirSignature(overrideDir)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			signature := dirSignature(overrideDir)
+			if signature == lastSignature {
+				continue
+			}
+			lastSignature = signature
+
+			counts, err := m.Reload(overrideDir)
+			if onReload != nil {
+				onReload(counts, err)
+			}
+		}
+	}
+}
+
+// dirSignature описывает состояние json-файлов директории для обнаружения изменений
+func dirSignature(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+
+	var parts []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s|%d|%d", entry.Name(), info.Size(), info.ModTime().UnixNano()))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ";")
+}
+
+// readTranslations читает все файлы <язык>.json из директории dir файловой системы fsys
+func readTranslations(fsys fs.FS, dir string) (map[string]map[string]interface{}, error) {
+	files, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения директории переводов: %v", err)
+	}
+
+	result := make(map[string]map[string]interface{})
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		lang := strings.TrimSuffix(file.Name(), ".json")
+		filePath := path.Join(dir, file.Name())
+
+		// Читаем файл перевода
+		data, err := fs.ReadFile(fsys, filePath)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения файла %s: %v", filePath, err)
+		}
+
+		// Парсим JSON
+		var raw map[string]interface{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("ошибка парсинга JSON в файле %s: %v", filePath, err)
+		}
+
+		// Вложенные объекты превращаем в ключи через точку: {"stats": {"total": ...}} -> "stats.total"
+		translations := make(map[string]interface{}, len(raw))
+		flattenTranslations("", raw, translations)
+
+		result[lang] = translations
+	}
+
+	return result, nil
+}
+
+// mergeTranslations добавляет ключи src поверх dst
+func mergeTranslations(dst, src map[string]map[string]interface{}) {
+	for lang, translations := range src {
+		if dst[lang] == nil {
+			dst[lang] = make(map[string]interface{}, len(translations))
+		}
+		for key, value := range translations {
+			dst[lang][key] = value
+		}
+	}
+}
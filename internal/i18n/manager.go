@@ -1,193 +1,226 @@
 package i18n
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
+	"log/slog"
+	"sort"
 	"strings"
 	"sync"
-	"text/template"
+	"time"
 
 	tele "gopkg.in/telebot.v4"
 )
 
+// DefaultPreferenceTTL время жизни закэшированного языка пользователя
+const DefaultPreferenceTTL = 10 * time.Minute
+
+// LanguageStore хранит язык, выбранный пользователем вручную
+type LanguageStore interface {
+	// GetUserLanguage возвращает сохраненный язык или пустую строку, если выбора не было
+	GetUserLanguage(userID int64) (string, error)
+	SetUserLanguage(userID int64, lang string) error
+}
+
+// cachedPreference запись кэша пользовательских предпочтений
+type cachedPreference struct {
+	lang      string
+	expiresAt time.Time
+}
+
 // Manager управляет локализацией
 type Manager struct {
 	translations map[string]map[string]interface{}
 	mutex        sync.RWMutex
 	fallbackLang string
+
+	store         LanguageStore
+	preferences   map[int64]cachedPreference
+	prefMutex     sync.Mutex
+	preferenceTTL time.Duration
 }
 
 // NewManager создает новый менеджер локализации
 func NewManager(fallbackLang string) *Manager {
 	return &Manager{
-		translations: make(map[string]map[string]interface{}),
-		fallbackLang: fallbackLang,
+		translations:  make(map[string]map[string]interface{}),
+		fallbackLang:  fallbackLang,
+		preferences:   make(map[int64]cachedPreference),
+		preferenceTTL: DefaultPreferenceTTL,
 	}
 }
 
-// LoadTranslations загружает переводы из файлов
-func (m *Manager) LoadTranslations(translationsDir string) error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
+// SetLanguageStore подключает хранилище выбранных пользователями языков
+func (m *Manager) SetLanguageStore(store LanguageStore, ttl time.Duration) {
+	m.prefMutex.Lock()
+	defer m.prefMutex.Unlock()
 
-	fmt.Printf("[I18N] Загружаем переводы из директории: %s\n", translationsDir)
+	m.store = store
+	if ttl > 0 {
+		m.preferenceTTL = ttl
+	}
+	m.preferences = make(map[int64]cachedPreference)
+}
 
-	// Читаем все файлы переводов из директории
-	files, err := os.ReadDir(translationsDir)
-	if err != nil {
-		return fmt.Errorf("ошибка чтения директории переводов: %v", err)
+// GetUserLanguage определяет язык пользователя: сначала выбранный через /language,
+// затем язык клиента Telegram
+func (m *Manager) GetUserLanguage(user *tele.User) string {
+	if user == nil {
+		return m.fallbackLang
 	}
 
-	fmt.Printf("[I18N] Найдено файлов в директории: %d\n", len(files))
+	if lang := m.storedLanguage(user.ID); lang != "" && m.HasLanguage(lang) {
+		return lang
+	}
 
-	for _, file := range files {
-		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
-			continue
-		}
+	// Проверяем язык пользователя из Telegram
+	if lang := m.ResolveLanguage(user.LanguageCode); lang != "" {
+		return lang
+	}
 
-		lang := strings.TrimSuffix(file.Name(), ".json")
-		filePath := filepath.Join(translationsDir, file.Name())
+	return m.fallbackLang
+}
 
-		fmt.Printf("[I18N] Загружаем язык: %s из файла: %s\n", lang, filePath)
+// ResolveLanguage сопоставляет код языка с загруженными переводами.
+// Возвращает пустую строку, если подходящего перевода нет
+func (m *Manager) ResolveLanguage(code string) string {
+	if code == "" {
+		return ""
+	}
+	lang := strings.ToLower(code)
 
-		// Читаем файл перевода
-		data, err := os.ReadFile(filePath)
-		if err != nil {
-			return fmt.Errorf("ошибка чтения файла %s: %v", filePath, err)
-		}
+	// Проверяем, есть ли перевод для этого языка
+	if m.HasLanguage(lang) {
+		return lang
+	}
 
-		// Парсим JSON
-		var translations map[string]interface{}
-		if err := json.Unmarshal(data, &translations); err != nil {
-			return fmt.Errorf("ошибка парсинга JSON в файле %s: %v", filePath, err)
+	// Если нет точного совпадения, пробуем найти по префиксу языка
+	// Например, для "ru-RU" ищем "ru"
+	if idx := strings.Index(lang, "-"); idx > 0 {
+		if baseLang := lang[:idx]; m.HasLanguage(baseLang) {
+			return baseLang
 		}
-
-		m.translations[lang] = translations
-		fmt.Printf("[I18N] Загружено %d переводов для языка %s\n", len(translations), lang)
 	}
-
-	fmt.Printf("[I18N] Всего загружено языков: %d\n", len(m.translations))
-	return nil
+	return ""
 }
 
-// GetUserLanguage определяет язык пользователя из Telegram
-func (m *Manager) GetUserLanguage(user *tele.User) string {
-	if user == nil {
-		return m.fallbackLang
+// SetUserLanguage сохраняет выбранный пользователем язык
+func (m *Manager) SetUserLanguage(userID int64, lang string) error {
+	if !m.HasLanguage(lang) {
+		return fmt.Errorf("язык %s не поддерживается", lang)
 	}
 
-	// Проверяем язык пользователя из Telegram
-	if user.LanguageCode != "" {
-		lang := strings.ToLower(user.LanguageCode)
-
-		// Проверяем, есть ли перевод для этого языка
-		if _, exists := m.translations[lang]; exists {
-			return lang
-		}
+	m.prefMutex.Lock()
+	store := m.store
+	m.prefMutex.Unlock()
 
-		// Если нет точного совпадения, пробуем найти по префиксу языка
-		// Например, для "ru-RU" ищем "ru"
-		if idx := strings.Index(lang, "-"); idx > 0 {
-			baseLang := lang[:idx]
-			if _, exists := m.translations[baseLang]; exists {
-				return baseLang
-			}
+	if store != nil {
+		if err := store.SetUserLanguage(userID, lang); err != nil {
+			return err
 		}
 	}
 
-	return m.fallbackLang
+	m.prefMutex.Lock()
+	m.preferences[userID] = cachedPreference{lang: lang, expiresAt: time.Now().Add(m.preferenceTTL)}
+	m.prefMutex.Unlock()
+	return nil
 }
 
-// T возвращает переведенный текст для пользователя
-func (m *Manager) T(user *tele.User, key string, args ...interface{}) string {
-	lang := m.GetUserLanguage(user)
+// storedLanguage возвращает сохраненный язык пользователя, обращаясь к хранилищу
+// только при отсутствии свежей записи в кэше
+func (m *Manager) storedLanguage(userID int64) string {
+	m.prefMutex.Lock()
+	store := m.store
+	cached, ok := m.preferences[userID]
+	m.prefMutex.Unlock()
 
-	m.mutex.RLock()
-	translations, exists := m.translations[lang]
-	m.mutex.RUnlock()
-
-	if !exists {
-		// Если перевод не найден, используем fallback
-		m.mutex.RLock()
-		translations, exists = m.translations[m.fallbackLang]
-		m.mutex.RUnlock()
-
-		if !exists {
-			// Отладочная информация
-			fmt.Printf("[I18N] Ошибка: нет переводов для языка %s и fallback %s\n", lang, m.fallbackLang)
-			fmt.Printf("[I18N] Доступные языки: %v\n", m.GetAvailableLanguages())
-			return key // Возвращаем ключ, если нет переводов вообще
-		}
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.lang
+	}
+	if store == nil {
+		return ""
 	}
 
-	var textRaw interface{}
-	var ok bool
-	if textRaw, ok = translations[key]; !ok {
-		// Если ключ не найден в текущем языке, ищем в fallback
-		m.mutex.RLock()
-		fallbackTranslations := m.translations[m.fallbackLang]
-		m.mutex.RUnlock()
-		textRaw, ok = fallbackTranslations[key]
-		if !ok {
-			fmt.Printf("[I18N] Ошибка: ключ '%s' не найден в языке %s и fallback %s\n", key, lang, m.fallbackLang)
-			return key
-		}
+	lang, err := store.GetUserLanguage(userID)
+	if err != nil {
+		slog.Warn("Ошибка чтения языка пользователя", "component", "I18N", "user_id", userID, "error", err)
+		// Не кэшируем ошибку, но и не ломаем перевод
+		return cached.lang
 	}
 
-	// Если перевод — массив строк, склеиваем через \n
-	type templateData map[string]interface{}
+	// Кэшируем и пустой результат, чтобы не ходить в БД на каждое сообщение
+	m.prefMutex.Lock()
+	m.preferences[userID] = cachedPreference{lang: lang, expiresAt: time.Now().Add(m.preferenceTTL)}
+	m.prefMutex.Unlock()
+	return lang
+}
 
-	tmplApply := func(tmplStr string, data templateData) string {
-		tmpl, err := template.New("").Parse(tmplStr)
-		if err != nil {
-			return tmplStr // если шаблон не парсится, возвращаем как есть
-		}
-		var buf bytes.Buffer
-		err = tmpl.Execute(&buf, data)
-		if err != nil {
-			return tmplStr // если ошибка подстановки, возвращаем как есть
+// T возвращает переведенный текст для пользователя
+func (m *Manager) T(user *tele.User, key string, args ...interface{}) string {
+	return m.TL(m.GetUserLanguage(user), key, args...)
+}
+
+// TL возвращает переведенный текст для указанного языка.
+//
+// Аргументы передаются либо одним значением Args для именованных плейсхолдеров
+// вида {Name} и {Name:type}, либо позиционно для строк с printf-глаголами.
+// Если перевод задан формами множественного числа, форма выбирается по
+// аргументу Count (или по первому числовому позиционному аргументу)
+func (m *Manager) TL(lang, key string, args ...interface{}) string {
+	textRaw, foundLang, ok := m.lookup(lang, key)
+	if !ok {
+		slog.Error("Ключ перевода не найден", "component", "I18N", "key", key, "lang", lang, "fallback", m.fallbackLang)
+		return key // Возвращаем ключ, если перевода нет
+	}
+
+	if forms, isPlural := textRaw.(map[string]interface{}); isPlural {
+		count, _ := pluralCount(args)
+		category := PluralCategory(foundLang, count)
+		if textRaw, ok = forms[category]; !ok {
+			textRaw = forms[PluralOther]
 		}
-		return buf.String()
 	}
 
+	var text string
 	switch v := textRaw.(type) {
 	case string:
-		if len(args) == 1 {
-			if data, ok := args[0].(map[string]interface{}); ok {
-				return tmplApply(v, data)
-			}
-		}
-		if len(args) > 0 {
-			return fmt.Sprintf(v, args...)
-		}
-		return v
+		text = v
 	case []interface{}:
+		// Если перевод — массив строк, склеиваем через \n
 		lines := make([]string, 0, len(v))
 		for _, line := range v {
-			lineStr := fmt.Sprintf("%v", line)
-			if len(args) == 1 {
-				if data, ok := args[0].(map[string]interface{}); ok {
-					lineStr = tmplApply(lineStr, data)
-				}
-			}
-			lines = append(lines, lineStr)
-		}
-		joined := strings.Join(lines, "\n")
-		if len(args) > 0 && (len(args) != 1 || !isMapStringInterface(args[0])) {
-			return fmt.Sprintf(joined, args...)
+			lines = append(lines, fmt.Sprintf("%v", line))
 		}
-		return joined
+		text = strings.Join(lines, "\n")
 	default:
 		return fmt.Sprintf("[I18N] Некорректный тип перевода для ключа %s", key)
 	}
+
+	if len(args) == 1 {
+		if named, ok := args[0].(Args); ok {
+			return renderNamed(text, named)
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
 }
 
-func isMapStringInterface(arg interface{}) bool {
-	_, ok := arg.(map[string]interface{})
-	return ok
+// lookup ищет ключ в указанном языке, затем в fallback.
+// Возвращает значение и язык, в котором оно найдено
+func (m *Manager) lookup(lang, key string) (interface{}, string, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if translations, exists := m.translations[lang]; exists {
+		if v, ok := translations[key]; ok {
+			return v, lang, true
+		}
+	}
+	if v, ok := m.translations[m.fallbackLang][key]; ok {
+		return v, m.fallbackLang, true
+	}
+	return nil, "", false
 }
 
 // GetAvailableLanguages возвращает список доступных языков
@@ -199,9 +232,15 @@ func (m *Manager) GetAvailableLanguages() []string {
 	for lang := range m.translations {
 		languages = append(languages, lang)
 	}
+	sort.Strings(languages)
 	return languages
 }
 
+// FallbackLanguage язык для пользователей, чей язык неизвестен
+func (m *Manager) FallbackLanguage() string {
+	return m.fallbackLang
+}
+
 // HasLanguage проверяет, есть ли переводы для указанного языка
 func (m *Manager) HasLanguage(lang string) bool {
 	m.mutex.RLock()
@@ -210,3 +249,12 @@ func (m *Manager) HasLanguage(lang string) bool {
 	_, exists := m.translations[lang]
 	return exists
 }
+
+// HasKey проверяет, есть ли ключ в переводах указанного языка
+func (m *Manager) HasKey(lang, key string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	_, exists := m.translations[lang][key]
+	return exists
+}
@@ -0,0 +1,172 @@
+package i18n
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Args именованные аргументы перевода: ключи соответствуют плейсхолдерам {Name}
+type Args = map[string]interface{}
+
+// Типы именованных плейсхолдеров ({Name:type})
+const (
+	PlaceholderString   = "string"
+	PlaceholderInt      = "int"
+	PlaceholderNumber   = "number"
+	PlaceholderDate     = "date"
+	PlaceholderDuration = "duration"
+)
+
+// namedPlaceholderRe находит плейсхолдеры вида {Name} и {Name:type}
+var namedPlaceholderRe = regexp.MustCompile(`\{([A-Za-z][A-Za-z0-9_]*)(?::([a-z]+))?\}`)
+
+// printfVerbRe находит printf-глаголы (%s, %d, %v, %.1f и т.п.)
+var printfVerbRe = regexp.MustCompile(`%[-+# 0]*[0-9]*(?:\.[0-9]+)?[a-zA-Z%]`)
+
+// renderNamed подставляет именованные аргументы. Плейсхолдеры без значения остаются как есть
+func renderNamed(text string, args Args) string {
+	return namedPlaceholderRe.ReplaceAllStringFunc(text, func(match string) string {
+		parts := namedPlaceholderRe.FindStringSubmatch(match)
+		value, ok := args[parts[1]]
+		if !ok {
+			return match
+		}
+		return formatTyped(value, parts[2])
+	})
+}
+
+// formatTyped форматирует значение в соответствии с типом плейсхолдера
+func formatTyped(value interface{}, typ string) string {
+	switch typ {
+	case PlaceholderInt:
+		if n, ok := toInt64(value); ok {
+			return strconv.FormatInt(n, 10)
+		}
+	case PlaceholderNumber:
+		switch v := value.(type) {
+		case float32:
+			return strconv.FormatFloat(float64(v), 'f', -1, 32)
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		if n, ok := toInt64(value); ok {
+			return strconv.FormatInt(n, 10)
+		}
+	case PlaceholderDate:
+		if t, ok := value.(time.Time); ok {
+			return t.Format("2006-01-02 15:04")
+		}
+	case PlaceholderDuration:
+		if d, ok := value.(time.Duration); ok {
+			return d.Round(time.Second).String()
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// pluralCount извлекает число для выбора формы множественного числа
+func pluralCount(args []interface{}) (int64, bool) {
+	if len(args) == 1 {
+		if named, ok := args[0].(Args); ok {
+			return toInt64(named["Count"])
+		}
+	}
+	for _, arg := range args {
+		if n, ok := toInt64(arg); ok {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// flattenTranslations раскладывает вложенные объекты в ключи через точку.
+// Объекты с формами множественного числа остаются значениями
+func flattenTranslations(prefix string, src, dst map[string]interface{}) {
+	for k, v := range src {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if obj, ok := v.(map[string]interface{}); ok && !isPluralForms(obj) {
+			flattenTranslations(key, obj, dst)
+			continue
+		}
+		dst[key] = v
+	}
+}
+
+// placeholderSignature возвращает отсортированный список плейсхолдеров перевода:
+// именованные как {Name:type}, printf-глаголы с их позицией
+func placeholderSignature(value interface{}) []string {
+	set := make(map[string]struct{})
+	collectPlaceholders(value, set)
+
+	result := make([]string, 0, len(set))
+	for p := range set {
+		result = append(result, p)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func collectPlaceholders(value interface{}, set map[string]struct{}) {
+	switch v := value.(type) {
+	case string:
+		for _, m := range namedPlaceholderRe.FindAllStringSubmatch(v, -1) {
+			typ := m[2]
+			if typ == "" {
+				typ = PlaceholderString
+			}
+			set["{"+m[1]+":"+typ+"}"] = struct{}{}
+		}
+		verbs := 0
+		for _, verb := range printfVerbRe.FindAllString(v, -1) {
+			if verb == "%%" {
+				continue
+			}
+			verbs++
+			set[fmt.Sprintf("%%%d%s", verbs, verb[len(verb)-1:])] = struct{}{}
+		}
+	case []interface{}:
+		// Строки массива склеиваются в одну, поэтому нумерация глаголов сквозная
+		lines := make([]string, 0, len(v))
+		for _, line := range v {
+			lines = append(lines, fmt.Sprintf("%v", line))
+		}
+		collectPlaceholders(strings.Join(lines, "\n"), set)
+	case map[string]interface{}:
+		for _, form := range v {
+			collectPlaceholders(form, set)
+		}
+	}
+}
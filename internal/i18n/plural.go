@@ -0,0 +1,101 @@
+package i18n
+
+// Категории множественного числа по CLDR
+const (
+	PluralZero  = "zero"
+	PluralOne   = "one"
+	PluralTwo   = "two"
+	PluralFew   = "few"
+	PluralMany  = "many"
+	PluralOther = "other"
+)
+
+// pluralRule описывает правило выбора формы для языка
+type pluralRule struct {
+	categories []string
+	choose     func(n int64) string
+}
+
+// pluralRules правила CLDR для целых чисел по поддерживаемым языкам
+var pluralRules = map[string]pluralRule{
+	"ru": {
+		categories: []string{PluralOne, PluralFew, PluralMany, PluralOther},
+		choose: func(n int64) string {
+			mod10, mod100 := n%10, n%100
+			switch {
+			case mod10 == 1 && mod100 != 11:
+				return PluralOne
+			case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+				return PluralFew
+			default:
+				return PluralMany
+			}
+		},
+	},
+	"en": {
+		categories: []string{PluralOne, PluralOther},
+		choose: func(n int64) string {
+			if n == 1 {
+				return PluralOne
+			}
+			return PluralOther
+		},
+	},
+	"es": {
+		categories: []string{PluralOne, PluralOther},
+		choose: func(n int64) string {
+			if n == 1 {
+				return PluralOne
+			}
+			return PluralOther
+		},
+	},
+	"fr": {
+		categories: []string{PluralOne, PluralOther},
+		choose: func(n int64) string {
+			if n == 0 || n == 1 {
+				return PluralOne
+			}
+			return PluralOther
+		},
+	},
+}
+
+// defaultPluralRule используется для языков без собственного правила
+var defaultPluralRule = pluralRules["en"]
+
+// PluralCategory возвращает категорию множественного числа для n в языке lang
+func PluralCategory(lang string, n int64) string {
+	if n < 0 {
+		n = -n
+	}
+	return pluralRuleFor(lang).choose(n)
+}
+
+// PluralCategories возвращает категории, которые должен задавать перевод языка lang
+func PluralCategories(lang string) []string {
+	return pluralRuleFor(lang).categories
+}
+
+func pluralRuleFor(lang string) pluralRule {
+	if rule, ok := pluralRules[lang]; ok {
+		return rule
+	}
+	return defaultPluralRule
+}
+
+// isPluralForms проверяет, что объект перевода — набор форм множественного числа,
+// а не вложенная группа ключей
+func isPluralForms(obj map[string]interface{}) bool {
+	if _, ok := obj[PluralOther]; !ok {
+		return false
+	}
+	for k := range obj {
+		switch k {
+		case PluralZero, PluralOne, PluralTwo, PluralFew, PluralMany, PluralOther:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidationError содержит все найденные проблемы в переводах
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("переводы не прошли проверку (%d проблем):\n%s", len(e.Problems), strings.Join(e.Problems, "\n"))
+}
+
+// Validate сверяет все языки с fallback: отсутствующие ключи, несовпадающие
+// плейсхолдеры и неполные формы множественного числа
+func (m *Manager) Validate() error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return validateTranslations(m.fallbackLang, m.translations)
+}
+
+func validateTranslations(fallbackLang string, all map[string]map[string]interface{}) error {
+	fallback, ok := all[fallbackLang]
+	if !ok {
+		return &ValidationError{Problems: []string{fmt.Sprintf("не загружен fallback язык %s", fallbackLang)}}
+	}
+
+	keys := make([]string, 0, len(fallback))
+	for key := range fallback {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	langs := make([]string, 0, len(all))
+	for lang := range all {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+
+	var problems []string
+	for _, lang := range langs {
+		translations := all[lang]
+		for _, key := range keys {
+			value, exists := translations[key]
+			if !exists {
+				problems = append(problems, fmt.Sprintf("%s: отсутствует ключ %q", lang, key))
+				continue
+			}
+
+			if forms, isPlural := value.(map[string]interface{}); isPlural {
+				for _, category := range PluralCategories(lang) {
+					if _, ok := forms[category]; !ok {
+						problems = append(problems, fmt.Sprintf("%s: ключ %q без формы множественного числа %q", lang, key, category))
+					}
+				}
+			}
+
+			if lang == fallbackLang {
+				continue
+			}
+			want := placeholderSignature(fallback[key])
+			got := placeholderSignature(value)
+			if strings.Join(want, " ") != strings.Join(got, " ") {
+				problems = append(problems, fmt.Sprintf("%s: ключ %q содержит плейсхолдеры %v, ожидались %v", lang, key, got, want))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package logging
+
+import "context"
+
+// Fields поля запроса, которые добавляются ко всем записям, сделанным с контекстом
+type Fields struct {
+	RequestID string
+	UserID    int64
+	ChatID    int64
+}
+
+type fieldsKey struct{}
+
+// WithFields добавляет поля запроса в контекст. Пустые значения не затирают уже заданные
+func WithFields(ctx context.Context, f Fields) context.Context {
+	if cur, ok := FieldsFrom(ctx); ok {
+		if f.RequestID == "" {
+			f.RequestID = cur.RequestID
+		}
+		if f.UserID == 0 {
+			f.UserID = cur.UserID
+		}
+		if f.ChatID == 0 {
+			f.ChatID = cur.ChatID
+		}
+	}
+	return context.WithValue(ctx, fieldsKey{}, f)
+}
+
+// FieldsFrom возвращает поля запроса из контекста
+func FieldsFrom(ctx context.Context) (Fields, bool) {
+	if ctx == nil {
+		return Fields{}, false
+	}
+	f, ok := ctx.Value(fieldsKey{}).(Fields)
+	return f, ok
+}
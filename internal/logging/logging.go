@@ -0,0 +1,107 @@
+// Package logging настраивает структурированное логирование на log/slog: уровень и формат
+// задаются конфигурацией, поля запроса (request_id, user_id, chat_id) передаются через
+// context.Context, а токены и идентификаторы платежей маскируются перед записью
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Форматы вывода логов
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ParseLevel разбирает уровень логирования: debug, info, warn (warning), error. Пустая строка — info
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("неизвестный уровень логирования: %s", s)
+	}
+}
+
+// Setup настраивает логгер по умолчанию для slog и стандартного пакета log.
+// format — text или json (пустая строка — text)
+func Setup(level, format string) error {
+	return SetupWriter(os.Stderr, level, format)
+}
+
+// SetupWriter как Setup, но пишет в w
+func SetupWriter(w io.Writer, level, format string) error {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: redactAttr}
+	var handler slog.Handler
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", FormatText:
+		handler = slog.NewTextHandler(w, opts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("неизвестный формат логов: %s", format)
+	}
+
+	slog.SetDefault(slog.New(&contextHandler{Handler: handler}))
+	return nil
+}
+
+// Component возвращает логгер с полем component. Логгер привязан к текущим настройкам,
+// поэтому его не стоит сохранять в переменные пакета до вызова Setup
+func Component(name string) *slog.Logger {
+	return slog.Default().With("component", name)
+}
+
+// contextHandler добавляет к записи поля запроса из контекста и маскирует секреты в тексте
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if f, ok := FieldsFrom(ctx); ok {
+		if f.RequestID != "" {
+			r.AddAttrs(slog.String("request_id", f.RequestID))
+		}
+		if f.UserID != 0 {
+			r.AddAttrs(slog.Int64("user_id", f.UserID))
+		}
+		if f.ChatID != 0 {
+			r.AddAttrs(slog.Int64("chat_id", f.ChatID))
+		}
+	}
+
+	// Сообщение не проходит через ReplaceAttr, поэтому маскируем его отдельно
+	if redacted := Redact(r.Message); redacted != r.Message {
+		clean := slog.NewRecord(r.Time, r.Level, redacted, r.PC)
+		r.Attrs(func(a slog.Attr) bool {
+			clean.AddAttrs(a)
+			return true
+		})
+		r = clean
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
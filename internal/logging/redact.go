@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// botTokenPattern токен Telegram-бота: "<id>:<секрет>". Попадает в логи, например,
+// в текстах ошибок HTTP-клиента вместе с URL запроса к Bot API
+var botTokenPattern = regexp.MustCompile(`\d{6,}:[A-Za-z0-9_-]{30,}`)
+
+// sensitiveKeys атрибуты, значения которых всегда маскируются
+var sensitiveKeys = map[string]bool{
+	"token":          true,
+	"provider_token": true,
+	"charge_id":      true,
+	"password":       true,
+	"dsn":            true,
+}
+
+// Redact маскирует токены ботов в произвольном тексте
+func Redact(s string) string {
+	return botTokenPattern.ReplaceAllStringFunc(s, func(token string) string {
+		id, _, _ := strings.Cut(token, ":")
+		return id + ":***"
+	})
+}
+
+// Mask скрывает значение, оставляя первые символы для сопоставления записей: "stxAb***"
+func Mask(s string) string {
+	const visible = 5
+	if s == "" {
+		return ""
+	}
+	if len(s) <= visible*2 {
+		return "***"
+	}
+	return s[:visible] + "***"
+}
+
+// redactAttr маскирует секретные атрибуты и токены в строковых значениях и ошибках
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Mask(a.Value.String()))
+	}
+
+	var v string
+	switch a.Value.Kind() {
+	case slog.KindString:
+		v = a.Value.String()
+	case slog.KindAny:
+		err, ok := a.Value.Any().(error)
+		if !ok {
+			return a
+		}
+		v = err.Error()
+	default:
+		return a
+	}
+	if botTokenPattern.MatchString(v) {
+		return slog.String(a.Key, Redact(v))
+	}
+	return a
+}
@@ -0,0 +1,114 @@
+// Package metrics содержит метрики Prometheus бота: апдейты, скачивания, кэш, платежи,
+// очередь скачиваний и ошибки Telegram Bot API. Метрики регистрируются в реестре по умолчанию
+// и отдаются через Handler
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ytbot"
+
+// Исходы операций для меток outcome
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+var (
+	// Updates апдейты Telegram по типу (см. getUpdateType)
+	Updates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "updates_total",
+		Help:      "Апдейты Telegram по типу",
+	}, []string{"type"})
+
+	// DownloadDuration длительность попыток скачивания по стратегии yt-dlp и исходу
+	DownloadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "download_duration_seconds",
+		Help:      "Длительность попыток скачивания по стратегии и исходу",
+		Buckets:   []float64{1, 2.5, 5, 10, 20, 30, 60, 120, 300, 600},
+	}, []string{"strategy", "outcome"})
+
+	// DownloadedBytes объем успешно скачанных файлов
+	DownloadedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "downloaded_bytes_total",
+		Help:      "Объем скачанных видео в байтах",
+	})
+
+	// CacheLookups обращения к кэшу file_id: hit, miss, error
+	CacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Обращения к кэшу видео по результату",
+	}, []string{"result"})
+
+	// Payments успешные платежи по типу
+	Payments = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payments_total",
+		Help:      "Успешные платежи по типу",
+	}, []string{"type"})
+
+	// PaymentStars сумма платежей в Stars по типу
+	PaymentStars = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payment_stars_total",
+		Help:      "Сумма платежей в Telegram Stars по типу",
+	}, []string{"type"})
+
+	// Refunds попытки возврата по типу и исходу
+	Refunds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "refunds_total",
+		Help:      "Попытки возврата по типу и исходу",
+	}, []string{"type", "outcome"})
+
+	// TelegramRequests запросы к Bot API по методу
+	TelegramRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_api_requests_total",
+		Help:      "Запросы к Telegram Bot API по методу",
+	}, []string{"method"})
+
+	// TelegramErrors ошибки Bot API по методу: сетевые и ответы с кодом, отличным от 200
+	TelegramErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_api_errors_total",
+		Help:      "Ошибки Telegram Bot API по методу",
+	}, []string{"method"})
+)
+
+// Outcome возвращает метку outcome для результата операции
+func Outcome(success bool) string {
+	if success {
+		return OutcomeSuccess
+	}
+	return OutcomeFailure
+}
+
+// RegisterDownloadGauges регистрирует метрики очереди и занятых слотов скачивания,
+// значения которых читаются при каждом запросе /metrics
+func RegisterDownloadGauges(queueDepth, activeSlots func() float64) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "download_queue_depth",
+		Help:      "Задачи скачивания, ожидающие свободный слот",
+	}, queueDepth)
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "download_active_slots",
+		Help:      "Занятые слоты скачивания",
+	}, activeSlots)
+}
+
+// Handler отдает метрики в формате Prometheus
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
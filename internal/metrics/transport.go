@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+)
+
+// apiTransport считает запросы и ошибки Bot API по методу
+type apiTransport struct {
+	next http.RoundTripper
+}
+
+// InstrumentTransport оборачивает транспорт HTTP-клиента бота. Метод берется из
+// последнего сегмента пути /bot<token>/<method>, поэтому токен в метки не попадает
+func InstrumentTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &apiTransport{next: next}
+}
+
+func (t *apiTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	method := apiMethod(req.URL.Path)
+	TelegramRequests.WithLabelValues(method).Inc()
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		TelegramErrors.WithLabelValues(method).Inc()
+	}
+	return resp, err
+}
+
+// apiMethod определяет метод Bot API по пути запроса
+func apiMethod(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(parts) >= 1 && parts[0] == "file":
+		return "file"
+	case len(parts) == 2 && strings.HasPrefix(parts[0], "bot"):
+		return parts[1]
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,80 @@
+// Package migrate применяет встроенные миграции из migrations/ через библиотеку goose.
+// Таблица версий та же, что у goose CLI (goose_db_version), поэтому базы, размеченные
+// CLI, продолжают с последней примененной миграции
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"path"
+	"text/tabwriter"
+	"time"
+
+	"YoutubeDownloader/internal/logging"
+	"YoutubeDownloader/migrations"
+
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// newProvider создает goose-провайдер. Блокировка сессии не дает двум экземплярам
+// бота применять миграции одновременно
+func newProvider(db *sql.DB) (*goose.Provider, error) {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectPostgres, db, migrations.FS, goose.WithSessionLocker(locker))
+}
+
+// Up применяет все еще не примененные миграции и возвращает их количество
+func Up(ctx context.Context, db *sql.DB) (int, error) {
+	log := logging.Component("MIGRATE")
+
+	provider, err := newProvider(db)
+	if err != nil {
+		return 0, err
+	}
+	results, err := provider.Up(ctx)
+	for _, r := range results {
+		if r.Error != nil {
+			continue
+		}
+		log.Info("Применена миграция", "version", r.Source.Version, "file", path.Base(r.Source.Path), "duration", r.Duration)
+	}
+	if err != nil {
+		return len(results), fmt.Errorf("ошибка применения миграций: %w", err)
+	}
+
+	version, err := provider.GetDBVersion(ctx)
+	if err != nil {
+		return len(results), err
+	}
+	log.Info("Схема БД актуальна", "version", version, "applied", len(results))
+	return len(results), nil
+}
+
+// Status печатает состояние каждой миграции: когда применена или pending
+func Status(ctx context.Context, db *sql.DB, w io.Writer) error {
+	provider, err := newProvider(db)
+	if err != nil {
+		return err
+	}
+	statuses, err := provider.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tAPPLIED AT\tMIGRATION")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.State == goose.StateApplied {
+			applied = s.AppliedAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Source.Version, applied, path.Base(s.Source.Path))
+	}
+	return tw.Flush()
+}
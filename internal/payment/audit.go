@@ -0,0 +1,49 @@
+package payment
+
+import (
+	"database/sql"
+	"time"
+)
+
+// RefundAudit запись о попытке возврата
+type RefundAudit struct {
+	ID            int64
+	TransactionID int64 // 0, если транзакция не найдена в БД
+	ChargeID      string
+	UserID        int64
+	Amount        int
+	AdminID       int64
+	Reason        string
+	Success       bool
+	Response      string
+	CreatedAt     time.Time
+}
+
+// Сохранение попытки возврата в аудит
+func InsertRefundAudit(db *sql.DB, a *RefundAudit) error {
+	var trxID sql.NullInt64
+	if a.TransactionID != 0 {
+		trxID = sql.NullInt64{Int64: a.TransactionID, Valid: true}
+	}
+	_, err := db.Exec(`INSERT INTO refund_audit (transaction_id, charge_id, user_id, amount, admin_id, reason, success, response) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		trxID, a.ChargeID, a.UserID, a.Amount, a.AdminID, a.Reason, a.Success, a.Response)
+	return err
+}
+
+// Получение попыток возврата по транзакции, новые первыми
+func GetRefundAuditByTransaction(db *sql.DB, transactionID int64) ([]RefundAudit, error) {
+	rows, err := db.Query(`SELECT id, COALESCE(transaction_id, 0), charge_id, user_id, amount, admin_id, reason, success, COALESCE(response, ''), created_at FROM refund_audit WHERE transaction_id = $1 ORDER BY created_at DESC`, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []RefundAudit
+	for rows.Next() {
+		var a RefundAudit
+		if err := rows.Scan(&a.ID, &a.TransactionID, &a.ChargeID, &a.UserID, &a.Amount, &a.AdminID, &a.Reason, &a.Success, &a.Response, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, a)
+	}
+	return result, rows.Err()
+}
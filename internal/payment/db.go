@@ -2,7 +2,11 @@ package payment
 
 import (
 	"database/sql"
-	"log"
+	"fmt"
+	"strings"
+	"time"
+
+	"YoutubeDownloader/internal/logging"
 )
 
 // Сохранение транзакции в БД
@@ -15,11 +19,11 @@ func InsertTransaction(db *sql.DB, trx *Transaction) (int64, error) {
 
 // Получение транзакции по charge_id (TelegramPaymentChargeID)
 func GetTransactionByChargeID(db *sql.DB, chargeID string) (*Transaction, error) {
-	row := db.QueryRow(`SELECT id, telegram_payment_charge_id, user_id, amount, invoice_payload, status, type, reason, url, created_at, updated_at FROM transactions WHERE telegram_payment_charge_id = $1`, chargeID)
+	row := db.QueryRow(`SELECT id, telegram_payment_charge_id, user_id, amount, invoice_payload, status, type, reason, url, pricing_rule, created_at, updated_at FROM transactions WHERE telegram_payment_charge_id = $1`, chargeID)
 	var t Transaction
-	var createdAt, updatedAt string
-	var telegramPaymentChargeID, invoicePayload, typeField, reason sql.NullString
-	err := row.Scan(&t.ID, &telegramPaymentChargeID, &t.TelegramUserID, &t.Amount, &invoicePayload, &t.Status, &typeField, &reason, &t.URL, &createdAt, &updatedAt)
+	var updatedAt sql.NullTime
+	var telegramPaymentChargeID, invoicePayload, typeField, reason, pricingRule sql.NullString
+	err := row.Scan(&t.ID, &telegramPaymentChargeID, &t.TelegramUserID, &t.Amount, &invoicePayload, &t.Status, &typeField, &reason, &t.URL, &pricingRule, &t.CreatedAt, &updatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -35,16 +39,18 @@ func GetTransactionByChargeID(db *sql.DB, chargeID string) (*Transaction, error)
 	if reason.Valid {
 		t.Reason = reason.String
 	}
+	t.PricingRule = pricingRule.String
+	t.UpdatedAt = updatedAt.Time
 	return &t, nil
 }
 
 // Получение транзакции по id
 func GetTransactionByID(db *sql.DB, id int64) (*Transaction, error) {
-	row := db.QueryRow(`SELECT id, telegram_payment_charge_id, user_id, amount, invoice_payload, status, type, reason, url, created_at, updated_at FROM transactions WHERE id = $1`, id)
+	row := db.QueryRow(`SELECT id, telegram_payment_charge_id, user_id, amount, invoice_payload, status, type, reason, url, pricing_rule, created_at, updated_at FROM transactions WHERE id = $1`, id)
 	var t Transaction
-	var createdAt, updatedAt string
-	var telegramPaymentChargeID, invoicePayload, typeField, reason sql.NullString
-	err := row.Scan(&t.ID, &telegramPaymentChargeID, &t.TelegramUserID, &t.Amount, &invoicePayload, &t.Status, &typeField, &reason, &t.URL, &createdAt, &updatedAt)
+	var updatedAt sql.NullTime
+	var telegramPaymentChargeID, invoicePayload, typeField, reason, pricingRule sql.NullString
+	err := row.Scan(&t.ID, &telegramPaymentChargeID, &t.TelegramUserID, &t.Amount, &invoicePayload, &t.Status, &typeField, &reason, &t.URL, &pricingRule, &t.CreatedAt, &updatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -60,69 +66,221 @@ func GetTransactionByID(db *sql.DB, id int64) (*Transaction, error) {
 	if reason.Valid {
 		t.Reason = reason.String
 	}
+	t.PricingRule = pricingRule.String
+	t.UpdatedAt = updatedAt.Time
 	return &t, nil
 }
 
-// Получение всех транзакций из БД
-func GetAllTransactionsFromDB(db *sql.DB) ([]Transaction, error) {
-	log.Printf("[DB] Запрашиваем все транзакции из БД")
-	rows, err := db.Query(`SELECT id, telegram_payment_charge_id, user_id, amount, invoice_payload, status, type, reason, url, created_at, updated_at FROM transactions`)
+// Создание транзакции со статусом 'pending' и возврат id
+func CreatePendingTransaction(db *sql.DB, userID int64, amount int, url, pricingRule string) (int64, error) {
+	var id int64
+
+	// Создаем invoice_payload из URL
+	invoicePayload := "video|" + url
+
+	err := db.QueryRow(`INSERT INTO transactions (user_id, amount, status, url, invoice_payload, pricing_rule, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW()) RETURNING id`,
+		userID, amount, "pending", url, invoicePayload, pricingRule).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	logging.Component("DB").Debug("Создана pending транзакция", "id", id, "user_id", userID, "amount", amount, "rule", pricingRule)
+	return id, nil
+}
+
+// Обновление транзакции после оплаты: charge_id, статус и время оплаты
+func UpdateTransactionAfterPayment(db *sql.DB, id int64, chargeID string, status string) error {
+	_, err := db.Exec(`UPDATE transactions SET status = $1, telegram_payment_charge_id = $2, paid_at = COALESCE(paid_at, NOW()), updated_at = NOW() WHERE id = $3`, status, chargeID, id)
+	return err
+}
+
+// Получение последних оплаченных (не pending) транзакций пользователя
+func GetUserPaidTransactions(db *sql.DB, userID int64, limit int) ([]Transaction, error) {
+	rows, err := db.Query(`SELECT id, telegram_payment_charge_id, user_id, amount, invoice_payload, status, type, reason, url, created_at FROM transactions WHERE user_id = $1 AND status <> 'pending' ORDER BY created_at DESC LIMIT $2`, userID, limit)
 	if err != nil {
-		log.Printf("[DB] Ошибка запроса всех транзакций: %v", err)
 		return nil, err
 	}
 	defer rows.Close()
 	var result []Transaction
-	count := 0
 	for rows.Next() {
 		var t Transaction
-		var createdAt, updatedAt string
 		var telegramPaymentChargeID, invoicePayload, typeField, reason sql.NullString
-		err := rows.Scan(&t.ID, &telegramPaymentChargeID, &t.TelegramUserID, &t.Amount, &invoicePayload, &t.Status, &typeField, &reason, &t.URL, &createdAt, &updatedAt)
-		if err != nil {
-			log.Printf("[DB] Ошибка сканирования строки %d: %v", count, err)
-			continue
-		}
-		if telegramPaymentChargeID.Valid {
-			t.TelegramPaymentChargeID = telegramPaymentChargeID.String
-		}
-		if invoicePayload.Valid {
-			t.InvoicePayload = invoicePayload.String
-		}
-		if typeField.Valid {
-			t.Type = typeField.String
-		}
-		if reason.Valid {
-			t.Reason = reason.String
+		if err := rows.Scan(&t.ID, &telegramPaymentChargeID, &t.TelegramUserID, &t.Amount, &invoicePayload, &t.Status, &typeField, &reason, &t.URL, &t.CreatedAt); err != nil {
+			return nil, err
 		}
+		t.TelegramPaymentChargeID = telegramPaymentChargeID.String
+		t.InvoicePayload = invoicePayload.String
+		t.Type = typeField.String
+		t.Reason = reason.String
 		result = append(result, t)
-		count++
-		log.Printf("[DB] Найдена транзакция: id=%d, user_id=%d, status=%s, url=%s", t.ID, t.TelegramUserID, t.Status, t.URL)
 	}
-	log.Printf("[DB] Всего найдено транзакций: %d", count)
-	return result, nil
+	return result, rows.Err()
 }
 
-// Создание транзакции со статусом 'pending' и возврат id
-func CreatePendingTransaction(db *sql.DB, userID int64, amount int, url string) (int64, error) {
-	log.Printf("[DB] Создаём pending транзакцию: user_id=%d, amount=%d, url=%s", userID, amount, url)
+// Сохранение оплаченной транзакции (например, подписки) с charge_id и payload
+func InsertPaidTransaction(db *sql.DB, trx *Transaction) (int64, error) {
 	var id int64
+	err := db.QueryRow(`INSERT INTO transactions (user_id, amount, status, url, telegram_payment_charge_id, invoice_payload, type, pricing_rule, paid_at, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW(), NOW()) RETURNING id`,
+		trx.TelegramUserID, trx.Amount, trx.Status, trx.URL, trx.TelegramPaymentChargeID, trx.InvoicePayload, trx.Type, trx.PricingRule).Scan(&id)
+	return id, err
+}
 
-	// Создаем invoice_payload из URL
-	invoicePayload := "video|" + url
+// Статусы транзакций
+const (
+	StatusPending   = "pending"
+	StatusSuccess   = "success"
+	StatusCompleted = "completed"
+	StatusRefunding = "refunding"
+	StatusRefunded  = "refunded"
+)
 
-	err := db.QueryRow(`INSERT INTO transactions (user_id, amount, status, url, invoice_payload, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, NOW(), NOW()) RETURNING id`,
-		userID, amount, "pending", url, invoicePayload).Scan(&id)
+// RefundStaleAfter через сколько транзакция в статусе refunding считается зависшей:
+// процесс упал или не смог записать результат возврата. Такой возврат можно повторить —
+// если он уже прошел, Telegram ответит CHARGE_ALREADY_REFUNDED
+const RefundStaleAfter = 15 * time.Minute
+
+// IsRefundable проверяет, можно ли вернуть средства по транзакции
+func (t *Transaction) IsRefundable() bool {
+	return t.TelegramPaymentChargeID != "" && (t.Status == StatusSuccess || t.Status == StatusCompleted || t.IsStaleRefund())
+}
+
+// IsStaleRefund проверяет, завис ли возврат в статусе refunding
+func (t *Transaction) IsStaleRefund() bool {
+	return t.Status == StatusRefunding && !t.UpdatedAt.IsZero() && time.Since(t.UpdatedAt) > RefundStaleAfter
+}
+
+// TransactionFilter фильтр для поиска транзакций. Пустые поля не учитываются
+type TransactionFilter struct {
+	UserID int64
+	Status string
+	From   *time.Time
+	To     *time.Time // не включительно
+	URL    string     // подстрока URL
+}
+
+// escapeLike экранирует спецсимволы LIKE, чтобы подстрока искалась буквально
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Поиск транзакций по фильтру с пагинацией. Возвращает страницу и общее количество
+func SearchTransactions(db *sql.DB, f TransactionFilter, limit, offset int) ([]Transaction, int, error) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.UserID != 0 {
+		add("user_id = $%d", f.UserID)
+	}
+	if f.Status != "" {
+		add("status = $%d", f.Status)
+	}
+	if f.From != nil {
+		add("created_at >= $%d", *f.From)
+	}
+	if f.To != nil {
+		add("created_at < $%d", *f.To)
+	}
+	if f.URL != "" {
+		add(`url ILIKE '%%' || $%d || '%%' ESCAPE '\'`, escapeLike(f.URL))
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM transactions`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, limit, offset)
+	rows, err := db.Query(fmt.Sprintf(`SELECT id, telegram_payment_charge_id, user_id, amount, invoice_payload, status, type, reason, url, created_at, updated_at FROM transactions%s ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args)), args...)
 	if err != nil {
-		log.Printf("[DB] Ошибка создания pending транзакции: %v", err)
-		return 0, err
+		return nil, 0, err
 	}
-	log.Printf("[DB] Pending транзакция создана с id=%d", id)
-	return id, err
+	defer rows.Close()
+	var result []Transaction
+	for rows.Next() {
+		var t Transaction
+		var telegramPaymentChargeID, invoicePayload, typeField, reason sql.NullString
+		var updatedAt sql.NullTime
+		if err := rows.Scan(&t.ID, &telegramPaymentChargeID, &t.TelegramUserID, &t.Amount, &invoicePayload, &t.Status, &typeField, &reason, &t.URL, &t.CreatedAt, &updatedAt); err != nil {
+			return nil, 0, err
+		}
+		t.UpdatedAt = updatedAt.Time
+		t.TelegramPaymentChargeID = telegramPaymentChargeID.String
+		t.InvoicePayload = invoicePayload.String
+		t.Type = typeField.String
+		t.Reason = reason.String
+		result = append(result, t)
+	}
+	return result, total, rows.Err()
 }
 
-// Обновление транзакции после оплаты: charge_id и статус
-func UpdateTransactionAfterPayment(db *sql.DB, id int64, chargeID string, status string) error {
-	_, err := db.Exec(`UPDATE transactions SET status = $1, telegram_payment_charge_id = $2, updated_at = NOW() WHERE id = $3`, status, chargeID, id)
+// Смена статуса транзакции, только если текущий статус равен from.
+// Возвращает false, если статус уже изменился (например, возврат выполняется параллельно)
+func CompareAndSetTransactionStatus(db *sql.DB, id int64, from, to string) (bool, error) {
+	res, err := db.Exec(`UPDATE transactions SET status = $1, updated_at = NOW() WHERE id = $2 AND status = $3`, to, id, from)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// Отметка о доставке оплаченного видео: success -> completed. Транзакцию, которую
+// уже возвращают или вернули, доставка не трогает. Возвращает false, если статус не success
+func MarkTransactionCompleted(db *sql.DB, chargeID string) (bool, error) {
+	res, err := db.Exec(`UPDATE transactions SET status = $1, updated_at = NOW()
+		WHERE telegram_payment_charge_id = $2 AND status = $3`, StatusCompleted, chargeID, StatusSuccess)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// Захват транзакции для возврата: from -> refunding с сохранением from в status_before_refund.
+// Возвращает false, если статус уже изменился (например, возврат выполняется параллельно)
+func ClaimRefund(db *sql.DB, id int64, from string) (bool, error) {
+	res, err := db.Exec(`UPDATE transactions SET status = $1, status_before_refund = $3, updated_at = NOW()
+		WHERE id = $2 AND status = $3`, StatusRefunding, id, from)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// Отмена неудавшегося возврата: refunding -> статус до захвата (success, если он не сохранен).
+// Возвращает восстановленный статус или пустую строку, если транзакция уже не в refunding
+func ReleaseRefund(db *sql.DB, id int64) (string, error) {
+	var status string
+	err := db.QueryRow(`UPDATE transactions SET status = COALESCE(status_before_refund, $3), updated_at = NOW()
+		WHERE id = $1 AND status = $2 RETURNING status`, id, StatusRefunding, StatusSuccess).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return status, err
+}
+
+// Повторный захват зависшего возврата: обновляет updated_at, только если транзакция
+// все еще в refunding дольше olderThan. Возвращает false, если возврат уже повторяют
+func ClaimStaleRefund(db *sql.DB, id int64, olderThan time.Duration) (bool, error) {
+	res, err := db.Exec(`UPDATE transactions SET updated_at = NOW()
+		WHERE id = $1 AND status = $2 AND updated_at < NOW() - $3 * INTERVAL '1 second'`,
+		id, StatusRefunding, int64(olderThan.Seconds()))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// Сохранение причины возврата
+func SetTransactionReason(db *sql.DB, id int64, reason string) error {
+	_, err := db.Exec(`UPDATE transactions SET reason = $1, updated_at = NOW() WHERE id = $2`, reason, id)
 	return err
 }
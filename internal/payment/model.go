@@ -1,5 +1,7 @@
 package payment
 
+import "time"
+
 type Transaction struct {
 	ID                      int64 // Новое поле для id из БД
 	TelegramPaymentChargeID string
@@ -10,4 +12,7 @@ type Transaction struct {
 	Type                    string
 	Reason                  string
 	URL                     string // Новое поле для ссылки
+	CreatedAt               time.Time
+	UpdatedAt               time.Time
+	PricingRule             string // правило или план, по которому посчитана цена
 }
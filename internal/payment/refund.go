@@ -1,35 +1,112 @@
 package payment
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"net/http"
+	"log/slog"
 	"net/url"
-	"os"
+	"strconv"
+	"strings"
+
+	"YoutubeDownloader/internal/logging"
+	"YoutubeDownloader/internal/metrics"
 )
 
-// RefundStarPayment возвращает средства через Telegram Stars API
-func RefundStarPayment(userID int64, telegramPaymentChargeID string, amount int, reason string) error {
-	log.Printf("[RefundStarPayment] Возврат %d XTR пользователю %d, charge_id=%s, причина: %s", amount, userID, telegramPaymentChargeID, reason)
-	// Реальный возврат через Bot API
-	apiToken := os.Getenv("TELEGRAM_BOT_TOKEN")
-	if apiToken == "" {
-		return fmt.Errorf("TELEGRAM_BOT_TOKEN не задан")
-	}
-	apiUrl := fmt.Sprintf("https://api.telegram.org/bot%s/refundStarPayment", apiToken)
-	data := url.Values{}
-	data.Set("user_id", fmt.Sprintf("%d", userID))
-	data.Set("telegram_payment_charge_id", telegramPaymentChargeID)
-	resp, err := http.PostForm(apiUrl, data)
+// ErrNotRefundable транзакция уже возвращена, не оплачена или возврат выполняется параллельно
+var ErrNotRefundable = errors.New("транзакция недоступна для возврата")
+
+// APIClient отправляет запросы к Telegram Bot API; реализуется *tele.Bot, поэтому
+// возврат идет на тот же адрес API, с тем же токеном и HTTP-клиентом, что и остальные запросы
+type APIClient interface {
+	Raw(method string, payload interface{}) ([]byte, error)
+}
+
+// RefundStarPayment возвращает средства через Telegram Stars API.
+// Возвращает тело ответа Telegram (или текст сетевой ошибки) для аудита
+func RefundStarPayment(api APIClient, userID int64, telegramPaymentChargeID string, amount int, reason string) (string, error) {
+	log := logging.Component("REFUND").With("user_id", userID, "charge_id", logging.Mask(telegramPaymentChargeID))
+	log.Info("Возврат Stars", "amount", amount, "reason", reason)
+
+	body, err := api.Raw("refundStarPayment", map[string]string{
+		"user_id":                    strconv.FormatInt(userID, 10),
+		"telegram_payment_charge_id": telegramPaymentChargeID,
+	})
+	if err != nil {
+		// Сетевая ошибка содержит URL с токеном — в аудит пишем только причину
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err.Error(), fmt.Errorf("ошибка запроса refundStarPayment: %w", urlErr.Err)
+		}
+		if len(body) == 0 {
+			return err.Error(), err
+		}
+		return string(body), fmt.Errorf("Ошибка возврата: %s", string(body))
+	}
+	log.Debug("Ответ Telegram на возврат", slog.String("body", string(body)))
+	return string(body), nil
+}
+
+// RefundTransaction возвращает средства по транзакции из БД. Статус транзакции
+// захватывается перед запросом, поэтому одна транзакция не может быть возвращена дважды.
+// Зависший в refunding возврат захватывается повторно (см. RefundStaleAfter), а при
+// неудаче транзакция возвращается в статус, сохраненный при первом захвате.
+// Каждая попытка пишется в refund_audit; adminID 0 — возврат без участия сотрудника
+func RefundTransaction(db *sql.DB, api APIClient, trx *Transaction, adminID, userID int64, reason string) error {
+	log := logging.Component("REFUND").With("transaction_id", trx.ID, "admin_id", adminID)
+
+	if !trx.IsRefundable() {
+		return ErrNotRefundable
+	}
+	var claimed bool
+	var err error
+	if trx.IsStaleRefund() {
+		log.Warn("Повтор зависшего возврата", "since", trx.UpdatedAt)
+		claimed, err = ClaimStaleRefund(db, trx.ID, RefundStaleAfter)
+	} else {
+		claimed, err = ClaimRefund(db, trx.ID, trx.Status)
+	}
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	body, _ := ioutil.ReadAll(resp.Body)
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("Ошибка возврата: %s", string(body))
+	if !claimed {
+		return ErrNotRefundable
+	}
+
+	response, refundErr := RefundStarPayment(api, userID, trx.TelegramPaymentChargeID, trx.Amount, reason)
+
+	// Telegram отвечает CHARGE_ALREADY_REFUNDED, если возврат уже был сделан вне бота
+	alreadyRefunded := refundErr != nil && strings.Contains(response, "CHARGE_ALREADY_REFUNDED")
+	success := refundErr == nil || alreadyRefunded
+	metrics.Refunds.WithLabelValues("transaction", metrics.Outcome(success)).Inc()
+
+	audit := &RefundAudit{
+		TransactionID: trx.ID,
+		ChargeID:      trx.TelegramPaymentChargeID,
+		UserID:        userID,
+		Amount:        trx.Amount,
+		AdminID:       adminID,
+		Reason:        reason,
+		Success:       success,
+		Response:      response,
+	}
+	if err := InsertRefundAudit(db, audit); err != nil {
+		// Ошибка аудита не должна терять результат возврата
+		log.Error("Ошибка записи аудита возврата", "charge_id", logging.Mask(trx.TelegramPaymentChargeID), "success", success, "error", err)
+	}
+
+	if !success {
+		if _, err := ReleaseRefund(db, trx.ID); err != nil {
+			log.Error("Не удалось вернуть статус транзакции", "error", err)
+		}
+		return refundErr
+	}
+
+	if _, err := CompareAndSetTransactionStatus(db, trx.ID, StatusRefunding, StatusRefunded); err != nil {
+		log.Error("Не удалось отметить транзакцию как возвращенную", "error", err)
+	}
+	if err := SetTransactionReason(db, trx.ID, reason); err != nil {
+		log.Warn("Не удалось сохранить причину возврата", "error", err)
 	}
-	log.Printf("[RefundStarPayment] Ответ Telegram: %s", string(body))
 	return nil
 }
@@ -0,0 +1,41 @@
+package pricing
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// loadTable читает таблицу цен из БД. nil означает, что цены через /prices еще не менялись
+func loadTable(db *sql.DB) (*Table, error) {
+	var data []byte
+	err := db.QueryRow(`SELECT config FROM pricing_config WHERE id = 1`).Scan(&data)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка загрузки цен из БД: %v", err)
+	}
+
+	var table Table
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("ошибка разбора цен из БД: %v", err)
+	}
+	return &table, nil
+}
+
+// saveTable сохраняет таблицу цен в БД
+func saveTable(db *sql.DB, table *Table, adminID int64) error {
+	data, err := json.Marshal(table)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`INSERT INTO pricing_config (id, config, updated_by, updated_at) VALUES (1, $1, $2, NOW())
+		ON CONFLICT (id) DO UPDATE SET config = EXCLUDED.config, updated_by = EXCLUDED.updated_by, updated_at = NOW()`,
+		data, adminID)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения цен в БД: %v", err)
+	}
+	return nil
+}
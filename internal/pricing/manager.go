@@ -0,0 +1,101 @@
+package pricing
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ErrInvalid таблица цен не прошла проверку
+var ErrInvalid = errors.New("некорректная таблица цен")
+
+// Manager хранит действующую таблицу цен. Источник по приоритету: БД (изменения
+// через /prices), файл PRICING_FILE, встроенные значения по умолчанию
+type Manager struct {
+	db     *sql.DB
+	table  *Table
+	source string
+	mutex  sync.RWMutex
+}
+
+// NewManager создает менеджер цен с таблицей по умолчанию
+func NewManager(db *sql.DB) *Manager {
+	return &Manager{db: db, table: Default(), source: "default"}
+}
+
+// Load загружает таблицу цен из БД, а если там ее нет — из файла
+func (m *Manager) Load(file string) error {
+	table, err := loadTable(m.db)
+	if err != nil {
+		return err
+	}
+	source := "db"
+
+	if table == nil && file != "" {
+		if table, err = readTableFile(file); err != nil {
+			return err
+		}
+		source = file
+	}
+	if table == nil {
+		return nil
+	}
+
+	if err := table.Validate(); err != nil {
+		return fmt.Errorf("%w (%s): %v", ErrInvalid, source, err)
+	}
+
+	m.mutex.Lock()
+	m.table, m.source = table, source
+	m.mutex.Unlock()
+	return nil
+}
+
+// Table возвращает копию действующей таблицы цен
+func (m *Manager) Table() *Table {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.table.Clone()
+}
+
+// Source возвращает источник действующей таблицы: db, путь к файлу или default
+func (m *Manager) Source() string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.source
+}
+
+// Update изменяет таблицу цен, проверяет ее и сохраняет в БД
+func (m *Manager) Update(adminID int64, change func(t *Table) error) (*Table, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	table := m.table.Clone()
+	if err := change(table); err != nil {
+		return nil, err
+	}
+	if err := table.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if err := saveTable(m.db, table, adminID); err != nil {
+		return nil, err
+	}
+
+	m.table, m.source = table, "db"
+	return table.Clone(), nil
+}
+
+func readTableFile(file string) (*Table, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла цен %s: %v", file, err)
+	}
+	var table Table
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("ошибка разбора файла цен %s: %v", file, err)
+	}
+	return &table, nil
+}
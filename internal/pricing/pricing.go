@@ -0,0 +1,288 @@
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Типы медиа
+const (
+	MediaVideo = "video"
+	MediaShort = "short" // YouTube Shorts, TikTok
+)
+
+// Качество по высоте кадра
+const (
+	QualitySD  = "sd"
+	QualityHD  = "hd"
+	QualityFHD = "fhd"
+	Quality4K  = "4k"
+)
+
+// Идентификатор цены по умолчанию в транзакциях
+const DefaultRuleID = "default"
+
+// Duration длительность, которая в JSON записывается строкой ("90s", "10m", "720h")
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// ParseDuration разбирает длительность в формате Go ("90s", "10m") или в днях ("30d")
+func ParseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("некорректная длительность %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("некорректная длительность %q", s)
+	}
+	return d, nil
+}
+
+// Media сведения о видео, от которых зависит цена. Нулевые значения означают "неизвестно"
+type Media struct {
+	Type     string
+	Duration time.Duration
+	Size     int64 // байты
+	Height   int
+}
+
+// Rule правило цены разового скачивания. Пустые условия не проверяются
+type Rule struct {
+	ID          string   `json:"id"`
+	MediaType   string   `json:"media_type,omitempty"`
+	MinDuration Duration `json:"min_duration,omitempty"`
+	MaxDuration Duration `json:"max_duration,omitempty"`
+	MinSizeMB   int64    `json:"min_size_mb,omitempty"`
+	MaxSizeMB   int64    `json:"max_size_mb,omitempty"`
+	Quality     string   `json:"quality,omitempty"`
+	Price       int      `json:"price"`
+}
+
+// Plan тарифный план подписки. Duration 0 — бессрочная подписка
+type Plan struct {
+	ID       string   `json:"id"`
+	Duration Duration `json:"duration"`
+	Price    int      `json:"price"`
+}
+
+// Table таблица цен: первое совпавшее правило задает цену, иначе DefaultPrice
+type Table struct {
+	DefaultPrice int    `json:"default_price"`
+	Rules        []Rule `json:"rules"`
+	Plans        []Plan `json:"plans"`
+}
+
+// Quote рассчитанная цена и правило, по которому она получена
+type Quote struct {
+	Price  int
+	RuleID string
+}
+
+// Default таблица цен по умолчанию
+func Default() *Table {
+	return &Table{
+		DefaultPrice: 1,
+		Plans: []Plan{
+			{ID: "month", Duration: Duration(30 * 24 * time.Hour), Price: 5},
+			{ID: "year", Duration: Duration(365 * 24 * time.Hour), Price: 50},
+			{ID: "forever", Duration: 0, Price: 100},
+		},
+	}
+}
+
+// QualityOf возвращает класс качества по высоте кадра
+func QualityOf(height int) string {
+	switch {
+	case height <= 0:
+		return ""
+	case height < 720:
+		return QualitySD
+	case height < 1080:
+		return QualityHD
+	case height < 2160:
+		return QualityFHD
+	default:
+		return Quality4K
+	}
+}
+
+// DetectMediaType определяет тип медиа по ссылке
+func DetectMediaType(url string) string {
+	lower := strings.ToLower(url)
+	if strings.Contains(lower, "/shorts/") || strings.Contains(lower, "tiktok.com") {
+		return MediaShort
+	}
+	return MediaVideo
+}
+
+// Matches проверяет, подходит ли правило под медиа. Условие по неизвестному
+// значению (длительность, размер, качество) считается невыполненным
+func (r *Rule) Matches(m Media) bool {
+	if r.MediaType != "" && r.MediaType != m.Type {
+		return false
+	}
+	if (r.MinDuration > 0 || r.MaxDuration > 0) && m.Duration == 0 {
+		return false
+	}
+	if r.MinDuration > 0 && m.Duration < time.Duration(r.MinDuration) {
+		return false
+	}
+	if r.MaxDuration > 0 && m.Duration > time.Duration(r.MaxDuration) {
+		return false
+	}
+	const mb = 1024 * 1024
+	if (r.MinSizeMB > 0 || r.MaxSizeMB > 0) && m.Size == 0 {
+		return false
+	}
+	if r.MinSizeMB > 0 && m.Size < r.MinSizeMB*mb {
+		return false
+	}
+	if r.MaxSizeMB > 0 && m.Size > r.MaxSizeMB*mb {
+		return false
+	}
+	if r.Quality != "" && r.Quality != QualityOf(m.Height) {
+		return false
+	}
+	return true
+}
+
+// Conditions описывает условия правила в том же виде, в котором их задает /prices
+func (r *Rule) Conditions() string {
+	var parts []string
+	if r.MediaType != "" {
+		parts = append(parts, "type="+r.MediaType)
+	}
+	if r.MinDuration > 0 {
+		parts = append(parts, "min_duration="+time.Duration(r.MinDuration).String())
+	}
+	if r.MaxDuration > 0 {
+		parts = append(parts, "max_duration="+time.Duration(r.MaxDuration).String())
+	}
+	if r.MinSizeMB > 0 {
+		parts = append(parts, fmt.Sprintf("min_size_mb=%d", r.MinSizeMB))
+	}
+	if r.MaxSizeMB > 0 {
+		parts = append(parts, fmt.Sprintf("max_size_mb=%d", r.MaxSizeMB))
+	}
+	if r.Quality != "" {
+		parts = append(parts, "quality="+r.Quality)
+	}
+	if len(parts) == 0 {
+		return "*"
+	}
+	return strings.Join(parts, " ")
+}
+
+// NeedsProbe проверяет, нужны ли правилам метаданные видео (длительность, размер, качество)
+func (t *Table) NeedsProbe() bool {
+	for _, r := range t.Rules {
+		if r.MinDuration > 0 || r.MaxDuration > 0 || r.MinSizeMB > 0 || r.MaxSizeMB > 0 || r.Quality != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// PriceFor рассчитывает цену разового скачивания
+func (t *Table) PriceFor(m Media) Quote {
+	for _, r := range t.Rules {
+		if r.Matches(m) {
+			return Quote{Price: r.Price, RuleID: r.ID}
+		}
+	}
+	return Quote{Price: t.DefaultPrice, RuleID: DefaultRuleID}
+}
+
+// Plan ищет тарифный план подписки
+func (t *Table) Plan(id string) (Plan, bool) {
+	for _, p := range t.Plans {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return Plan{}, false
+}
+
+// Validate проверяет таблицу цен
+func (t *Table) Validate() error {
+	if t.DefaultPrice < 1 {
+		return fmt.Errorf("цена по умолчанию должна быть не меньше 1")
+	}
+
+	ids := make(map[string]bool)
+	for _, r := range t.Rules {
+		if r.ID == "" || r.ID == DefaultRuleID {
+			return fmt.Errorf("у правила должен быть id, отличный от %q", DefaultRuleID)
+		}
+		if ids[r.ID] {
+			return fmt.Errorf("правило %q задано дважды", r.ID)
+		}
+		ids[r.ID] = true
+		if r.Price < 1 {
+			return fmt.Errorf("цена правила %q должна быть не меньше 1", r.ID)
+		}
+		if r.MediaType != "" && r.MediaType != MediaVideo && r.MediaType != MediaShort {
+			return fmt.Errorf("правило %q: неизвестный тип медиа %q", r.ID, r.MediaType)
+		}
+		switch r.Quality {
+		case "", QualitySD, QualityHD, QualityFHD, Quality4K:
+		default:
+			return fmt.Errorf("правило %q: неизвестное качество %q", r.ID, r.Quality)
+		}
+		if r.MaxDuration > 0 && r.MinDuration > r.MaxDuration {
+			return fmt.Errorf("правило %q: min_duration больше max_duration", r.ID)
+		}
+		if r.MaxSizeMB > 0 && r.MinSizeMB > r.MaxSizeMB {
+			return fmt.Errorf("правило %q: min_size_mb больше max_size_mb", r.ID)
+		}
+	}
+
+	planIDs := make(map[string]bool)
+	for _, p := range t.Plans {
+		if p.ID == "" || strings.Contains(p.ID, "|") {
+			return fmt.Errorf("некорректный id плана %q", p.ID)
+		}
+		if planIDs[p.ID] {
+			return fmt.Errorf("план %q задан дважды", p.ID)
+		}
+		planIDs[p.ID] = true
+		if p.Price < 1 {
+			return fmt.Errorf("цена плана %q должна быть не меньше 1", p.ID)
+		}
+		if p.Duration < 0 {
+			return fmt.Errorf("длительность плана %q не может быть отрицательной", p.ID)
+		}
+	}
+	return nil
+}
+
+// Clone возвращает глубокую копию таблицы
+func (t *Table) Clone() *Table {
+	c := &Table{DefaultPrice: t.DefaultPrice}
+	c.Rules = append([]Rule(nil), t.Rules...)
+	c.Plans = append([]Plan(nil), t.Plans...)
+	return c
+}
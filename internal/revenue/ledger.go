@@ -0,0 +1,128 @@
+// Package revenue считает выручку в Stars по таблице transactions и сверяет ее
+// с транзакциями Telegram Stars из Bot API
+package revenue
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Продукты, по которым группируется выручка. Подписки учитываются по плану: "plan:<id>"
+const (
+	ProductVideo        = "video"        // оплата одного видео
+	ProductSubscription = "subscription" // подписка без плана в pricing_rule
+	ProductUnknown      = "unknown"      // возврат по charge_id, которого нет в transactions
+)
+
+// productSQL продукт транзакции t; t.id IS NULL — транзакция не найдена
+const productSQL = `CASE
+		WHEN t.id IS NULL THEN 'unknown'
+		WHEN t.type = 'subscription' THEN COALESCE(NULLIF(t.pricing_rule, ''), 'subscription')
+		ELSE 'video'
+	END`
+
+// firstRefundsSQL первый успешный возврат каждого платежа: повторный возврат уже
+// возвращенного платежа (CHARGE_ALREADY_REFUNDED) тоже пишется в аудит как успешный
+const firstRefundsSQL = `(SELECT DISTINCT ON (charge_id) * FROM refund_audit WHERE success ORDER BY charge_id, created_at)`
+
+// Row выручка одного продукта за день. Оплаты считаются по времени оплаты,
+// возвраты — по времени успешного возврата, поэтому они могут попасть в разные дни
+type Row struct {
+	Day      time.Time `json:"day"` // пусто в итогах за период
+	Product  string    `json:"product"`
+	Payments int64     `json:"payments"`
+	Gross    int64     `json:"gross"` // Stars
+	Refunds  int64     `json:"refunds"`
+	Refunded int64     `json:"refunded"` // Stars
+}
+
+// Net выручка за вычетом возвратов
+func (r Row) Net() int64 {
+	return r.Gross - r.Refunded
+}
+
+func (r *Row) add(o Row) {
+	r.Payments += o.Payments
+	r.Gross += o.Gross
+	r.Refunds += o.Refunds
+	r.Refunded += o.Refunded
+}
+
+// Ledger выручка за период [From, To) по дням и продуктам
+type Ledger struct {
+	From, To time.Time
+	Rows     []Row
+}
+
+// ByProduct итоги периода по продуктам, от большей выручки к меньшей
+func (l *Ledger) ByProduct() []Row {
+	totals := make(map[string]*Row)
+	var result []Row
+	for _, r := range l.Rows {
+		t, ok := totals[r.Product]
+		if !ok {
+			t = &Row{Product: r.Product}
+			totals[r.Product] = t
+		}
+		t.add(r)
+	}
+	for _, t := range totals {
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Gross != result[j].Gross {
+			return result[i].Gross > result[j].Gross
+		}
+		return result[i].Product < result[j].Product
+	})
+	return result
+}
+
+// Total итог периода по всем продуктам
+func (l *Ledger) Total() Row {
+	var total Row
+	for _, r := range l.Rows {
+		total.add(r)
+	}
+	return total
+}
+
+// GetLedger собирает выручку за период [from, to) по дням и продуктам
+func GetLedger(db *sql.DB, from, to time.Time) (*Ledger, error) {
+	query := `WITH paid AS (
+				SELECT t.paid_at::date AS day, ` + productSQL + ` AS product, COUNT(*) AS payments, SUM(t.amount) AS gross
+				FROM transactions t
+				WHERE t.paid_at >= $1 AND t.paid_at < $2
+				GROUP BY 1, 2
+			  ), refunds AS (
+				SELECT r.created_at::date AS day, ` + productSQL + ` AS product, COUNT(*) AS refunds,
+					   SUM(COALESCE(NULLIF(r.amount, 0), t.amount, 0)) AS refunded
+				FROM ` + firstRefundsSQL + ` r
+				LEFT JOIN transactions t ON t.telegram_payment_charge_id = r.charge_id
+				WHERE r.created_at >= $1 AND r.created_at < $2
+				GROUP BY 1, 2
+			  )
+			  SELECT COALESCE(p.day, r.day), COALESCE(p.product, r.product),
+					 COALESCE(p.payments, 0), COALESCE(p.gross, 0), COALESCE(r.refunds, 0), COALESCE(r.refunded, 0)
+			  FROM paid p
+			  FULL JOIN refunds r ON r.day = p.day AND r.product = p.product
+			  ORDER BY 1, 2`
+
+	rows, err := db.Query(query, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения выручки: %v", err)
+	}
+	defer rows.Close()
+
+	l := &Ledger{From: from, To: to}
+	for rows.Next() {
+		var r Row
+		if err := rows.Scan(&r.Day, &r.Product, &r.Payments, &r.Gross, &r.Refunds, &r.Refunded); err != nil {
+			return nil, fmt.Errorf("ошибка чтения выручки: %v", err)
+		}
+		l.Rows = append(l.Rows, r)
+	}
+	return l, rows.Err()
+}
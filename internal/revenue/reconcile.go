@@ -0,0 +1,277 @@
+package revenue
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"YoutubeDownloader/internal/logging"
+	"YoutubeDownloader/internal/payment"
+
+	"github.com/lib/pq"
+)
+
+// Виды расхождений между БД и Telegram
+const (
+	MismatchUnknownPayment    = "unknown_payment"     // платеж есть в Telegram, но не в transactions
+	MismatchMissingPayment    = "missing_payment"     // транзакция оплачена в БД, но платежа нет в Telegram
+	MismatchAmount            = "amount_mismatch"     // сумма в БД отличается от суммы в Telegram
+	MismatchNotDelivered      = "not_delivered"       // видео оплачено, но так и не отправлено
+	MismatchUnrecordedRefund  = "unrecorded_refund"   // возврат есть в Telegram, но не записан в БД
+	MismatchRefundNotTelegram = "refund_not_telegram" // возврат записан в БД, но его нет в Telegram
+)
+
+// deliveryGrace через сколько после оплаты неотправленное видео считается расхождением
+const deliveryGrace = time.Hour
+
+// Mismatch расхождение по одному платежу
+type Mismatch struct {
+	Kind           string    `json:"kind"`
+	ChargeID       string    `json:"charge_id"`
+	TransactionID  int64     `json:"transaction_id,omitempty"`
+	UserID         int64     `json:"user_id"`
+	Amount         int       `json:"amount"`                    // по БД, а без записи в БД — по Telegram
+	TelegramAmount int       `json:"telegram_amount,omitempty"` // для amount_mismatch
+	At             time.Time `json:"at"`                        // время оплаты или возврата
+}
+
+// Reconciliation результат сверки за период [From, To)
+type Reconciliation struct {
+	From, To time.Time
+
+	// Итоги по Telegram для сравнения с Ledger
+	TelegramPayments int64
+	TelegramGross    int64
+	TelegramRefunds  int64
+	TelegramRefunded int64
+
+	Mismatches []Mismatch
+}
+
+// dbPayment оплаченная транзакция из БД
+type dbPayment struct {
+	ID        int64
+	ChargeID  string
+	UserID    int64
+	Amount    int
+	Status    string
+	Product   string
+	PaidAt    time.Time
+	Delivered bool // есть завершенная задача скачивания по этому платежу
+}
+
+// dbRefund успешный возврат из refund_audit
+type dbRefund struct {
+	ChargeID      string
+	TransactionID int64
+	UserID        int64
+	Amount        int
+	CreatedAt     time.Time
+}
+
+// Reconcile сверяет оплаты и возвраты за период [from, to) с транзакциями Telegram Stars.
+// Платежи сопоставляются по charge_id, поэтому оплата у границы периода, попавшая в
+// Telegram и в БД в разные дни, расхождением не считается
+func Reconcile(db *sql.DB, api payment.APIClient, from, to time.Time) (*Reconciliation, error) {
+	log := logging.Component("REVENUE")
+
+	starTransactions, err := FetchStarTransactions(api)
+	if err != nil {
+		return nil, err
+	}
+	tg := indexStarTransactions(starTransactions, from, to)
+
+	// Оплаты периода и записи для платежей Telegram этого периода, оплаченные в БД в другой день
+	var data reconcileData
+	data.payments, err = loadPayments(db, `t.paid_at >= $1 AND t.paid_at < $2`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	data.paymentsByCharge, err = loadPayments(db, `t.telegram_payment_charge_id = ANY($1)`, pq.Array(append(tg.paymentIDs, tg.refundIDs...)))
+	if err != nil {
+		return nil, err
+	}
+	data.refunds, err = loadRefunds(db, `r.created_at >= $1 AND r.created_at < $2`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	data.refundsByCharge, err = loadRefunds(db, `r.charge_id = ANY($1)`, pq.Array(tg.refundIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &Reconciliation{From: from, To: to}
+	rec.match(tg, data, time.Now())
+	log.Info("Сверка с Telegram", "from", from, "to", to, "telegram_transactions", len(starTransactions),
+		"db_payments", len(data.payments), "mismatches", len(rec.Mismatches))
+	return rec, nil
+}
+
+// starIndex транзакции Telegram Stars по charge_id
+type starIndex struct {
+	payments map[string]StarTransaction
+	refunds  map[string]StarTransaction
+
+	// charge_id платежей и возвратов периода сверки
+	paymentIDs []string
+	refundIDs  []string
+}
+
+// indexStarTransactions раскладывает транзакции Telegram на платежи и возвраты
+// и отбирает те, что попали в период [from, to)
+func indexStarTransactions(starTransactions []StarTransaction, from, to time.Time) *starIndex {
+	tg := &starIndex{
+		payments: make(map[string]StarTransaction),
+		refunds:  make(map[string]StarTransaction),
+	}
+	for _, t := range starTransactions {
+		switch {
+		case t.IsPayment():
+			tg.payments[t.ID] = t
+		case t.IsRefund():
+			tg.refunds[t.ID] = t
+		}
+	}
+
+	inPeriod := func(at time.Time) bool {
+		return !at.Before(from) && at.Before(to)
+	}
+	for id, t := range tg.payments {
+		if inPeriod(t.Time()) {
+			tg.paymentIDs = append(tg.paymentIDs, id)
+		}
+	}
+	for id, t := range tg.refunds {
+		if inPeriod(t.Time()) {
+			tg.refundIDs = append(tg.refundIDs, id)
+		}
+	}
+	return tg
+}
+
+// reconcileData записи БД для сверки
+type reconcileData struct {
+	payments         []dbPayment // оплаченные в периоде
+	paymentsByCharge []dbPayment // по charge_id платежей и возвратов Telegram периода
+	refunds          []dbRefund  // возвраты периода
+	refundsByCharge  []dbRefund  // по charge_id возвратов Telegram периода
+}
+
+// match считает итоги Telegram и находит расхождения с БД. now — момент сверки,
+// от которого отсчитывается deliveryGrace
+func (rec *Reconciliation) match(tg *starIndex, data reconcileData, now time.Time) {
+	for _, id := range tg.paymentIDs {
+		rec.TelegramPayments++
+		rec.TelegramGross += int64(tg.payments[id].Amount)
+	}
+	for _, id := range tg.refundIDs {
+		rec.TelegramRefunds++
+		rec.TelegramRefunded += int64(tg.refunds[id].Amount)
+	}
+
+	dbPayments := make(map[string]dbPayment, len(data.payments)+len(data.paymentsByCharge))
+	for _, p := range append(data.payments, data.paymentsByCharge...) {
+		dbPayments[p.ChargeID] = p
+	}
+	dbRefunds := make(map[string]dbRefund, len(data.refunds)+len(data.refundsByCharge))
+	for _, r := range append(data.refunds, data.refundsByCharge...) {
+		dbRefunds[r.ChargeID] = r
+	}
+
+	add := func(m Mismatch) {
+		rec.Mismatches = append(rec.Mismatches, m)
+	}
+
+	for _, id := range tg.paymentIDs {
+		t := tg.payments[id]
+		p, ok := dbPayments[id]
+		switch {
+		case !ok:
+			add(Mismatch{Kind: MismatchUnknownPayment, ChargeID: id, UserID: t.UserID(), Amount: t.Amount, At: t.Time()})
+		case p.Amount != t.Amount:
+			add(Mismatch{Kind: MismatchAmount, ChargeID: id, TransactionID: p.ID, UserID: p.UserID,
+				Amount: p.Amount, TelegramAmount: t.Amount, At: t.Time()})
+		}
+	}
+
+	notDeliveredBefore := now.Add(-deliveryGrace)
+	for _, p := range data.payments {
+		if _, ok := tg.payments[p.ChargeID]; !ok {
+			add(Mismatch{Kind: MismatchMissingPayment, ChargeID: p.ChargeID, TransactionID: p.ID, UserID: p.UserID, Amount: p.Amount, At: p.PaidAt})
+			continue
+		}
+		if p.Product == ProductVideo && p.Status == payment.StatusSuccess && !p.Delivered && p.PaidAt.Before(notDeliveredBefore) {
+			add(Mismatch{Kind: MismatchNotDelivered, ChargeID: p.ChargeID, TransactionID: p.ID, UserID: p.UserID, Amount: p.Amount, At: p.PaidAt})
+		}
+	}
+
+	for _, id := range tg.refundIDs {
+		t := tg.refunds[id]
+		if _, ok := dbRefunds[id]; ok {
+			continue
+		}
+		m := Mismatch{Kind: MismatchUnrecordedRefund, ChargeID: id, UserID: t.UserID(), Amount: t.Amount, At: t.Time()}
+		if p, ok := dbPayments[id]; ok {
+			if p.Status == payment.StatusRefunded {
+				continue
+			}
+			m.TransactionID = p.ID
+		}
+		add(m)
+	}
+
+	for _, r := range data.refunds {
+		if _, ok := tg.refunds[r.ChargeID]; !ok {
+			add(Mismatch{Kind: MismatchRefundNotTelegram, ChargeID: r.ChargeID, TransactionID: r.TransactionID, UserID: r.UserID, Amount: r.Amount, At: r.CreatedAt})
+		}
+	}
+
+	sort.Slice(rec.Mismatches, func(i, j int) bool {
+		return rec.Mismatches[i].At.Before(rec.Mismatches[j].At)
+	})
+}
+
+// loadPayments читает оплаченные транзакции с charge_id, подходящие под условие where
+func loadPayments(db *sql.DB, where string, args ...interface{}) ([]dbPayment, error) {
+	rows, err := db.Query(`SELECT t.id, t.telegram_payment_charge_id, t.user_id, t.amount, t.status, `+productSQL+`,
+			COALESCE(t.paid_at, t.updated_at),
+			EXISTS (SELECT 1 FROM download_jobs j WHERE j.charge_id = t.telegram_payment_charge_id AND j.status = 'done')
+		FROM transactions t
+		WHERE COALESCE(t.telegram_payment_charge_id, '') <> '' AND `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения оплат: %v", err)
+	}
+	defer rows.Close()
+
+	var result []dbPayment
+	for rows.Next() {
+		var p dbPayment
+		if err := rows.Scan(&p.ID, &p.ChargeID, &p.UserID, &p.Amount, &p.Status, &p.Product, &p.PaidAt, &p.Delivered); err != nil {
+			return nil, fmt.Errorf("ошибка чтения оплаты: %v", err)
+		}
+		result = append(result, p)
+	}
+	return result, rows.Err()
+}
+
+// loadRefunds читает первые успешные возвраты платежей, подходящие под условие where
+func loadRefunds(db *sql.DB, where string, args ...interface{}) ([]dbRefund, error) {
+	rows, err := db.Query(`SELECT r.charge_id, COALESCE(r.transaction_id, 0), r.user_id, r.amount, r.created_at
+		FROM `+firstRefundsSQL+` r
+		WHERE `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения возвратов: %v", err)
+	}
+	defer rows.Close()
+
+	var result []dbRefund
+	for rows.Next() {
+		var r dbRefund
+		if err := rows.Scan(&r.ChargeID, &r.TransactionID, &r.UserID, &r.Amount, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения возврата: %v", err)
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,114 @@
+package revenue
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"YoutubeDownloader/internal/payment"
+)
+
+func userPartner(userID int64) *TransactionPartner {
+	p := &TransactionPartner{Type: partnerUser}
+	p.User = &struct {
+		ID int64 `json:"id"`
+	}{ID: userID}
+	return p
+}
+
+func starPayment(id string, userID int64, amount int, at time.Time) StarTransaction {
+	return StarTransaction{ID: id, Amount: amount, Date: at.Unix(), Source: userPartner(userID)}
+}
+
+func starRefund(id string, userID int64, amount int, at time.Time) StarTransaction {
+	return StarTransaction{ID: id, Amount: amount, Date: at.Unix(), Receiver: userPartner(userID)}
+}
+
+func TestReconcileMatch(t *testing.T) {
+	from := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+	now := from.Add(23*time.Hour + 30*time.Minute)
+	at := func(d time.Duration) time.Time { return from.Add(d) }
+
+	stars := []StarTransaction{
+		starPayment("ok", 1, 10, at(time.Hour)),
+		starPayment("unknown", 2, 5, at(2*time.Hour)),
+		starPayment("amount", 3, 20, at(3*time.Hour)),
+		starPayment("undelivered", 4, 10, at(4*time.Hour)),
+		starPayment("recent", 4, 10, at(23*time.Hour)),                  // меньше deliveryGrace до сверки
+		starPayment("boundary", 6, 10, at(23*time.Hour+59*time.Minute)), // в БД оплачен на следующий день
+		starPayment("prev", 7, 10, at(-time.Hour)),                      // в Telegram — предыдущий день
+		starRefund("refunded", 8, 10, at(5*time.Hour)),
+		starRefund("unrecorded", 9, 10, at(6*time.Hour)),
+		starRefund("status-only", 10, 10, at(7*time.Hour)), // возврат без аудита, но статус refunded
+		{ID: "withdrawal", Amount: 500, Date: at(8 * time.Hour).Unix(), Receiver: &TransactionPartner{Type: "fragment"}},
+	}
+	video := func(id string, user int64, amount int, status string, paid time.Time, delivered bool) dbPayment {
+		return dbPayment{ID: int64(len(id)), ChargeID: id, UserID: user, Amount: amount, Status: status,
+			Product: ProductVideo, PaidAt: paid, Delivered: delivered}
+	}
+	data := reconcileData{
+		payments: []dbPayment{
+			video("ok", 1, 10, payment.StatusCompleted, at(time.Hour), true),
+			video("amount", 3, 15, payment.StatusCompleted, at(3*time.Hour), true),
+			video("undelivered", 4, 10, payment.StatusSuccess, at(4*time.Hour), false),
+			video("recent", 4, 10, payment.StatusSuccess, at(23*time.Hour), false),
+			video("prev", 7, 10, payment.StatusCompleted, at(10*time.Minute), true),
+			video("missing", 11, 10, payment.StatusCompleted, at(9*time.Hour), true),
+		},
+		paymentsByCharge: []dbPayment{
+			video("ok", 1, 10, payment.StatusCompleted, at(time.Hour), true),
+			video("boundary", 6, 10, payment.StatusCompleted, to.Add(time.Minute), true),
+			video("refunded", 8, 10, payment.StatusRefunded, at(-48*time.Hour), true),
+			video("unrecorded", 9, 10, payment.StatusCompleted, at(-48*time.Hour), true),
+			video("status-only", 10, 10, payment.StatusRefunded, at(-48*time.Hour), true),
+		},
+		refunds: []dbRefund{
+			{ChargeID: "refunded", TransactionID: 8, UserID: 8, Amount: 10, CreatedAt: at(5 * time.Hour)},
+			{ChargeID: "local", TransactionID: 12, UserID: 12, Amount: 7, CreatedAt: at(10 * time.Hour)},
+		},
+		refundsByCharge: []dbRefund{
+			{ChargeID: "refunded", TransactionID: 8, UserID: 8, Amount: 10, CreatedAt: at(5 * time.Hour)},
+		},
+	}
+
+	rec := &Reconciliation{From: from, To: to}
+	rec.match(indexStarTransactions(stars, from, to), data, now)
+
+	if rec.TelegramPayments != 6 || rec.TelegramGross != 65 {
+		t.Errorf("платежи Telegram: %d на %d, ожидалось 6 на 65", rec.TelegramPayments, rec.TelegramGross)
+	}
+	if rec.TelegramRefunds != 3 || rec.TelegramRefunded != 30 {
+		t.Errorf("возвраты Telegram: %d на %d, ожидалось 3 на 30", rec.TelegramRefunds, rec.TelegramRefunded)
+	}
+
+	want := map[string]Mismatch{
+		"unknown":     {Kind: MismatchUnknownPayment, ChargeID: "unknown", UserID: 2, Amount: 5, At: at(2 * time.Hour)},
+		"amount":      {Kind: MismatchAmount, ChargeID: "amount", TransactionID: 6, UserID: 3, Amount: 15, TelegramAmount: 20, At: at(3 * time.Hour)},
+		"undelivered": {Kind: MismatchNotDelivered, ChargeID: "undelivered", TransactionID: 11, UserID: 4, Amount: 10, At: at(4 * time.Hour)},
+		"unrecorded":  {Kind: MismatchUnrecordedRefund, ChargeID: "unrecorded", TransactionID: 10, UserID: 9, Amount: 10, At: at(6 * time.Hour)},
+		"missing":     {Kind: MismatchMissingPayment, ChargeID: "missing", TransactionID: 7, UserID: 11, Amount: 10, At: at(9 * time.Hour)},
+		"local":       {Kind: MismatchRefundNotTelegram, ChargeID: "local", TransactionID: 12, UserID: 12, Amount: 7, At: at(10 * time.Hour)},
+	}
+	if len(rec.Mismatches) != len(want) {
+		t.Errorf("расхождений %d, ожидалось %d: %+v", len(rec.Mismatches), len(want), rec.Mismatches)
+	}
+	for _, m := range rec.Mismatches {
+		w, ok := want[m.ChargeID]
+		if !ok {
+			t.Errorf("лишнее расхождение: %+v", m)
+			continue
+		}
+		// Время из Telegram приходит в локальной зоне, поэтому сравнивается через Equal
+		got := m
+		got.At = w.At
+		if !m.At.Equal(w.At) || got != w {
+			t.Errorf("%s:\n получено  %+v\n ожидалось %+v", m.ChargeID, m, w)
+		}
+	}
+	if !sort.SliceIsSorted(rec.Mismatches, func(i, j int) bool {
+		return rec.Mismatches[i].At.Before(rec.Mismatches[j].At)
+	}) {
+		t.Error("расхождения не отсортированы по времени")
+	}
+}
@@ -0,0 +1,100 @@
+package revenue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"YoutubeDownloader/internal/payment"
+)
+
+// Параметры постраничного чтения getStarTransactions
+const (
+	starPageLimit = 100  // максимум Bot API за один запрос
+	starMaxPages  = 1000 // защита от бесконечного цикла: 100 000 транзакций
+)
+
+// partnerUser тип TransactionPartner для платежей пользователей и возвратов им
+const partnerUser = "user"
+
+// TransactionPartner сторона транзакции Telegram Stars
+type TransactionPartner struct {
+	Type string `json:"type"`
+	User *struct {
+		ID int64 `json:"id"`
+	} `json:"user,omitempty"`
+	InvoicePayload string `json:"invoice_payload,omitempty"`
+}
+
+// StarTransaction транзакция Telegram Stars. У входящего платежа id совпадает с
+// telegram_payment_charge_id, у возврата — с id исходного платежа
+type StarTransaction struct {
+	ID       string              `json:"id"`
+	Amount   int                 `json:"amount"`
+	Date     int64               `json:"date"`
+	Source   *TransactionPartner `json:"source,omitempty"`   // у входящих транзакций
+	Receiver *TransactionPartner `json:"receiver,omitempty"` // у исходящих транзакций
+}
+
+// IsPayment входящий платеж пользователя
+func (t StarTransaction) IsPayment() bool {
+	return t.Source != nil && t.Source.Type == partnerUser
+}
+
+// IsRefund возврат Stars пользователю
+func (t StarTransaction) IsRefund() bool {
+	return t.Receiver != nil && t.Receiver.Type == partnerUser
+}
+
+// UserID пользователь платежа или возврата, 0 для остальных транзакций
+func (t StarTransaction) UserID() int64 {
+	for _, p := range []*TransactionPartner{t.Source, t.Receiver} {
+		if p != nil && p.User != nil {
+			return p.User.ID
+		}
+	}
+	return 0
+}
+
+// Time время транзакции
+func (t StarTransaction) Time() time.Time {
+	return time.Unix(t.Date, 0)
+}
+
+// FetchStarTransactions читает все транзакции Stars бота через getStarTransactions.
+// api — *tele.Bot; для проверки сверки без Telegram достаточно бота, у которого URL
+// указывает на httptest-сервер, отвечающий на getStarTransactions
+func FetchStarTransactions(api payment.APIClient) ([]StarTransaction, error) {
+	var result []StarTransaction
+	for page := 0; page < starMaxPages; page++ {
+		body, err := api.Raw("getStarTransactions", map[string]int{
+			"offset": page * starPageLimit,
+			"limit":  starPageLimit,
+		})
+		if err != nil {
+			// Сетевая ошибка содержит URL с токеном — возвращаем только причину
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			return nil, fmt.Errorf("ошибка запроса getStarTransactions: %w", err)
+		}
+
+		var resp struct {
+			Result struct {
+				Transactions []StarTransaction `json:"transactions"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, fmt.Errorf("ошибка разбора ответа getStarTransactions: %v", err)
+		}
+
+		result = append(result, resp.Result.Transactions...)
+		if len(resp.Result.Transactions) < starPageLimit {
+			return result, nil
+		}
+	}
+	return nil, fmt.Errorf("getStarTransactions: больше %d транзакций", starPageLimit*starMaxPages)
+}
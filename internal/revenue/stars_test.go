@@ -0,0 +1,114 @@
+package revenue
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+const testToken = "123:TEST"
+
+// starServer поддельный Bot API: отдает total транзакций страницами по offset/limit
+// и запоминает запрошенные offset
+func starServer(t *testing.T, total int) (*httptest.Server, *[]int) {
+	t.Helper()
+	var offsets []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bot"+testToken+"/getStarTransactions" {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			Offset int `json:"offset"`
+			Limit  int `json:"limit"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("тело запроса: %v", err)
+		}
+		offsets = append(offsets, req.Offset)
+
+		var page []StarTransaction
+		for i := req.Offset; i < total && i < req.Offset+req.Limit; i++ {
+			page = append(page, StarTransaction{ID: fmt.Sprintf("charge-%d", i), Amount: 1, Date: int64(i)})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":     true,
+			"result": map[string]interface{}{"transactions": page},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &offsets
+}
+
+func testBot(t *testing.T, url string) *tele.Bot {
+	t.Helper()
+	bot, err := tele.NewBot(tele.Settings{URL: url, Token: testToken, Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bot
+}
+
+func TestFetchStarTransactionsPaging(t *testing.T) {
+	tests := []struct {
+		total   int
+		offsets []int
+	}{
+		{0, []int{0}},
+		{42, []int{0}},
+		{starPageLimit, []int{0, 100}},             // полная страница — нужен запрос следующей
+		{2*starPageLimit + 50, []int{0, 100, 200}}, // последняя страница неполная
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.total), func(t *testing.T) {
+			srv, offsets := starServer(t, tt.total)
+
+			got, err := FetchStarTransactions(testBot(t, srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.total {
+				t.Fatalf("получено %d транзакций, ожидалось %d", len(got), tt.total)
+			}
+			for i, trx := range got {
+				if want := fmt.Sprintf("charge-%d", i); trx.ID != want {
+					t.Fatalf("транзакция %d: id %q, ожидался %q", i, trx.ID, want)
+				}
+			}
+			if fmt.Sprint(*offsets) != fmt.Sprint(tt.offsets) {
+				t.Errorf("offset запросов %v, ожидались %v", *offsets, tt.offsets)
+			}
+		})
+	}
+}
+
+func TestFetchStarTransactionsAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"ok":false,"error_code":401,"description":"Unauthorized"}`))
+	}))
+	defer srv.Close()
+
+	if _, err := FetchStarTransactions(testBot(t, srv.URL)); err == nil {
+		t.Fatal("ожидалась ошибка")
+	}
+}
+
+func TestFetchStarTransactionsNetworkErrorHidesToken(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	_, err := FetchStarTransactions(testBot(t, url))
+	if err == nil {
+		t.Fatal("ожидалась ошибка")
+	}
+	if strings.Contains(err.Error(), testToken) {
+		t.Errorf("токен в тексте ошибки: %v", err)
+	}
+}
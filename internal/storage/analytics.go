@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DailyActivity показатели за один день по таблице events
+type DailyActivity struct {
+	Day       time.Time `json:"day"`
+	DAU       int64     `json:"dau"`
+	WAU       int64     `json:"wau"` // уникальные пользователи за 7 дней, включая этот
+	MAU       int64     `json:"mau"` // уникальные пользователи за 30 дней, включая этот
+	NewUsers  int64     `json:"new_users"`
+	Messages  int64     `json:"messages"`
+	Links     int64     `json:"links"`
+	Paywalls  int64     `json:"paywalls"`
+	Payments  int64     `json:"payments"`
+	Downloads int64     `json:"downloads"`
+}
+
+// RetentionCohort удержание пользователей, впервые пришедших в один день
+type RetentionCohort struct {
+	Day     time.Time `json:"day"`
+	Size    int64     `json:"size"`
+	D1      int64     `json:"d1"`       // вернулись на следующий день
+	D7      int64     `json:"d7"`       // вернулись на седьмой день
+	D1Ready bool      `json:"d1_ready"` // день D1 уже закончился
+	D7Ready bool      `json:"d7_ready"`
+}
+
+// PlanConversion оплаты по одному правилу цены или плану
+type PlanConversion struct {
+	Plan     string `json:"plan"`
+	Payers   int64  `json:"payers"`
+	Payments int64  `json:"payments"`
+	Amount   int64  `json:"amount"`
+}
+
+// Funnel воронка ссылка → пейволл → оплата → скачивание за период
+type Funnel struct {
+	LinkUsers      int64            `json:"link_users"`
+	PaywallUsers   int64            `json:"paywall_users"`
+	PaywallShows   int64            `json:"paywall_shows"`
+	Payers         int64            `json:"payers"` // оплатившие среди увидевших пейволл
+	DeliveredUsers int64            `json:"delivered_users"`
+	Plans          []PlanConversion `json:"plans"`
+}
+
+// dateArg передает границу периода в запрос как дату, без часового пояса
+func dateArg(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// GetDailyActivity возвращает показатели по дням с from по to включительно
+func GetDailyActivity(db *sql.DB, from, to time.Time) ([]DailyActivity, error) {
+	query := `WITH days AS (
+				SELECT generate_series($1::date, $2::date, INTERVAL '1 day')::date AS day
+			  ), first_seen AS (
+				SELECT user_id, MIN(created_at)::date AS day FROM events GROUP BY user_id
+			  )
+			  SELECT d.day,
+				(SELECT COUNT(DISTINCT user_id) FROM events WHERE created_at >= d.day AND created_at < d.day + 1),
+				(SELECT COUNT(DISTINCT user_id) FROM events WHERE created_at >= d.day - 6 AND created_at < d.day + 1),
+				(SELECT COUNT(DISTINCT user_id) FROM events WHERE created_at >= d.day - 29 AND created_at < d.day + 1),
+				(SELECT COUNT(*) FROM first_seen f WHERE f.day = d.day),
+				c.messages, c.links, c.paywalls, c.payments, c.downloads
+			  FROM days d
+			  CROSS JOIN LATERAL (
+				SELECT COUNT(*) FILTER (WHERE type = 'message') AS messages,
+					   COUNT(*) FILTER (WHERE type = 'link') AS links,
+					   COUNT(*) FILTER (WHERE type = 'paywall_shown') AS paywalls,
+					   COUNT(*) FILTER (WHERE type = 'payment') AS payments,
+					   COUNT(*) FILTER (WHERE type = 'download_delivered') AS downloads
+				FROM events WHERE created_at >= d.day AND created_at < d.day + 1
+			  ) c
+			  ORDER BY d.day`
+
+	rows, err := db.Query(query, dateArg(from), dateArg(to))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения активности по дням: %v", err)
+	}
+	defer rows.Close()
+
+	var result []DailyActivity
+	for rows.Next() {
+		var a DailyActivity
+		if err := rows.Scan(&a.Day, &a.DAU, &a.WAU, &a.MAU, &a.NewUsers, &a.Messages, &a.Links, &a.Paywalls, &a.Payments, &a.Downloads); err != nil {
+			return nil, fmt.Errorf("ошибка чтения активности: %v", err)
+		}
+		result = append(result, a)
+	}
+	return result, rows.Err()
+}
+
+// GetRetention возвращает D1/D7 удержание когорт новых пользователей с from по to включительно.
+// Пустые дни пропускаются
+func GetRetention(db *sql.DB, from, to time.Time) ([]RetentionCohort, error) {
+	query := `WITH first_seen AS (
+				SELECT user_id, MIN(created_at)::date AS day FROM events GROUP BY user_id
+			  ), active AS (
+				SELECT DISTINCT user_id, created_at::date AS day FROM events
+				WHERE created_at >= $1::date AND created_at < $2::date + 8
+			  )
+			  SELECT f.day, COUNT(*), COUNT(a1.user_id), COUNT(a7.user_id),
+				f.day + 1 < CURRENT_DATE, f.day + 7 < CURRENT_DATE
+			  FROM first_seen f
+			  LEFT JOIN active a1 ON a1.user_id = f.user_id AND a1.day = f.day + 1
+			  LEFT JOIN active a7 ON a7.user_id = f.user_id AND a7.day = f.day + 7
+			  WHERE f.day BETWEEN $1::date AND $2::date
+			  GROUP BY f.day
+			  ORDER BY f.day`
+
+	rows, err := db.Query(query, dateArg(from), dateArg(to))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения удержания: %v", err)
+	}
+	defer rows.Close()
+
+	var result []RetentionCohort
+	for rows.Next() {
+		var r RetentionCohort
+		if err := rows.Scan(&r.Day, &r.Size, &r.D1, &r.D7, &r.D1Ready, &r.D7Ready); err != nil {
+			return nil, fmt.Errorf("ошибка чтения удержания: %v", err)
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// GetFunnel возвращает воронку и конверсию пейволла в оплату по планам с from по to включительно.
+// В оплатах учитываются только пользователи, видевшие пейволл за период
+func GetFunnel(db *sql.DB, from, to time.Time) (*Funnel, error) {
+	var f Funnel
+	err := db.QueryRow(`
+		WITH period AS (
+			SELECT * FROM events WHERE created_at >= $1::date AND created_at < $2::date + 1
+		), shown AS (
+			SELECT DISTINCT user_id FROM period WHERE type = 'paywall_shown'
+		)
+		SELECT
+			(SELECT COUNT(DISTINCT user_id) FROM period WHERE type = 'link'),
+			(SELECT COUNT(*) FROM shown),
+			(SELECT COUNT(*) FROM period WHERE type = 'paywall_shown'),
+			(SELECT COUNT(DISTINCT p.user_id) FROM period p JOIN shown USING (user_id) WHERE p.type = 'payment'),
+			(SELECT COUNT(DISTINCT user_id) FROM period WHERE type = 'download_delivered')`,
+		dateArg(from), dateArg(to)).Scan(&f.LinkUsers, &f.PaywallUsers, &f.PaywallShows, &f.Payers, &f.DeliveredUsers)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения воронки: %v", err)
+	}
+
+	rows, err := db.Query(`
+		SELECT e.plan, COUNT(DISTINCT e.user_id), COUNT(*), COALESCE(SUM(e.amount), 0)
+		FROM events e
+		WHERE e.type = 'payment' AND e.created_at >= $1::date AND e.created_at < $2::date + 1
+		  AND EXISTS (SELECT 1 FROM events s WHERE s.user_id = e.user_id AND s.type = 'paywall_shown'
+					  AND s.created_at >= $1::date AND s.created_at < $2::date + 1)
+		GROUP BY e.plan
+		ORDER BY COUNT(DISTINCT e.user_id) DESC, e.plan`,
+		dateArg(from), dateArg(to))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения конверсии по планам: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p PlanConversion
+		if err := rows.Scan(&p.Plan, &p.Payers, &p.Payments, &p.Amount); err != nil {
+			return nil, fmt.Errorf("ошибка чтения конверсии: %v", err)
+		}
+		f.Plans = append(f.Plans, p)
+	}
+	return &f, rows.Err()
+}
@@ -0,0 +1,366 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Статусы рассылок
+const (
+	BroadcastDraft     = "draft"     // создана, ждет подтверждения после предпросмотра
+	BroadcastQueued    = "queued"    // подтверждена, получатели зафиксированы
+	BroadcastRunning   = "running"   // отправляется
+	BroadcastDone      = "done"      // все получатели обработаны
+	BroadcastCancelled = "cancelled" // отменена администратором
+)
+
+// Статусы получателей рассылки
+const (
+	RecipientPending = "pending"
+	RecipientSent    = "sent"
+	RecipientFailed  = "failed"
+	RecipientBlocked = "blocked" // пользователь заблокировал бота или удалил аккаунт
+	RecipientSkipped = "skipped" // к моменту отправки отписался от рассылок или перестал быть активным
+)
+
+// BroadcastLeaseTTL сколько рассылка остается за экземпляром бота без продления аренды.
+// После этого ее может подхватить другой экземпляр (или этот же после перезапуска)
+const BroadcastLeaseTTL = 5 * time.Minute
+
+// Виды сегментов рассылки
+const (
+	SegmentAll         = "all"         // все пользователи
+	SegmentActive      = "active"      // active:<дни> — писали боту за последние N дней
+	SegmentSubscribers = "subscribers" // действующая премиум-подписка
+	SegmentLanguage    = "lang"        // lang:<код> — язык бота у пользователя
+)
+
+// ErrBroadcastState рассылка уже подтверждена, отменена или не найдена
+var ErrBroadcastState = errors.New("рассылка недоступна для этого действия")
+
+// BroadcastSegment получатели рассылки
+type BroadcastSegment struct {
+	Kind     string
+	Days     int    // для active
+	Language string // для lang
+}
+
+// ParseBroadcastSegment разбирает сегмент вида all, active:7, subscribers, lang:en
+func ParseBroadcastSegment(s string) (BroadcastSegment, error) {
+	kind, value, _ := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+	switch kind {
+	case SegmentAll, SegmentSubscribers:
+		if value == "" {
+			return BroadcastSegment{Kind: kind}, nil
+		}
+	case SegmentActive:
+		if days, err := strconv.Atoi(value); err == nil && days > 0 {
+			return BroadcastSegment{Kind: kind, Days: days}, nil
+		}
+	case SegmentLanguage:
+		if value != "" {
+			return BroadcastSegment{Kind: kind, Language: value}, nil
+		}
+	}
+	return BroadcastSegment{}, fmt.Errorf("неизвестный сегмент %q", s)
+}
+
+// String возвращает сегмент в том же виде, в каком он разбирается
+func (s BroadcastSegment) String() string {
+	switch s.Kind {
+	case SegmentActive:
+		return SegmentActive + ":" + strconv.Itoa(s.Days)
+	case SegmentLanguage:
+		return SegmentLanguage + ":" + s.Language
+	}
+	return s.Kind
+}
+
+// audienceQuery запрос user_id получателей сегмента; параметры добавляются к args.
+// Отписавшиеся от новостей и заблокировавшие бота исключаются всегда. Язык — выбранный
+// через /language, иначе из профиля Telegram, иначе fallbackLang
+func (s BroadcastSegment) audienceQuery(fallbackLang string, args []interface{}) (string, []interface{}) {
+	query := `SELECT s.user_id FROM user_stats s
+			  LEFT JOIN users u ON u.user_id = s.user_id
+			  WHERE NOT COALESCE(u.news_opt_out, FALSE) AND COALESCE(u.state, 'active') = 'active'`
+
+	switch s.Kind {
+	case SegmentActive:
+		args = append(args, s.Days)
+		query += fmt.Sprintf(` AND s.last_active >= NOW() - $%d * INTERVAL '1 day'`, len(args))
+	case SegmentSubscribers:
+		query += ` AND u.premium_until > NOW()`
+	case SegmentLanguage:
+		args = append(args, fallbackLang, s.Language)
+		query += fmt.Sprintf(` AND COALESCE(NULLIF(u.language_code, ''), NULLIF(u.telegram_language, ''), $%d) = $%d`, len(args)-1, len(args))
+	}
+	return query, args
+}
+
+// CountBroadcastAudience считает получателей сегмента на текущий момент
+func CountBroadcastAudience(db *sql.DB, segment BroadcastSegment, fallbackLang string) (int64, error) {
+	query, args := segment.audienceQuery(fallbackLang, nil)
+
+	var count int64
+	if err := db.QueryRow(`SELECT COUNT(*) FROM (`+query+`) a`, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("ошибка подсчета получателей рассылки: %v", err)
+	}
+	return count, nil
+}
+
+// BroadcastButton кнопка-ссылка под сообщением рассылки
+type BroadcastButton struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+// Broadcast рассылка: копия сообщения FromChatID/MessageID с кнопками для сегмента
+type Broadcast struct {
+	ID         int64
+	AdminID    int64
+	FromChatID int64
+	MessageID  int
+	Buttons    []BroadcastButton
+	Segment    string
+	Status     string
+	CreatedAt  time.Time
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+
+	// Получатели по статусам
+	Total   int64
+	Pending int64
+	Sent    int64
+	Failed  int64
+	Blocked int64
+	Skipped int64
+}
+
+// CreateBroadcast сохраняет черновик рассылки и возвращает его id
+func CreateBroadcast(db *sql.DB, b *Broadcast) (int64, error) {
+	buttons := ""
+	if len(b.Buttons) > 0 {
+		data, err := json.Marshal(b.Buttons)
+		if err != nil {
+			return 0, err
+		}
+		buttons = string(data)
+	}
+
+	query := `INSERT INTO broadcasts (admin_id, from_chat_id, message_id, buttons, segment, status)
+			  VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+
+	var id int64
+	if err := db.QueryRow(query, b.AdminID, b.FromChatID, b.MessageID, buttons, b.Segment, BroadcastDraft).Scan(&id); err != nil {
+		return 0, fmt.Errorf("ошибка создания рассылки: %v", err)
+	}
+	return id, nil
+}
+
+const broadcastColumns = `b.id, b.admin_id, b.from_chat_id, b.message_id, b.buttons, b.segment, b.status,
+		b.created_at, b.started_at, b.finished_at,
+		COUNT(r.user_id),
+		COUNT(r.user_id) FILTER (WHERE r.status = 'pending'),
+		COUNT(r.user_id) FILTER (WHERE r.status = 'sent'),
+		COUNT(r.user_id) FILTER (WHERE r.status = 'failed'),
+		COUNT(r.user_id) FILTER (WHERE r.status = 'blocked'),
+		COUNT(r.user_id) FILTER (WHERE r.status = 'skipped')`
+
+func scanBroadcast(row interface{ Scan(...interface{}) error }) (*Broadcast, error) {
+	var b Broadcast
+	var buttons string
+	err := row.Scan(&b.ID, &b.AdminID, &b.FromChatID, &b.MessageID, &buttons, &b.Segment, &b.Status,
+		&b.CreatedAt, &b.StartedAt, &b.FinishedAt, &b.Total, &b.Pending, &b.Sent, &b.Failed, &b.Blocked, &b.Skipped)
+	if err != nil {
+		return nil, err
+	}
+	if buttons != "" {
+		if err := json.Unmarshal([]byte(buttons), &b.Buttons); err != nil {
+			return nil, fmt.Errorf("ошибка чтения кнопок рассылки %d: %v", b.ID, err)
+		}
+	}
+	return &b, nil
+}
+
+// GetBroadcast возвращает рассылку с числом получателей по статусам. nil — рассылки нет
+func GetBroadcast(db *sql.DB, id int64) (*Broadcast, error) {
+	row := db.QueryRow(`SELECT `+broadcastColumns+`
+		FROM broadcasts b LEFT JOIN broadcast_recipients r ON r.broadcast_id = b.id
+		WHERE b.id = $1 GROUP BY b.id`, id)
+
+	b, err := scanBroadcast(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения рассылки: %v", err)
+	}
+	return b, nil
+}
+
+// GetRecentBroadcasts возвращает последние рассылки, начиная с новых
+func GetRecentBroadcasts(db *sql.DB, limit int) ([]Broadcast, error) {
+	rows, err := db.Query(`SELECT `+broadcastColumns+`
+		FROM broadcasts b LEFT JOIN broadcast_recipients r ON r.broadcast_id = b.id
+		GROUP BY b.id ORDER BY b.id DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения рассылок: %v", err)
+	}
+	defer rows.Close()
+
+	var result []Broadcast
+	for rows.Next() {
+		b, err := scanBroadcast(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения рассылки: %v", err)
+		}
+		result = append(result, *b)
+	}
+	return result, rows.Err()
+}
+
+// QueueBroadcast подтверждает черновик: фиксирует получателей сегмента на текущий момент
+// и ставит рассылку в очередь. Возвращает число получателей
+func QueueBroadcast(db *sql.DB, id int64, segment BroadcastSegment, fallbackLang string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE broadcasts SET status = $2 WHERE id = $1 AND status = $3`, id, BroadcastQueued, BroadcastDraft)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка подтверждения рассылки: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return 0, ErrBroadcastState
+	}
+
+	audience, args := segment.audienceQuery(fallbackLang, []interface{}{id})
+	res, err = tx.Exec(`INSERT INTO broadcast_recipients (broadcast_id, user_id)
+		SELECT $1, a.user_id FROM (`+audience+`) a`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сохранения получателей рассылки: %v", err)
+	}
+	count, _ := res.RowsAffected()
+
+	return count, tx.Commit()
+}
+
+// CancelBroadcast отменяет рассылку, которая еще не завершена. Уже отправленные сообщения остаются
+func CancelBroadcast(db *sql.DB, id int64) error {
+	res, err := db.Exec(`UPDATE broadcasts SET status = $2, finished_at = NOW()
+		WHERE id = $1 AND status IN ('draft', 'queued', 'running')`, id, BroadcastCancelled)
+	if err != nil {
+		return fmt.Errorf("ошибка отмены рассылки: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return ErrBroadcastState
+	}
+	return nil
+}
+
+// StartNextBroadcast берет в аренду owner самую раннюю рассылку из очереди (или прерванную,
+// аренда которой истекла) и переводит ее в running. Возвращает ее id. 0 — свободных рассылок нет
+func StartNextBroadcast(db *sql.DB, owner string) (int64, error) {
+	var id int64
+	err := db.QueryRow(`UPDATE broadcasts SET status = 'running', started_at = COALESCE(started_at, NOW()),
+			owner = $1, heartbeat_at = NOW()
+		WHERE id = (
+			SELECT id FROM broadcasts
+			WHERE status = 'queued'
+			   OR (status = 'running' AND (heartbeat_at IS NULL OR heartbeat_at < NOW() - make_interval(secs => $2)))
+			ORDER BY id LIMIT 1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING id`, owner, BroadcastLeaseTTL.Seconds()).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ошибка запуска рассылки: %v", err)
+	}
+	return id, nil
+}
+
+// RenewBroadcastLease продлевает аренду рассылки. false — рассылку отменили, завершили
+// или ее уже подхватил другой экземпляр, и отправку нужно прекратить
+func RenewBroadcastLease(db *sql.DB, id int64, owner string) (bool, error) {
+	res, err := db.Exec(`UPDATE broadcasts SET heartbeat_at = NOW()
+		WHERE id = $1 AND owner = $2 AND status = 'running'`, id, owner)
+	if err != nil {
+		return false, fmt.Errorf("ошибка продления аренды рассылки: %v", err)
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// ReleaseBroadcastLease снимает аренду, чтобы прерванную рассылку сразу продолжили после перезапуска
+func ReleaseBroadcastLease(db *sql.DB, id int64, owner string) error {
+	_, err := db.Exec(`UPDATE broadcasts SET heartbeat_at = NULL WHERE id = $1 AND owner = $2`, id, owner)
+	return err
+}
+
+// FinishBroadcast отмечает рассылку завершенной, если ее не отменили и она все еще за owner
+func FinishBroadcast(db *sql.DB, id int64, owner string) error {
+	_, err := db.Exec(`UPDATE broadcasts SET status = 'done', finished_at = NOW()
+		WHERE id = $1 AND owner = $2 AND status = 'running'`, id, owner)
+	return err
+}
+
+// GetPendingBroadcastRecipients возвращает до limit получателей, которым еще не отправляли.
+// Получатели фиксируются при подтверждении, поэтому перед выборкой отписавшиеся от рассылок
+// и заблокировавшие бота с тех пор отмечаются skipped
+func GetPendingBroadcastRecipients(db *sql.DB, id int64, limit int) ([]int64, error) {
+	_, err := db.Exec(`UPDATE broadcast_recipients r SET status = 'skipped', sent_at = NOW()
+		FROM users u
+		WHERE r.broadcast_id = $1 AND r.status = 'pending' AND u.user_id = r.user_id
+		  AND (u.news_opt_out OR u.state <> 'active')`, id)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка пропуска отписавшихся получателей рассылки: %v", err)
+	}
+
+	rows, err := db.Query(`SELECT r.user_id FROM broadcast_recipients r
+		LEFT JOIN users u ON u.user_id = r.user_id
+		WHERE r.broadcast_id = $1 AND r.status = 'pending'
+		  AND NOT COALESCE(u.news_opt_out, FALSE) AND COALESCE(u.state, 'active') = 'active'
+		ORDER BY r.user_id LIMIT $2`, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения получателей рассылки: %v", err)
+	}
+	defer rows.Close()
+
+	var result []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		result = append(result, userID)
+	}
+	return result, rows.Err()
+}
+
+// SetBroadcastRecipientStatus сохраняет результат отправки получателю
+func SetBroadcastRecipientStatus(db *sql.DB, id, userID int64, status, errText string) error {
+	_, err := db.Exec(`UPDATE broadcast_recipients SET status = $3, error = NULLIF($4, ''), sent_at = NOW()
+		WHERE broadcast_id = $1 AND user_id = $2`, id, userID, status, errText)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления получателя рассылки: %v", err)
+	}
+	return nil
+}
+
+// SetNewsOptOut включает или выключает отписку пользователя от рассылок
+func SetNewsOptOut(db *sql.DB, userID int64, optOut bool) error {
+	_, err := db.Exec(`INSERT INTO users (user_id, news_opt_out) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET news_opt_out = EXCLUDED.news_opt_out`, userID, optOut)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения отписки от рассылок: %v", err)
+	}
+	return nil
+}
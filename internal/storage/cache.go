@@ -3,6 +3,7 @@ package storage
 import (
 	"database/sql"
 	"fmt"
+	"log/slog"
 	"time"
 )
 
@@ -57,19 +58,32 @@ func DeleteVideoFromCache(db *sql.DB, url string) error {
 	return nil
 }
 
-// CleanOldCache удаляет старые записи из кэша (старше указанного количества дней)
-func CleanOldCache(db *sql.DB, daysOld int) error {
-	query := `DELETE FROM video_cache WHERE created_at < NOW() - INTERVAL '$1 days'`
+// CleanOldCache удаляет записи кэша старше указанного количества дней и возвращает их число
+func CleanOldCache(db *sql.DB, daysOld int) (int64, error) {
+	query := `DELETE FROM video_cache WHERE created_at < NOW() - $1 * INTERVAL '1 day'`
 
 	result, err := db.Exec(query, daysOld)
 	if err != nil {
-		return fmt.Errorf("ошибка очистки старого кэша: %v", err)
+		return 0, fmt.Errorf("ошибка очистки старого кэша: %v", err)
 	}
 
 	rowsAffected, _ := result.RowsAffected()
-	fmt.Printf("[CACHE] Удалено %d старых записей из кэша\n", rowsAffected)
+	slog.Info("Удалены старые записи из кэша", "component", "CACHE", "count", rowsAffected)
 
-	return nil
+	return rowsAffected, nil
+}
+
+// PurgeCache удаляет все записи кэша и возвращает их число
+func PurgeCache(db *sql.DB) (int64, error) {
+	result, err := db.Exec(`DELETE FROM video_cache`)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка полной очистки кэша: %v", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	slog.Info("Кэш полностью очищен", "component", "CACHE", "count", rowsAffected)
+
+	return rowsAffected, nil
 }
 
 // GetCacheStats возвращает статистику кэша
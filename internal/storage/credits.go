@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Причины движения кредитов
+const (
+	CreditGrant          = "grant"           // начислено админом
+	CreditPromo          = "promo"           // активирован промокод
+	CreditDownload       = "download"        // списано за скачивание
+	CreditDownloadRefund = "download_refund" // возвращено после неудачного скачивания
+	CreditReferral       = "referral"        // награда за приглашение
+)
+
+// Ошибки активации промокода
+var (
+	ErrPromoNotFound    = errors.New("промокод не найден")
+	ErrPromoExpired     = errors.New("срок действия промокода истек")
+	ErrPromoExhausted   = errors.New("промокод исчерпан")
+	ErrPromoAlreadyUsed = errors.New("промокод уже использован")
+)
+
+// PromoCode промокод на бесплатные скачивания
+type PromoCode struct {
+	Code         string
+	Credits      int
+	MaxUses      int // 0 — без ограничения
+	PerUserLimit int
+	Uses         int
+	ExpiresAt    *time.Time
+	Disabled     bool
+	CreatedBy    int64
+	CreatedAt    time.Time
+}
+
+// NormalizePromoCode приводит промокод к виду, в котором он хранится в БД
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// GetCreditBalance возвращает баланс кредитов пользователя
+func GetCreditBalance(db *sql.DB, userID int64) (int, error) {
+	var balance int
+	err := db.QueryRow(`SELECT COALESCE(SUM(delta), 0) FROM credit_ledger WHERE user_id = $1`, userID).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения баланса кредитов: %v", err)
+	}
+	return balance, nil
+}
+
+// AddCredits начисляет (или при отрицательном delta списывает) кредиты. Списание не уводит
+// баланс ниже нуля: списывается не больше, чем есть. Возвращает фактическое изменение и новый баланс.
+// adminID 0 означает автоматическое начисление
+func AddCredits(db *sql.DB, userID int64, delta int, reason, ref string, adminID int64) (int, int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	if err := lockUserCredits(tx, userID); err != nil {
+		return 0, 0, err
+	}
+	balance, err := creditBalanceTx(tx, userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if delta < 0 && balance+delta < 0 {
+		delta = -max(balance, 0)
+	}
+	if delta == 0 {
+		return 0, balance, nil
+	}
+	if err := insertCreditEntry(tx, userID, delta, reason, ref, adminID); err != nil {
+		return 0, 0, err
+	}
+	return delta, balance + delta, tx.Commit()
+}
+
+// SpendCredit списывает один кредит за скачивание. Возвращает id записи списания
+// или 0, если кредитов нет
+func SpendCredit(db *sql.DB, userID int64, ref string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := lockUserCredits(tx, userID); err != nil {
+		return 0, err
+	}
+	balance, err := creditBalanceTx(tx, userID)
+	if err != nil || balance < 1 {
+		return 0, err
+	}
+
+	var id int64
+	err = tx.QueryRow(`INSERT INTO credit_ledger (user_id, delta, reason, ref) VALUES ($1, -1, $2, $3) RETURNING id`,
+		userID, CreditDownload, ref).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка списания кредита: %v", err)
+	}
+	return id, tx.Commit()
+}
+
+// RefundCredit возвращает кредит, списанный записью spendID, если он еще не возвращен
+func RefundCredit(db *sql.DB, userID, spendID int64) error {
+	ref := fmt.Sprintf("%d", spendID)
+	_, err := db.Exec(`INSERT INTO credit_ledger (user_id, delta, reason, ref)
+		SELECT $1, 1, $2, $3
+		WHERE NOT EXISTS (SELECT 1 FROM credit_ledger WHERE reason = $2 AND ref = $3)`,
+		userID, CreditDownloadRefund, ref)
+	if err != nil {
+		return fmt.Errorf("ошибка возврата кредита: %v", err)
+	}
+	return nil
+}
+
+// CreatePromoCode создает промокод
+func CreatePromoCode(db *sql.DB, p *PromoCode) error {
+	_, err := db.Exec(`INSERT INTO promo_codes (code, credits, max_uses, per_user_limit, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		NormalizePromoCode(p.Code), p.Credits, p.MaxUses, p.PerUserLimit, p.ExpiresAt, p.CreatedBy)
+	if err != nil {
+		return fmt.Errorf("ошибка создания промокода: %v", err)
+	}
+	return nil
+}
+
+// DisablePromoCode отключает промокод. Возвращает false, если промокод не найден
+func DisablePromoCode(db *sql.DB, code string) (bool, error) {
+	res, err := db.Exec(`UPDATE promo_codes SET disabled = TRUE WHERE code = $1`, NormalizePromoCode(code))
+	if err != nil {
+		return false, fmt.Errorf("ошибка отключения промокода: %v", err)
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// GetPromoCodes возвращает последние созданные промокоды
+func GetPromoCodes(db *sql.DB, limit int) ([]PromoCode, error) {
+	rows, err := db.Query(`SELECT code, credits, max_uses, per_user_limit, uses, expires_at, disabled, created_by, created_at
+		FROM promo_codes ORDER BY created_at DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения промокодов: %v", err)
+	}
+	defer rows.Close()
+
+	var result []PromoCode
+	for rows.Next() {
+		p, err := scanPromoCode(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *p)
+	}
+	return result, rows.Err()
+}
+
+// RedeemPromoCode активирует промокод для пользователя и возвращает начисленные кредиты и новый баланс
+func RedeemPromoCode(db *sql.DB, code string, userID int64) (credits, balance int, err error) {
+	code = NormalizePromoCode(code)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	p, err := scanPromoCode(tx.QueryRow(`SELECT code, credits, max_uses, per_user_limit, uses, expires_at, disabled, created_by, created_at
+		FROM promo_codes WHERE code = $1 FOR UPDATE`, code))
+	if err == sql.ErrNoRows {
+		return 0, 0, ErrPromoNotFound
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	switch {
+	case p.Disabled:
+		return 0, 0, ErrPromoNotFound
+	case p.ExpiresAt != nil && p.ExpiresAt.Before(time.Now()):
+		return 0, 0, ErrPromoExpired
+	case p.MaxUses > 0 && p.Uses >= p.MaxUses:
+		return 0, 0, ErrPromoExhausted
+	}
+
+	var used int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM promo_redemptions WHERE code = $1 AND user_id = $2`, code, userID).Scan(&used); err != nil {
+		return 0, 0, err
+	}
+	if p.PerUserLimit > 0 && used >= p.PerUserLimit {
+		return 0, 0, ErrPromoAlreadyUsed
+	}
+
+	if _, err := tx.Exec(`INSERT INTO promo_redemptions (code, user_id) VALUES ($1, $2)`, code, userID); err != nil {
+		return 0, 0, err
+	}
+	if _, err := tx.Exec(`UPDATE promo_codes SET uses = uses + 1 WHERE code = $1`, code); err != nil {
+		return 0, 0, err
+	}
+
+	if err := lockUserCredits(tx, userID); err != nil {
+		return 0, 0, err
+	}
+	if err := insertCreditEntry(tx, userID, p.Credits, CreditPromo, code, 0); err != nil {
+		return 0, 0, err
+	}
+	balance, err = creditBalanceTx(tx, userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	return p.Credits, balance, tx.Commit()
+}
+
+// lockUserCredits сериализует изменения баланса одного пользователя до конца транзакции
+func lockUserCredits(tx *sql.Tx, userID int64) error {
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, userID); err != nil {
+		return fmt.Errorf("ошибка блокировки баланса кредитов: %v", err)
+	}
+	return nil
+}
+
+func insertCreditEntry(tx *sql.Tx, userID int64, delta int, reason, ref string, adminID int64) error {
+	var admin sql.NullInt64
+	if adminID != 0 {
+		admin = sql.NullInt64{Int64: adminID, Valid: true}
+	}
+	_, err := tx.Exec(`INSERT INTO credit_ledger (user_id, delta, reason, ref, admin_id) VALUES ($1, $2, $3, $4, $5)`,
+		userID, delta, reason, ref, admin)
+	if err != nil {
+		return fmt.Errorf("ошибка записи в журнал кредитов: %v", err)
+	}
+	return nil
+}
+
+func creditBalanceTx(tx *sql.Tx, userID int64) (int, error) {
+	var balance int
+	err := tx.QueryRow(`SELECT COALESCE(SUM(delta), 0) FROM credit_ledger WHERE user_id = $1`, userID).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения баланса кредитов: %v", err)
+	}
+	return balance, nil
+}
+
+func scanPromoCode(row rowScanner) (*PromoCode, error) {
+	var p PromoCode
+	var expiresAt sql.NullTime
+	err := row.Scan(&p.Code, &p.Credits, &p.MaxUses, &p.PerUserLimit, &p.Uses, &expiresAt, &p.Disabled, &p.CreatedBy, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		p.ExpiresAt = &expiresAt.Time
+	}
+	return &p, nil
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Типы событий аналитики
+const (
+	EventMessage           = "message"            // любое сообщение пользователя
+	EventLink              = "link"               // сообщение со ссылкой на видео
+	EventPaywallShown      = "paywall_shown"      // показана платежная клавиатура
+	EventPayment           = "payment"            // успешная оплата
+	EventDownloadDelivered = "download_delivered" // видео отправлено пользователю
+	EventPaymentError      = "payment_error"      // ошибка выставления или обработки платежа
+	EventReactivated       = "reactivated"        // пользователь вернулся после блокировки бота
+)
+
+// Event событие аналитики
+type Event struct {
+	UserID int64
+	Type   string
+	Plan   string // правило цены (paywall_shown, payment) или "plan:<id>" для подписок; этап для payment_error; прежнее состояние для reactivated
+	Amount int    // сумма в Stars
+}
+
+// RecordEvent сохраняет событие
+func RecordEvent(db *sql.DB, e Event) error {
+	_, err := db.Exec(`INSERT INTO events (user_id, type, plan, amount) VALUES ($1, $2, $3, $4)`,
+		e.UserID, e.Type, e.Plan, e.Amount)
+	if err != nil {
+		return fmt.Errorf("ошибка записи события %s: %v", e.Type, err)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Статусы задач скачивания
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// DownloadJob задача скачивания видео пользователем
+type DownloadJob struct {
+	ID         int64
+	RequestID  string
+	UserID     int64
+	URL        string
+	ChargeID   string
+	Status     string
+	Error      string
+	CreatedAt  time.Time
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+}
+
+const downloadJobColumns = `id, request_id, user_id, url, charge_id, status, error, created_at, started_at, finished_at`
+
+// CreateDownloadJob создает задачу скачивания в статусе queued
+func CreateDownloadJob(db *sql.DB, requestID string, userID int64, url, chargeID string) (int64, error) {
+	query := `INSERT INTO download_jobs (request_id, user_id, url, charge_id, status)
+			  VALUES ($1, $2, $3, $4, $5) RETURNING id`
+
+	var id int64
+	if err := db.QueryRow(query, requestID, userID, url, chargeID, JobQueued).Scan(&id); err != nil {
+		return 0, fmt.Errorf("ошибка создания задачи скачивания: %v", err)
+	}
+	return id, nil
+}
+
+// SetDownloadJobStatus меняет статус задачи. Для running проставляется started_at,
+// для done и failed — finished_at
+func SetDownloadJobStatus(db *sql.DB, id int64, status, errText string) error {
+	query := `UPDATE download_jobs SET
+			  status = $2,
+			  error = NULLIF($3, ''),
+			  started_at = CASE WHEN $2 = 'running' THEN NOW() ELSE started_at END,
+			  finished_at = CASE WHEN $2 IN ('done', 'failed') THEN NOW() ELSE finished_at END
+			  WHERE id = $1`
+
+	if _, err := db.Exec(query, id, status, errText); err != nil {
+		return fmt.Errorf("ошибка обновления задачи скачивания: %v", err)
+	}
+	return nil
+}
+
+// MarkDownloadJobCacheHit отмечает, что видео отправлено из кэша без скачивания
+func MarkDownloadJobCacheHit(db *sql.DB, id int64) error {
+	if _, err := db.Exec(`UPDATE download_jobs SET cache_hit = TRUE WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("ошибка обновления задачи скачивания: %v", err)
+	}
+	return nil
+}
+
+// FailStaleDownloadJobs помечает как failed задачи, оставшиеся незавершенными
+// после перезапуска бота. Возвращает количество таких задач
+func FailStaleDownloadJobs(db *sql.DB, reason string) (int64, error) {
+	query := `UPDATE download_jobs SET status = 'failed', error = $1, finished_at = NOW()
+			  WHERE status IN ('queued', 'running')`
+
+	result, err := db.Exec(query, reason)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка закрытия незавершенных задач: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+// GetDownloadJob возвращает задачу по id
+func GetDownloadJob(db *sql.DB, id int64) (*DownloadJob, error) {
+	query := `SELECT ` + downloadJobColumns + ` FROM download_jobs WHERE id = $1`
+
+	job, err := scanDownloadJob(db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения задачи скачивания: %v", err)
+	}
+	return job, nil
+}
+
+// GetUserDownloadJobs возвращает последние задачи пользователя
+func GetUserDownloadJobs(db *sql.DB, userID int64, limit int) ([]DownloadJob, error) {
+	query := `SELECT ` + downloadJobColumns + ` FROM download_jobs
+			  WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2`
+	return queryDownloadJobs(db, query, userID, limit)
+}
+
+// GetUserActiveDownloadJobs возвращает задачи пользователя в очереди и в работе
+func GetUserActiveDownloadJobs(db *sql.DB, userID int64) ([]DownloadJob, error) {
+	query := `SELECT ` + downloadJobColumns + ` FROM download_jobs
+			  WHERE user_id = $1 AND status IN ('queued', 'running') ORDER BY created_at`
+	return queryDownloadJobs(db, query, userID)
+}
+
+// CountUserFreeDownloadsSince считает успешные бесплатные скачивания пользователя с момента since
+func CountUserFreeDownloadsSince(db *sql.DB, userID int64, since time.Time) (int, error) {
+	query := `SELECT COUNT(*) FROM download_jobs
+			  WHERE user_id = $1 AND charge_id = '' AND status = 'done' AND created_at >= $2`
+
+	var count int
+	if err := db.QueryRow(query, userID, since).Scan(&count); err != nil {
+		return 0, fmt.Errorf("ошибка подсчета скачиваний: %v", err)
+	}
+	return count, nil
+}
+
+// CountUserDownloadsSince считает все успешные скачивания пользователя с момента since
+func CountUserDownloadsSince(db *sql.DB, userID int64, since time.Time) (int, error) {
+	query := `SELECT COUNT(*) FROM download_jobs
+			  WHERE user_id = $1 AND status = 'done' AND created_at >= $2`
+
+	var count int
+	if err := db.QueryRow(query, userID, since).Scan(&count); err != nil {
+		return 0, fmt.Errorf("ошибка подсчета скачиваний: %v", err)
+	}
+	return count, nil
+}
+
+func queryDownloadJobs(db *sql.DB, query string, args ...interface{}) ([]DownloadJob, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения задач скачивания: %v", err)
+	}
+	defer rows.Close()
+
+	var jobs []DownloadJob
+	for rows.Next() {
+		job, err := scanDownloadJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения задачи скачивания: %v", err)
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDownloadJob(row rowScanner) (*DownloadJob, error) {
+	var job DownloadJob
+	var errText sql.NullString
+	var startedAt, finishedAt sql.NullTime
+
+	err := row.Scan(&job.ID, &job.RequestID, &job.UserID, &job.URL, &job.ChargeID, &job.Status,
+		&errText, &job.CreatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Error = errText.String
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return &job, nil
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ReferrerStats статистика приглашений пользователя
+type ReferrerStats struct {
+	UserID   int64
+	Invited  int // перешли по ссылке
+	Rewarded int // скачали первое видео, награда начислена
+}
+
+// CreateReferral сохраняет, кто пригласил пользователя. Приглашение засчитывается только
+// новым пользователям: /start по ссылке — их первое сообщение боту, успешных скачиваний нет
+// и другого пригласившего тоже. Взаимные приглашения (пригласивший сам пришел по ссылке
+// приглашенного) не засчитываются. Возвращает false, если приглашение не засчитано
+func CreateReferral(db *sql.DB, referrerID, refereeID int64) (bool, error) {
+	if referrerID == refereeID {
+		return false, nil
+	}
+
+	res, err := db.Exec(`INSERT INTO referrals (referee_id, referrer_id)
+		SELECT $1, $2
+		WHERE COALESCE((SELECT messages FROM user_stats WHERE user_id = $1), 0) <= 1
+		  AND NOT EXISTS (SELECT 1 FROM download_jobs WHERE user_id = $1 AND status = 'done')
+		  AND NOT EXISTS (SELECT 1 FROM referrals WHERE referee_id = $2 AND referrer_id = $1)
+		ON CONFLICT (referee_id) DO NOTHING`, refereeID, referrerID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка сохранения приглашения: %v", err)
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// GrantReferralReward отмечает награду за приглашение пользователя выданной и в той же
+// транзакции начисляет кредиты и дни премиума пригласившему и приглашенному. Если
+// начисление не удалось, отметка не сохраняется и награда будет выдана позже.
+// Возвращает id пригласившего или 0, если награды нет или она уже выдана
+func GrantReferralReward(db *sql.DB, refereeID int64, credits int, premium time.Duration) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var referrerID int64
+	err = tx.QueryRow(`UPDATE referrals SET rewarded_at = NOW()
+		WHERE referee_id = $1 AND rewarded_at IS NULL
+		RETURNING referrer_id`, refereeID).Scan(&referrerID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ошибка начисления награды за приглашение: %v", err)
+	}
+
+	ref := fmt.Sprintf("referee:%d", refereeID)
+	for _, userID := range []int64{referrerID, refereeID} {
+		if credits > 0 {
+			if err := lockUserCredits(tx, userID); err != nil {
+				return 0, err
+			}
+			if err := insertCreditEntry(tx, userID, credits, CreditReferral, ref, 0); err != nil {
+				return 0, err
+			}
+		}
+		if premium > 0 {
+			if _, err := extendUserPremium(tx, userID, premium); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return referrerID, tx.Commit()
+}
+
+// GetReferrerStats возвращает статистику приглашений пользователя
+func GetReferrerStats(db *sql.DB, userID int64) (ReferrerStats, error) {
+	stats := ReferrerStats{UserID: userID}
+	err := db.QueryRow(`SELECT COUNT(*), COUNT(rewarded_at) FROM referrals WHERE referrer_id = $1`, userID).
+		Scan(&stats.Invited, &stats.Rewarded)
+	if err != nil {
+		return stats, fmt.Errorf("ошибка получения статистики приглашений: %v", err)
+	}
+	return stats, nil
+}
+
+// GetTopReferrers возвращает пользователей, пригласивших больше всех активных пользователей
+func GetTopReferrers(db *sql.DB, limit int) ([]ReferrerStats, error) {
+	rows, err := db.Query(`SELECT referrer_id, COUNT(*), COUNT(rewarded_at) FROM referrals
+		GROUP BY referrer_id ORDER BY COUNT(rewarded_at) DESC, COUNT(*) DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения топа приглашений: %v", err)
+	}
+	defer rows.Close()
+
+	var result []ReferrerStats
+	for rows.Next() {
+		var s ReferrerStats
+		if err := rows.Scan(&s.UserID, &s.Invited, &s.Rewarded); err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, rows.Err()
+}
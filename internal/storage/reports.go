@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// NamedCount значение и число для топов дайджеста
+type NamedCount struct {
+	Name  string
+	Count int64
+}
+
+// Digest сводка работы бота за период [From, To)
+type Digest struct {
+	From, To time.Time
+
+	NewUsers    int64
+	ActiveUsers int64
+
+	Downloads       int64 // завершенные задачи скачивания
+	CacheHits       int64 // из них отправлены из кэша
+	FailedDownloads int64
+
+	Payments int64
+	Revenue  int64 // Stars
+
+	Refunds       int64
+	RefundedStars int64
+	FailedRefunds int64
+	PaymentErrors int64
+
+	TopSites             []NamedCount
+	TopFailingExtractors []NamedCount
+}
+
+// CacheHitRate доля скачиваний, отправленных из кэша, в процентах
+func (d *Digest) CacheHitRate() int64 {
+	if d.Downloads == 0 {
+		return 0
+	}
+	return d.CacheHits * 100 / d.Downloads
+}
+
+// digestTopLimit сколько сайтов и экстракторов показывать в топах
+const digestTopLimit = 5
+
+// GetDigest собирает сводку за период [from, to)
+func GetDigest(db *sql.DB, from, to time.Time) (*Digest, error) {
+	d := &Digest{From: from, To: to}
+
+	err := db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM (SELECT user_id FROM events GROUP BY user_id HAVING MIN(created_at) >= $1 AND MIN(created_at) < $2) n),
+			(SELECT COUNT(DISTINCT user_id) FROM events WHERE created_at >= $1 AND created_at < $2),
+			(SELECT COUNT(*) FILTER (WHERE status = 'done') FROM download_jobs WHERE finished_at >= $1 AND finished_at < $2),
+			(SELECT COUNT(*) FILTER (WHERE status = 'done' AND cache_hit) FROM download_jobs WHERE finished_at >= $1 AND finished_at < $2),
+			(SELECT COUNT(*) FILTER (WHERE status = 'failed') FROM download_jobs WHERE finished_at >= $1 AND finished_at < $2),
+			(SELECT COUNT(*) FROM events WHERE type = 'payment' AND created_at >= $1 AND created_at < $2),
+			(SELECT COALESCE(SUM(amount), 0) FROM events WHERE type = 'payment' AND created_at >= $1 AND created_at < $2),
+			(SELECT COUNT(*) FILTER (WHERE success) FROM refund_audit WHERE created_at >= $1 AND created_at < $2),
+			(SELECT COALESCE(SUM(amount) FILTER (WHERE success), 0) FROM refund_audit WHERE created_at >= $1 AND created_at < $2),
+			(SELECT COUNT(*) FILTER (WHERE NOT success) FROM refund_audit WHERE created_at >= $1 AND created_at < $2),
+			(SELECT COUNT(*) FROM events WHERE type = 'payment_error' AND created_at >= $1 AND created_at < $2)`,
+		from, to).Scan(&d.NewUsers, &d.ActiveUsers, &d.Downloads, &d.CacheHits, &d.FailedDownloads,
+		&d.Payments, &d.Revenue, &d.Refunds, &d.RefundedStars, &d.FailedRefunds, &d.PaymentErrors)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения сводки: %v", err)
+	}
+
+	// Сайт — домен ссылки без www
+	d.TopSites, err = queryNamedCounts(db, `
+		SELECT COALESCE(substring(lower(url) FROM '^[a-z]+://(?:www\.|m\.)?([^/:?#]+)'), 'unknown') AS site, COUNT(*)
+		FROM download_jobs WHERE created_at >= $1 AND created_at < $2
+		GROUP BY site ORDER BY COUNT(*) DESC, site LIMIT $3`, from, to, digestTopLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Экстрактор yt-dlp указан в ошибке в квадратных скобках: "ERROR: [youtube] id: ..."
+	d.TopFailingExtractors, err = queryNamedCounts(db, `
+		SELECT COALESCE(substring(error FROM '\[([A-Za-z0-9:_-]+)\]'), 'unknown') AS extractor, COUNT(*)
+		FROM download_jobs WHERE status = 'failed' AND finished_at >= $1 AND finished_at < $2
+		GROUP BY extractor ORDER BY COUNT(*) DESC, extractor LIMIT $3`, from, to, digestTopLimit)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func queryNamedCounts(db *sql.DB, query string, args ...interface{}) ([]NamedCount, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения топа: %v", err)
+	}
+	defer rows.Close()
+
+	var result []NamedCount
+	for rows.Next() {
+		var c NamedCount
+		if err := rows.Scan(&c.Name, &c.Count); err != nil {
+			return nil, fmt.Errorf("ошибка чтения топа: %v", err)
+		}
+		result = append(result, c)
+	}
+	return result, rows.Err()
+}
+
+// AlertCounts ошибки за последнее окно для алертов
+type AlertCounts struct {
+	Downloads       int64 // завершенные задачи скачивания, успешные и нет
+	FailedDownloads int64
+	PaymentErrors   int64
+}
+
+// GetAlertCounts считает ошибки за последние window по часам БД
+func GetAlertCounts(db *sql.DB, window time.Duration) (*AlertCounts, error) {
+	var c AlertCounts
+	err := db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM download_jobs WHERE status IN ('done', 'failed') AND finished_at >= NOW() - $1 * INTERVAL '1 second'),
+			(SELECT COUNT(*) FROM download_jobs WHERE status = 'failed' AND finished_at >= NOW() - $1 * INTERVAL '1 second'),
+			(SELECT COUNT(*) FROM events WHERE type = 'payment_error' AND created_at >= NOW() - $1 * INTERVAL '1 second')`,
+		int64(window.Seconds())).Scan(&c.Downloads, &c.FailedDownloads, &c.PaymentErrors)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета ошибок: %v", err)
+	}
+	return &c, nil
+}
+
+// ClaimReportRun отмечает дайджест за период как отправленный. false — его уже отправили
+func ClaimReportRun(db *sql.DB, kind string, periodStart time.Time) (bool, error) {
+	result, err := db.Exec(`INSERT INTO report_runs (kind, period_start) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		kind, periodStart.Format("2006-01-02"))
+	if err != nil {
+		return false, fmt.Errorf("ошибка записи отправки дайджеста: %v", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ReleaseReportRun снимает отметку, если дайджест не удалось отправить ни в один чат
+func ReleaseReportRun(db *sql.DB, kind string, periodStart time.Time) error {
+	_, err := db.Exec(`DELETE FROM report_runs WHERE kind = $1 AND period_start = $2`, kind, periodStart.Format("2006-01-02"))
+	return err
+}
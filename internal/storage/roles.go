@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// UserRole запись о роли сотрудника бота
+type UserRole struct {
+	UserID    int64
+	Role      string
+	GrantedBy int64
+	GrantedAt time.Time
+}
+
+// GetUserRoles возвращает все выданные роли
+func GetUserRoles(db *sql.DB) ([]UserRole, error) {
+	query := `SELECT user_id, role, granted_by, granted_at FROM user_roles ORDER BY granted_at`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения ролей: %v", err)
+	}
+	defer rows.Close()
+
+	var result []UserRole
+	for rows.Next() {
+		var r UserRole
+		if err := rows.Scan(&r.UserID, &r.Role, &r.GrantedBy, &r.GrantedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения роли: %v", err)
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// SetUserRole выдает пользователю роль (или заменяет текущую)
+func SetUserRole(db *sql.DB, userID int64, role string, grantedBy int64) error {
+	query := `INSERT INTO user_roles (user_id, role, granted_by, granted_at) VALUES ($1, $2, $3, NOW())
+			  ON CONFLICT (user_id) DO UPDATE SET
+			  role = EXCLUDED.role,
+			  granted_by = EXCLUDED.granted_by,
+			  granted_at = NOW()`
+
+	_, err := db.Exec(query, userID, role, grantedBy)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения роли: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteUserRole отзывает роль пользователя
+func DeleteUserRole(db *sql.DB, userID int64) error {
+	query := `DELETE FROM user_roles WHERE user_id = $1`
+
+	_, err := db.Exec(query, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления роли: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SponsorChannel канал, подписка на который открывает бесплатные скачивания
+type SponsorChannel struct {
+	Channel    string // @username или chat_id
+	Title      string
+	InviteLink string
+	Required   bool
+	AddedBy    int64
+	CreatedAt  time.Time
+}
+
+// SponsorConversion статистика подписок по каналу
+type SponsorConversion struct {
+	Channel   string
+	Prompted  int // получили предложение подписаться
+	Converted int // подписались после предложения
+	Members   int // подписаны по последней проверке
+	Churned   int // отписались после бесплатных скачиваний
+}
+
+// GetSponsorChannels возвращает каналы спонсоров в порядке добавления
+func GetSponsorChannels(db *sql.DB) ([]SponsorChannel, error) {
+	rows, err := db.Query(`SELECT channel, title, invite_link, required, added_by, created_at FROM sponsor_channels ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения каналов спонсоров: %v", err)
+	}
+	defer rows.Close()
+
+	var result []SponsorChannel
+	for rows.Next() {
+		var ch SponsorChannel
+		if err := rows.Scan(&ch.Channel, &ch.Title, &ch.InviteLink, &ch.Required, &ch.AddedBy, &ch.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения канала спонсора: %v", err)
+		}
+		result = append(result, ch)
+	}
+	return result, rows.Err()
+}
+
+// SaveSponsorChannel добавляет канал спонсора или обновляет его настройки
+func SaveSponsorChannel(db *sql.DB, ch *SponsorChannel) error {
+	_, err := db.Exec(`INSERT INTO sponsor_channels (channel, title, invite_link, required, added_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (channel) DO UPDATE SET
+		title = EXCLUDED.title, invite_link = EXCLUDED.invite_link, required = EXCLUDED.required`,
+		ch.Channel, ch.Title, ch.InviteLink, ch.Required, ch.AddedBy)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения канала спонсора: %v", err)
+	}
+	return nil
+}
+
+// DeleteSponsorChannel удаляет канал спонсора. Возвращает false, если канала не было
+func DeleteSponsorChannel(db *sql.DB, channel string) (bool, error) {
+	res, err := db.Exec(`DELETE FROM sponsor_channels WHERE channel = $1`, channel)
+	if err != nil {
+		return false, fmt.Errorf("ошибка удаления канала спонсора: %v", err)
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// RecordChannelMembership сохраняет результат проверки подписки. Первая неудачная проверка
+// считается предложением подписаться, первая успешная — подпиской, переход из подписчиков — отпиской
+func RecordChannelMembership(db *sql.DB, channel string, userID int64, isMember bool) error {
+	_, err := db.Exec(`INSERT INTO channel_memberships (channel, user_id, is_member, prompted_at, joined_at, checked_at)
+		VALUES ($1, $2, $3, CASE WHEN $3 THEN NULL ELSE NOW() END, CASE WHEN $3 THEN NOW() ELSE NULL END, NOW())
+		ON CONFLICT (channel, user_id) DO UPDATE SET
+		is_member = EXCLUDED.is_member,
+		checked_at = NOW(),
+		prompted_at = COALESCE(channel_memberships.prompted_at, EXCLUDED.prompted_at),
+		joined_at = CASE WHEN EXCLUDED.is_member AND channel_memberships.joined_at IS NULL THEN NOW()
+		                 ELSE channel_memberships.joined_at END,
+		left_at = CASE WHEN channel_memberships.is_member AND NOT EXCLUDED.is_member THEN NOW()
+		               ELSE channel_memberships.left_at END`,
+		channel, userID, isMember)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения подписки на канал: %v", err)
+	}
+	return nil
+}
+
+// GetChannelMembership возвращает последний известный статус подписки и время его получения.
+// found = false, если пользователя по каналу еще не проверяли
+func GetChannelMembership(db *sql.DB, channel string, userID int64) (isMember bool, checkedAt time.Time, found bool, err error) {
+	err = db.QueryRow(`SELECT is_member, checked_at FROM channel_memberships WHERE channel = $1 AND user_id = $2`,
+		channel, userID).Scan(&isMember, &checkedAt)
+	if err == sql.ErrNoRows {
+		return false, time.Time{}, false, nil
+	}
+	if err != nil {
+		return false, time.Time{}, false, fmt.Errorf("ошибка получения подписки на канал: %v", err)
+	}
+	return isMember, checkedAt, true, nil
+}
+
+// GetSponsorConversions возвращает статистику подписок по каналам. Отток — пользователи,
+// которые отписались после хотя бы одного бесплатного скачивания за время подписки
+func GetSponsorConversions(db *sql.DB) (map[string]SponsorConversion, error) {
+	rows, err := db.Query(`SELECT m.channel,
+		COUNT(m.prompted_at),
+		COUNT(*) FILTER (WHERE m.prompted_at IS NOT NULL AND m.joined_at >= m.prompted_at),
+		COUNT(*) FILTER (WHERE m.is_member),
+		COUNT(*) FILTER (WHERE NOT m.is_member AND m.left_at IS NOT NULL AND EXISTS (
+			SELECT 1 FROM download_jobs j
+			WHERE j.user_id = m.user_id AND j.charge_id = '' AND j.status = 'done'
+			AND j.finished_at >= m.joined_at AND j.finished_at <= m.left_at))
+		FROM channel_memberships m GROUP BY m.channel`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения статистики подписок: %v", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string]SponsorConversion)
+	for rows.Next() {
+		var s SponsorConversion
+		if err := rows.Scan(&s.Channel, &s.Prompted, &s.Converted, &s.Members, &s.Churned); err != nil {
+			return nil, err
+		}
+		result[s.Channel] = s
+	}
+	return result, rows.Err()
+}
+
+// AddSponsorWaiter запоминает, что пользователь ждет разблокировки бесплатных скачиваний.
+// Заодно удаляет ожидания старше olderThan
+func AddSponsorWaiter(db *sql.DB, userID int64, olderThan time.Duration) error {
+	if _, err := db.Exec(`DELETE FROM sponsor_waiters WHERE created_at < $1`, time.Now().Add(-olderThan)); err != nil {
+		return fmt.Errorf("ошибка очистки ожидающих подписки: %v", err)
+	}
+	_, err := db.Exec(`INSERT INTO sponsor_waiters (user_id, created_at) VALUES ($1, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET created_at = NOW()`, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения ожидающего подписки: %v", err)
+	}
+	return nil
+}
+
+// IsSponsorWaiter проверяет, ждет ли пользователь разблокировки не дольше maxAge
+func IsSponsorWaiter(db *sql.DB, userID int64, maxAge time.Duration) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM sponsor_waiters WHERE user_id = $1 AND created_at >= $2)`,
+		userID, time.Now().Add(-maxAge)).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки ожидающего подписки: %v", err)
+	}
+	return exists, nil
+}
+
+// RemoveSponsorWaiter снимает ожидание. Возвращает false, если пользователь не ждал
+func RemoveSponsorWaiter(db *sql.DB, userID int64) (bool, error) {
+	res, err := db.Exec(`DELETE FROM sponsor_waiters WHERE user_id = $1`, userID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка удаления ожидающего подписки: %v", err)
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
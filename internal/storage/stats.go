@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TotalStats агрегированная статистика бота (строка total_stats с id = 1)
+type TotalStats struct {
+	Users     int64     `json:"users"`
+	Downloads int64     `json:"downloads"`
+	Messages  int64     `json:"messages"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UserStats статистика одного пользователя
+type UserStats struct {
+	UserID     int64     `json:"user_id"`
+	Messages   int64     `json:"messages"`
+	Downloads  int64     `json:"downloads"`
+	LastActive time.Time `json:"last_active"`
+	CreatedAt  time.Time `json:"created_at"`
+	State      string    `json:"state"` // active, blocked, deactivated
+}
+
+// GetTotalStats возвращает общую статистику; sql.ErrNoRows, если строка еще не создана
+func GetTotalStats(db *sql.DB) (*TotalStats, error) {
+	query := `SELECT COALESCE(total_users, 0), COALESCE(total_downloads, 0), COALESCE(total_messages, 0), updated_at
+			  FROM total_stats WHERE id = 1`
+
+	var s TotalStats
+	if err := db.QueryRow(query).Scan(&s.Users, &s.Downloads, &s.Messages, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetAllUserStats возвращает статистику всех пользователей по убыванию числа сообщений
+func GetAllUserStats(db *sql.DB) ([]UserStats, error) {
+	query := `SELECT s.user_id, COALESCE(s.messages, 0), COALESCE(s.downloads, 0), s.last_active, s.created_at,
+			  COALESCE(u.state, 'active')
+			  FROM user_stats s LEFT JOIN users u ON u.user_id = s.user_id
+			  ORDER BY s.messages DESC, s.user_id`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения статистики пользователей: %v", err)
+	}
+	defer rows.Close()
+
+	var stats []UserStats
+	for rows.Next() {
+		var s UserStats
+		if err := rows.Scan(&s.UserID, &s.Messages, &s.Downloads, &s.LastActive, &s.CreatedAt, &s.State); err != nil {
+			return nil, fmt.Errorf("ошибка чтения статистики пользователя: %v", err)
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Состояния пользователя относительно бота
+const (
+	UserActive      = "active"      // бот может писать пользователю
+	UserBlocked     = "blocked"     // пользователь заблокировал бота
+	UserDeactivated = "deactivated" // аккаунт пользователя удален
+)
+
+// GetUserLanguage возвращает язык, выбранный пользователем через /language.
+// Пустая строка означает, что пользователь язык не выбирал
+func GetUserLanguage(db *sql.DB, userID int64) (string, error) {
+	query := `SELECT language_code FROM users WHERE user_id = $1`
+
+	var lang sql.NullString
+	err := db.QueryRow(query, userID).Scan(&lang)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("ошибка получения языка пользователя: %v", err)
+	}
+
+	return lang.String, nil
+}
+
+// SetUserLanguage сохраняет выбранный пользователем язык
+func SetUserLanguage(db *sql.DB, userID int64, lang string) error {
+	query := `INSERT INTO users (user_id, language_code) VALUES ($1, $2)
+			  ON CONFLICT (user_id) DO UPDATE SET
+			  language_code = EXCLUDED.language_code`
+
+	_, err := db.Exec(query, userID, lang)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения языка пользователя: %v", err)
+	}
+
+	return nil
+}
+
+// UserLanguageStore хранит языковые предпочтения пользователей в таблице users
+type UserLanguageStore struct {
+	db *sql.DB
+}
+
+// NewUserLanguageStore создает хранилище языковых предпочтений
+func NewUserLanguageStore(db *sql.DB) *UserLanguageStore {
+	return &UserLanguageStore{db: db}
+}
+
+// GetUserLanguage возвращает сохраненный язык пользователя
+func (s *UserLanguageStore) GetUserLanguage(userID int64) (string, error) {
+	return GetUserLanguage(s.db, userID)
+}
+
+// SetUserLanguage сохраняет язык пользователя
+func (s *UserLanguageStore) SetUserLanguage(userID int64, lang string) error {
+	return SetUserLanguage(s.db, userID, lang)
+}
+
+// GetUserPremiumUntil возвращает дату окончания премиум-подписки пользователя.
+// nil означает, что подписки никогда не было
+func GetUserPremiumUntil(db *sql.DB, userID int64) (*time.Time, error) {
+	query := `SELECT premium_until FROM users WHERE user_id = $1`
+
+	var until sql.NullTime
+	err := db.QueryRow(query, userID).Scan(&until)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения премиум-подписки: %v", err)
+	}
+
+	if !until.Valid {
+		return nil, nil
+	}
+	return &until.Time, nil
+}
+
+// ExtendUserPremium продлевает премиум-подписку на duration от текущей даты окончания
+// (или от текущего момента, если подписка истекла). Возвращает новую дату окончания
+func ExtendUserPremium(db *sql.DB, userID int64, duration time.Duration) (time.Time, error) {
+	return extendUserPremium(db, userID, duration)
+}
+
+// rowQuerier *sql.DB или *sql.Tx
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func extendUserPremium(q rowQuerier, userID int64, duration time.Duration) (time.Time, error) {
+	query := `INSERT INTO users (user_id, premium_until) VALUES ($1, NOW() + $2 * INTERVAL '1 second')
+			  ON CONFLICT (user_id) DO UPDATE SET
+			  premium_until = GREATEST(COALESCE(users.premium_until, NOW()), NOW()) + $2 * INTERVAL '1 second'
+			  RETURNING premium_until`
+
+	var until time.Time
+	if err := q.QueryRow(query, userID, int64(duration.Seconds())).Scan(&until); err != nil {
+		return time.Time{}, fmt.Errorf("ошибка продления премиум-подписки: %v", err)
+	}
+	return until, nil
+}
+
+// SetUserState сохраняет состояние пользователя и возвращает предыдущее.
+// Если состояние не изменилось, возвращается новое; пользователь без записи считается активным
+func SetUserState(db *sql.DB, userID int64, state string) (string, error) {
+	query := `WITH prev AS (SELECT state FROM users WHERE user_id = $1)
+			  INSERT INTO users (user_id, state, state_changed_at) VALUES ($1, $2, NOW())
+			  ON CONFLICT (user_id) DO UPDATE SET
+			  state = EXCLUDED.state,
+			  state_changed_at = NOW()
+			  WHERE users.state <> EXCLUDED.state
+			  RETURNING COALESCE((SELECT state FROM prev), $3)`
+
+	var prev string
+	err := db.QueryRow(query, userID, state, UserActive).Scan(&prev)
+	if err == sql.ErrNoRows {
+		return state, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка сохранения состояния пользователя: %v", err)
+	}
+	return prev, nil
+}
+
+// TouchUser вызывается на каждое сообщение пользователя: запоминает язык из профиля Telegram
+// для сегментов рассылок и возвращает пользователя в состояние active. Возвращает предыдущее
+// состояние; запись обновляется, только если что-то изменилось
+func TouchUser(db *sql.DB, userID int64, telegramLanguage string) (string, error) {
+	query := `WITH prev AS (SELECT state FROM users WHERE user_id = $1)
+			  INSERT INTO users (user_id, telegram_language) VALUES ($1, NULLIF($2, ''))
+			  ON CONFLICT (user_id) DO UPDATE SET
+			  telegram_language = COALESCE(EXCLUDED.telegram_language, users.telegram_language),
+			  state = $3,
+			  state_changed_at = CASE WHEN users.state <> $3 THEN NOW() ELSE users.state_changed_at END
+			  WHERE users.state <> $3
+			     OR users.telegram_language IS DISTINCT FROM COALESCE(EXCLUDED.telegram_language, users.telegram_language)
+			  RETURNING COALESCE((SELECT state FROM prev), $3)`
+
+	var prev string
+	err := db.QueryRow(query, userID, telegramLanguage, UserActive).Scan(&prev)
+	if err == sql.ErrNoRows {
+		return UserActive, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка обновления пользователя: %v", err)
+	}
+	return prev, nil
+}
+
+// CountUsersByState считает писавших боту пользователей (user_stats) по состояниям:
+// активных, заблокировавших бота и удаливших аккаунт
+func CountUsersByState(db *sql.DB) (active, blocked, deactivated int64, err error) {
+	query := `SELECT COUNT(*) FILTER (WHERE COALESCE(u.state, $1) = $1),
+			  COUNT(*) FILTER (WHERE u.state = $2),
+			  COUNT(*) FILTER (WHERE u.state = $3)
+			  FROM user_stats s LEFT JOIN users u ON u.user_id = s.user_id`
+
+	if err := db.QueryRow(query, UserActive, UserBlocked, UserDeactivated).Scan(&active, &blocked, &deactivated); err != nil {
+		return 0, 0, 0, fmt.Errorf("ошибка подсчета пользователей по состояниям: %v", err)
+	}
+	return active, blocked, deactivated, nil
+}
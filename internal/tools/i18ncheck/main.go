@@ -0,0 +1,142 @@
+// i18ncheck проверяет, что пользовательские тексты в обработчиках бота идут через i18n:
+// в Send/Reply/Edit нельзя передавать строковые литералы и fmt.Sprintf, а ключи,
+// переданные в T/TL литералом, должны существовать в базовом языке.
+//
+// Использование:
+//
+//	go run ./internal/tools/i18ncheck [директория...]
+//
+// По умолчанию проверяется ./internal/bot. Код возврата 1, если найдены нарушения.
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"YoutubeDownloader/internal/i18n"
+)
+
+// sendMethods методы, отправляющие текст пользователю
+var sendMethods = map[string]bool{
+	"Send":        true,
+	"Reply":       true,
+	"Edit":        true,
+	"EditOrSend":  true,
+	"EditOrReply": true,
+}
+
+// formatFuncs функции fmt, собирающие текст из литерала
+var formatFuncs = map[string]bool{
+	"Sprintf":  true,
+	"Sprint":   true,
+	"Sprintln": true,
+}
+
+const fallbackLang = "ru"
+
+func main() {
+	dirs := os.Args[1:]
+	if len(dirs) == 0 {
+		dirs = []string{"./internal/bot"}
+	}
+
+	manager := i18n.NewManager(fallbackLang)
+	if err := manager.LoadEmbedded(); err != nil {
+		fmt.Fprintf(os.Stderr, "i18ncheck: ошибка загрузки переводов: %v\n", err)
+		os.Exit(2)
+	}
+
+	var problems []string
+	fset := token.NewFileSet()
+	for _, dir := range dirs {
+		files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "i18ncheck: %v\n", err)
+			os.Exit(2)
+		}
+		for _, file := range files {
+			if strings.HasSuffix(file, "_test.go") {
+				continue
+			}
+			f, err := parser.ParseFile(fset, file, nil, 0)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "i18ncheck: %v\n", err)
+				os.Exit(2)
+			}
+			problems = append(problems, checkFile(fset, f, manager)...)
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		fmt.Printf("i18ncheck: найдено нарушений: %d\n", len(problems))
+		os.Exit(1)
+	}
+}
+
+// checkFile ищет нарушения в одном файле
+func checkFile(fset *token.FileSet, f *ast.File, manager *i18n.Manager) []string {
+	var problems []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+
+		switch {
+		case sendMethods[sel.Sel.Name] && len(call.Args) > 0:
+			if isUserLiteral(call.Args[0]) {
+				problems = append(problems, fmt.Sprintf("%s: текст в %s не локализован, используйте i18nManager.T", fset.Position(call.Pos()), sel.Sel.Name))
+			}
+		case (sel.Sel.Name == "T" || sel.Sel.Name == "TL") && len(call.Args) >= 2:
+			if key, ok := stringLiteral(call.Args[1]); ok && !manager.HasKey(fallbackLang, key) {
+				problems = append(problems, fmt.Sprintf("%s: ключ %q отсутствует в %s.json", fset.Position(call.Pos()), key, fallbackLang))
+			}
+		}
+		return true
+	})
+	return problems
+}
+
+// isUserLiteral сообщает, собран ли текст из строкового литерала напрямую
+func isUserLiteral(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		return e.Kind == token.STRING
+	case *ast.BinaryExpr:
+		return e.Op == token.ADD && (isUserLiteral(e.X) || isUserLiteral(e.Y))
+	case *ast.ParenExpr:
+		return isUserLiteral(e.X)
+	case *ast.CallExpr:
+		sel, ok := e.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return false
+		}
+		pkg, ok := sel.X.(*ast.Ident)
+		return ok && pkg.Name == "fmt" && formatFuncs[sel.Sel.Name]
+	}
+	return false
+}
+
+func stringLiteral(expr ast.Expr) (string, bool) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	value, err := strconv.Unquote(lit.Value)
+	return value, err == nil
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
@@ -37,7 +38,7 @@ func CleanupTempFiles(tmpDir string) {
 		if strings.HasPrefix(fileName, "ytvideo_") && info.ModTime().Before(cutoff) {
 			filePath := filepath.Join(tmpDir, fileName)
 			os.Remove(filePath)
-			fmt.Printf("[DOWNLOADER] Удален старый временный файл: %s\n", filePath)
+			slog.Debug("Удален старый временный файл", "component", "DOWNLOADER", "file", filePath)
 		}
 	}
 }
@@ -69,6 +70,6 @@ func DiagnoseFileSystem(tmpDir string) error {
 	if err := os.Remove(testLargeFile); err != nil {
 		return fmt.Errorf("не удалось удалить тестовый файл: %v", err)
 	}
-	fmt.Printf("[DOWNLOADER] Диагностика файловой системы: OK (достаточно места для скачивания)\n")
+	slog.Debug("Диагностика файловой системы: OK (достаточно места для скачивания)", "component", "DOWNLOADER")
 	return nil
 }
@@ -0,0 +1,8 @@
+package utils
+
+import "errors"
+
+// FreeSpace на Windows не реализован: проверка места ограничивается DiagnoseFileSystem
+func FreeSpace(path string) (uint64, error) {
+	return 0, errors.New("не поддерживается на Windows")
+}
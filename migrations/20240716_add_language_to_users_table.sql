@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN IF NOT EXISTS user_id BIGINT UNIQUE; -- Telegram ID пользователя
+ALTER TABLE users ADD COLUMN IF NOT EXISTS language_code TEXT; -- язык, выбранный через /language
+ALTER TABLE users ALTER COLUMN username SET DEFAULT '';
+
+-- +goose Down
+ALTER TABLE users ALTER COLUMN username DROP DEFAULT;
+ALTER TABLE users DROP COLUMN IF EXISTS language_code;
+ALTER TABLE users DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id BIGINT PRIMARY KEY, -- Telegram ID сотрудника
+    role TEXT NOT NULL, -- owner, admin, support, stats_viewer
+    granted_by BIGINT NOT NULL,
+    granted_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS user_roles;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS download_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    request_id TEXT NOT NULL,
+    user_id BIGINT NOT NULL,
+    url TEXT NOT NULL,
+    charge_id TEXT NOT NULL DEFAULT '', -- пусто для бесплатных скачиваний
+    status TEXT NOT NULL, -- queued, running, done, failed
+    error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_download_jobs_user_created ON download_jobs (user_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE IF EXISTS download_jobs;
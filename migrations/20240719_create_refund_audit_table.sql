@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS refund_audit (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id BIGINT, -- NULL, если транзакция не найдена в БД (возврат по charge_id вручную)
+    charge_id TEXT NOT NULL,
+    user_id BIGINT NOT NULL,
+    amount INTEGER NOT NULL DEFAULT 0,
+    admin_id BIGINT NOT NULL,
+    reason TEXT NOT NULL,
+    success BOOLEAN NOT NULL,
+    response TEXT, -- ответ Telegram API или текст ошибки
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_refund_audit_transaction ON refund_audit (transaction_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_user_created ON transactions (user_id, created_at DESC);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_transactions_user_created;
+DROP TABLE IF EXISTS refund_audit;
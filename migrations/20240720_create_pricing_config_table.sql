@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS pricing_config (
+    id INTEGER PRIMARY KEY CHECK (id = 1), -- одна строка с действующей таблицей цен
+    config JSONB NOT NULL,
+    updated_by BIGINT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS pricing_rule TEXT; -- правило или план, по которому посчитана цена
+
+-- +goose Down
+ALTER TABLE transactions DROP COLUMN IF EXISTS pricing_rule;
+DROP TABLE IF EXISTS pricing_config;
@@ -0,0 +1,36 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS credit_ledger (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    delta INTEGER NOT NULL,           -- начисление (+) или списание (-) бесплатных скачиваний
+    reason TEXT NOT NULL,             -- grant, promo, download, download_refund
+    ref TEXT NOT NULL DEFAULT '',     -- промокод, URL или комментарий админа
+    admin_id BIGINT,                  -- кто начислил вручную
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_credit_ledger_user ON credit_ledger (user_id);
+
+CREATE TABLE IF NOT EXISTS promo_codes (
+    code TEXT PRIMARY KEY,
+    credits INTEGER NOT NULL,
+    max_uses INTEGER NOT NULL DEFAULT 0,       -- 0 — без ограничения
+    per_user_limit INTEGER NOT NULL DEFAULT 1,
+    uses INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP,
+    disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS promo_redemptions (
+    id BIGSERIAL PRIMARY KEY,
+    code TEXT NOT NULL REFERENCES promo_codes (code),
+    user_id BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_promo_redemptions_code_user ON promo_redemptions (code, user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS promo_redemptions;
+DROP TABLE IF EXISTS promo_codes;
+DROP TABLE IF EXISTS credit_ledger;
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS referrals (
+    referee_id BIGINT PRIMARY KEY,     -- приглашенный пользователь, у каждого один пригласивший
+    referrer_id BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    rewarded_at TIMESTAMP              -- когда начислена награда после первого скачивания
+);
+CREATE INDEX IF NOT EXISTS idx_referrals_referrer ON referrals (referrer_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS referrals;
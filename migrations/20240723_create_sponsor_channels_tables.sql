@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS sponsor_channels (
+    channel TEXT PRIMARY KEY,            -- @username или chat_id канала
+    title TEXT NOT NULL DEFAULT '',
+    invite_link TEXT NOT NULL DEFAULT '',
+    required BOOLEAN NOT NULL DEFAULT TRUE, -- обязательный канал; из необязательных достаточно любого одного
+    added_by BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS channel_memberships (
+    channel TEXT NOT NULL,
+    user_id BIGINT NOT NULL,
+    is_member BOOLEAN NOT NULL,
+    prompted_at TIMESTAMP,  -- когда пользователь впервые получил предложение подписаться
+    joined_at TIMESTAMP,    -- когда подписка впервые подтверждена
+    checked_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (channel, user_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS channel_memberships;
+DROP TABLE IF EXISTS sponsor_channels;
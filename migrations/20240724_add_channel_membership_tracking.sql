@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE channel_memberships ADD COLUMN IF NOT EXISTS left_at TIMESTAMP; -- когда пользователь последний раз отписался
+
+-- Пользователи, которым показали список каналов и которые ждут разблокировки бесплатных скачиваний
+CREATE TABLE IF NOT EXISTS sponsor_waiters (
+    user_id BIGINT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS sponsor_waiters;
+ALTER TABLE channel_memberships DROP COLUMN IF EXISTS left_at;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- IncrementTotal* обновляют строку id = 1; без нее счетчики молча не растут.
+-- Пользователи считаются по user_stats: в users есть только те, кто выбрал язык, купил подписку и т.п.
+INSERT INTO total_stats (id, total_users)
+SELECT 1, COUNT(*) FROM user_stats
+ON CONFLICT (id) DO NOTHING;
+
+-- +goose Down
+DELETE FROM total_stats WHERE id = 1;
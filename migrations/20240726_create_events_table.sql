@@ -0,0 +1,37 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    type TEXT NOT NULL,              -- message, link, paywall_shown, payment, download_delivered
+    plan TEXT NOT NULL DEFAULT '',   -- правило цены или план для paywall_shown и payment
+    amount INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_events_created_type ON events (created_at, type);
+CREATE INDEX IF NOT EXISTS idx_events_user_created ON events (user_id, created_at);
+
+-- История до появления событий: первое сообщение и дни активности пользователей,
+-- оплаченные транзакции и завершенные скачивания
+INSERT INTO events (user_id, type, created_at)
+SELECT user_id, 'message', created_at FROM user_stats WHERE created_at IS NOT NULL;
+
+INSERT INTO events (user_id, type, created_at)
+SELECT w.user_id, 'message', w.activity_date
+FROM weekly_user_activity w
+JOIN user_stats s ON s.user_id = w.user_id
+WHERE w.activity_date > s.created_at::date;
+
+INSERT INTO events (user_id, type, plan, amount, created_at)
+SELECT user_id, 'payment', COALESCE(pricing_rule, ''), amount, created_at
+FROM transactions
+WHERE status IN ('success', 'completed', 'refunding', 'refunded');
+
+INSERT INTO events (user_id, type, created_at)
+SELECT user_id, 'download_delivered', COALESCE(finished_at, created_at)
+FROM download_jobs WHERE status = 'done';
+
+-- IncrementTotalUsersIfNew проверял пользователя после вставки в user_stats и не считал новых
+UPDATE total_stats SET total_users = (SELECT COUNT(*) FROM user_stats), updated_at = NOW() WHERE id = 1;
+
+-- +goose Down
+DROP TABLE IF EXISTS events;
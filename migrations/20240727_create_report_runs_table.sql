@@ -0,0 +1,17 @@
+-- +goose Up
+-- Отметка доставки видео из кэша: доля попаданий в кэш в дайджестах
+ALTER TABLE download_jobs ADD COLUMN IF NOT EXISTS cache_hit BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS idx_download_jobs_finished ON download_jobs (finished_at);
+
+-- Отправленные дайджесты: период отправляется один раз, даже после перезапуска
+CREATE TABLE IF NOT EXISTS report_runs (
+    kind TEXT NOT NULL,           -- daily, weekly
+    period_start DATE NOT NULL,
+    sent_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (kind, period_start)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS report_runs;
+DROP INDEX IF EXISTS idx_download_jobs_finished;
+ALTER TABLE download_jobs DROP COLUMN IF EXISTS cache_hit;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- Время оплаты: выручка по дням считается по нему, а не по созданию pending транзакции
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS paid_at TIMESTAMP;
+
+-- До появления колонки время оплаты не сохранялось; updated_at — ближайшая оценка
+UPDATE transactions SET paid_at = updated_at
+WHERE paid_at IS NULL AND status IN ('success', 'completed', 'refunding', 'refunded');
+
+CREATE INDEX IF NOT EXISTS idx_transactions_paid_at ON transactions (paid_at);
+CREATE INDEX IF NOT EXISTS idx_transactions_charge_id ON transactions (telegram_payment_charge_id);
+CREATE INDEX IF NOT EXISTS idx_refund_audit_created ON refund_audit (created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_refund_audit_created;
+DROP INDEX IF EXISTS idx_transactions_charge_id;
+DROP INDEX IF EXISTS idx_transactions_paid_at;
+ALTER TABLE transactions DROP COLUMN IF EXISTS paid_at;
@@ -0,0 +1,34 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN IF NOT EXISTS telegram_language TEXT; -- язык из профиля Telegram для сегментов рассылок
+ALTER TABLE users ADD COLUMN IF NOT EXISTS news_opt_out BOOLEAN NOT NULL DEFAULT FALSE; -- отписка через /unsubscribe_news
+ALTER TABLE users ADD COLUMN IF NOT EXISTS blocked_at TIMESTAMP; -- пользователь заблокировал бота (ошибка 403 при рассылке)
+
+CREATE TABLE IF NOT EXISTS broadcasts (
+    id BIGSERIAL PRIMARY KEY,
+    admin_id BIGINT NOT NULL,
+    from_chat_id BIGINT NOT NULL,    -- сообщение-образец, которое копируется получателям
+    message_id INTEGER NOT NULL,
+    buttons TEXT NOT NULL DEFAULT '', -- JSON: [{"text": "...", "url": "..."}]
+    segment TEXT NOT NULL,           -- all, active:<дни>, subscribers, lang:<код>
+    status TEXT NOT NULL,            -- draft, queued, running, done, cancelled
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS broadcast_recipients (
+    broadcast_id BIGINT NOT NULL REFERENCES broadcasts (id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending', -- pending, sent, failed, blocked
+    error TEXT,
+    sent_at TIMESTAMP,
+    PRIMARY KEY (broadcast_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_broadcast_recipients_status ON broadcast_recipients (broadcast_id, status);
+
+-- +goose Down
+DROP TABLE IF EXISTS broadcast_recipients;
+DROP TABLE IF EXISTS broadcasts;
+ALTER TABLE users DROP COLUMN IF EXISTS blocked_at;
+ALTER TABLE users DROP COLUMN IF EXISTS news_opt_out;
+ALTER TABLE users DROP COLUMN IF EXISTS telegram_language;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Состояние пользователя относительно бота: active, blocked (заблокировал бота), deactivated (удалил аккаунт)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS state TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS state_changed_at TIMESTAMP;
+UPDATE users SET state = 'blocked', state_changed_at = blocked_at WHERE blocked_at IS NOT NULL;
+ALTER TABLE users DROP COLUMN IF EXISTS blocked_at;
+CREATE INDEX IF NOT EXISTS idx_users_state ON users (state) WHERE state <> 'active';
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_users_state;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS blocked_at TIMESTAMP;
+UPDATE users SET blocked_at = COALESCE(state_changed_at, NOW()) WHERE state <> 'active';
+ALTER TABLE users DROP COLUMN IF EXISTS state_changed_at;
+ALTER TABLE users DROP COLUMN IF EXISTS state;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Аренда рассылки: экземпляр бота, который ее отправляет, и время его последнего продления.
+-- Рассылку со свежим heartbeat_at другие экземпляры не подхватывают
+ALTER TABLE broadcasts ADD COLUMN IF NOT EXISTS owner TEXT;
+ALTER TABLE broadcasts ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE broadcasts DROP COLUMN IF EXISTS heartbeat_at;
+ALTER TABLE broadcasts DROP COLUMN IF EXISTS owner;
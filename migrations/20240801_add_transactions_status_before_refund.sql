@@ -0,0 +1,8 @@
+-- +goose Up
+-- Статус транзакции (success или completed) на момент захвата возврата: в него транзакция
+-- возвращается, если возврат не удался, в том числе при повторе зависшего возврата.
+-- Для возвратов, начатых до появления колонки, используется success
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS status_before_refund TEXT;
+
+-- +goose Down
+ALTER TABLE transactions DROP COLUMN IF EXISTS status_before_refund;
@@ -0,0 +1,10 @@
+// Package migrations встраивает SQL-миграции goose в бинарник, чтобы применять их
+// без goose CLI (см. internal/migrate)
+package migrations
+
+import "embed"
+
+// FS SQL-файлы миграций
+//
+//go:embed *.sql
+var FS embed.FS